@@ -42,6 +42,11 @@ func Init() {
 		log.Panic("ping mongo error", err)
 	}
 	collection = MgoCli.Database("terminus").Collection("conversation")
+	failureCollection = MgoCli.Database("terminus").Collection("parse_failure")
+	if err := initFailureIndex(); err != nil {
+		log.Panic("create parse failure index error", err)
+	}
+	recentCollection = MgoCli.Database("terminus").Collection("recent_file")
 }
 
 func InsertSingleConversation(msg Message) error {
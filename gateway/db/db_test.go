@@ -34,3 +34,38 @@ func TestConnection(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestParseFailure(t *testing.T) {
+	Init()
+	path := "/data/test/broken.pdf"
+	defer ClearParseFailure(path)
+	for i := 1; i <= MaxParseAttempts; i++ {
+		failure, err := RecordParseFailure(path, "aaa", "error", "broken")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failure.Attempts != i || failure.Quarantined != (i == MaxParseAttempts) {
+			t.Fatalf("attempt %d got %+v", i, failure)
+		}
+	}
+	// other content of the file starts over
+	failure, err := RecordParseFailure(path, "bbb", "error", "broken")
+	if err != nil || failure.Attempts != 1 || failure.Quarantined || failure.Md5 != "bbb" {
+		t.Fatalf("got %+v %v", failure, err)
+	}
+	for i := 2; i <= MaxParseAttempts; i++ {
+		if _, err := RecordParseFailure(path, "bbb", "error", "broken"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failures, err := ListParseFailures(true, 0)
+	if err != nil || len(failures) == 0 {
+		t.Fatalf("got %v %v", failures, err)
+	}
+	if err := ClearParseFailure(path); err != nil {
+		t.Fatal(err)
+	}
+	if failure, err := GetParseFailure(path); failure != nil || err != nil {
+		t.Fatalf("got %v %v", failure, err)
+	}
+}
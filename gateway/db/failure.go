@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var failureCollection *mongo.Collection
+
+// MaxParseAttempts is how many times in a row a file may fail to parse
+// before it is quarantined and no longer parsed on write events.
+var MaxParseAttempts = 3
+
+// ParseFailure records a file the watcher could not parse.
+type ParseFailure struct {
+	Path         string `json:"path" bson:"path"`
+	Md5          string `json:"md5" bson:"md5"`
+	Status       string `json:"status" bson:"status"`
+	Error        string `json:"error" bson:"error"`
+	Attempts     int    `json:"attempts" bson:"attempts"`
+	FirstAttempt int64  `json:"firstAttempt" bson:"firstAttempt"`
+	LastAttempt  int64  `json:"lastAttempt" bson:"lastAttempt"`
+	Quarantined  bool   `json:"quarantined" bson:"quarantined"`
+}
+
+// initFailureIndex keeps one failure record per path, so retries and
+// quarantine update the same record. Duplicates recorded before are dropped
+// first, keeping the latest attempt.
+func initFailureIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "lastAttempt", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$path"},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}
+	cursor, err := failureCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Ids []interface{} `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	for _, d := range duplicates {
+		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: d.Ids[1:]}}}}
+		if _, err := failureCollection.DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+	}
+	_, err = failureCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "path", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// RecordParseFailure counts another failed attempt of path with content md5
+// and quarantines it after MaxParseAttempts. Attempts of other content of
+// the file are not counted.
+func RecordParseFailure(path, md5, status, errMsg string) (*ParseFailure, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	now := time.Now().Unix()
+	_, err := failureCollection.UpdateOne(ctx,
+		bson.D{{Key: "path", Value: path}, {Key: "md5", Value: bson.D{{Key: "$ne", Value: md5}}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "attempts", Value: 0},
+			{Key: "quarantined", Value: false},
+			{Key: "firstAttempt", Value: now},
+		}}})
+	if err != nil {
+		return nil, err
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "md5", Value: md5},
+			{Key: "status", Value: status},
+			{Key: "error", Value: errMsg},
+			{Key: "lastAttempt", Value: now},
+		}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "firstAttempt", Value: now}}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	opt := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var failure ParseFailure
+	err = failureCollection.FindOneAndUpdate(ctx, bson.D{{Key: "path", Value: path}}, update, opt).Decode(&failure)
+	if err != nil {
+		return nil, err
+	}
+	if !failure.Quarantined && failure.Attempts >= MaxParseAttempts {
+		failure.Quarantined = true
+		_, err = failureCollection.UpdateOne(ctx, bson.D{{Key: "path", Value: path}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "quarantined", Value: true}}}})
+	}
+	return &failure, err
+}
+
+// GetParseFailure returns the failure record of path, nil when it has none.
+func GetParseFailure(path string) (*ParseFailure, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var failure ParseFailure
+	err := failureCollection.FindOne(ctx, bson.D{{Key: "path", Value: path}}).Decode(&failure)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &failure, nil
+}
+
+// ClearParseFailure forgets the failures of path once it parses or is gone.
+func ClearParseFailure(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := failureCollection.DeleteOne(ctx, bson.D{{Key: "path", Value: path}})
+	return err
+}
+
+// ListParseFailures returns the latest failures first, only the quarantined
+// ones when quarantinedOnly is set.
+func ListParseFailures(quarantinedOnly bool, limit int64) ([]ParseFailure, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	filter := bson.D{}
+	if quarantinedOnly {
+		filter = bson.D{{Key: "quarantined", Value: true}}
+	}
+	opt := options.Find().SetSort(bson.D{{Key: "lastAttempt", Value: -1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+	cursor, err := failureCollection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+	failures := make([]ParseFailure, 0)
+	if err := cursor.All(ctx, &failures); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
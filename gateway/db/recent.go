@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var recentCollection *mongo.Collection
+
+// OpenedFile records when a file was last opened from search.
+type OpenedFile struct {
+	Path   string `json:"path" bson:"path"`
+	Opened int64  `json:"opened" bson:"opened"`
+	Count  int    `json:"count" bson:"count"`
+}
+
+// RecordOpened notes that the file at path was opened now.
+func RecordOpened(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "opened", Value: time.Now().Unix()}}},
+		{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+	}
+	_, err := recentCollection.UpdateOne(ctx, bson.D{{Key: "path", Value: path}}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// ForgetOpened drops the record of path once the file is gone.
+func ForgetOpened(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := recentCollection.DeleteOne(ctx, bson.D{{Key: "path", Value: path}})
+	return err
+}
+
+// ListOpened returns the files opened most recently first.
+func ListOpened(limit int64) ([]OpenedFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	opt := options.Find().SetSort(bson.D{{Key: "opened", Value: -1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+	cursor, err := recentCollection.Find(ctx, bson.D{}, opt)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]OpenedFile, 0)
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,96 @@
+package inotify
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"time"
+	"wzinc/common"
+	"wzinc/parser"
+	"wzinc/rpc"
+
+	"github.com/rs/zerolog/log"
+)
+
+// indexArchive replaces the documents of the entries of an archive with its
+// current entries, each at a virtual path like /data/a.zip!/docs/spec.pdf.
+func indexArchive(archivePath string, data []byte) error {
+	err := deleteArchiveEntries(archivePath)
+	if err != nil {
+		return err
+	}
+	count := 0
+	err = parser.WalkArchive(data, archivePath, parser.DefaultArchiveLimits, func(virtualPath string, b []byte, truncated bool) error {
+		count++
+		// a broken entry must not keep the rest of the archive out of the index
+		if err := inputArchiveEntry(archivePath, virtualPath, b, truncated); err != nil {
+			log.Error().Msgf("input archive entry %s error %v", virtualPath, err)
+		}
+		return nil
+	})
+	if errors.Is(err, parser.ErrArchiveLimit) {
+		log.Warn().Msgf("archive %s exceeds limits %+v, indexed %d entries", archivePath, parser.DefaultArchiveLimits, count)
+		return nil
+	}
+	log.Debug().Msgf("indexed %d entries of archive %s", count, archivePath)
+	return err
+}
+
+// inputArchiveEntry indexes an entry read up to the archive limits, the md5
+// and size of a truncated entry are those of its head.
+func inputArchiveEntry(archivePath, virtualPath string, b []byte, truncated bool) error {
+	md5 := common.Md5File(bytes.NewReader(b))
+	size := len(b)
+	content := ""
+	var fields map[string]interface{}
+	if parser.IsParseAbleContent(virtualPath, b) {
+		content, fields = parseFile(virtualPath, md5, b, truncated)
+	} else if parser.IsMedia(virtualPath) {
+		content, fields = parseMedia(virtualPath, b)
+	}
+	filename := path.Base(virtualPath)
+	doc := map[string]interface{}{
+		"name":                  filename,
+		"where":                 virtualPath,
+		"md5":                   md5,
+		"content":               content,
+		"size":                  size,
+		"created":               time.Now().Unix(),
+		"updated":               time.Now().Unix(),
+		"format_name":           rpc.FormatFilename(filename),
+		parser.ArchiveFieldName: archivePath,
+	}
+	for k, v := range fields {
+		doc[k] = v
+	}
+	id, err := rpc.RpcServer.ZincInput(rpc.FileIndex, doc)
+	log.Debug().Msgf("zinc input archive entry doc id %s path %s", id, virtualPath)
+	if err != nil {
+		return err
+	}
+	inputPassages(string(id), virtualPath, content, fields)
+	return nil
+}
+
+func queryArchiveEntries(archivePath string) ([]rpc.FileQueryResult, error) {
+	res, err := rpc.RpcServer.ZincQueryByArchive(rpc.FileIndex, archivePath, int32(parser.DefaultArchiveLimits.MaxEntries))
+	if err != nil {
+		return nil, err
+	}
+	return rpc.GetFileQueryResult(res)
+}
+
+func deleteArchiveEntries(archivePath string) error {
+	docs, err := queryArchiveEntries(archivePath)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		_, err = rpc.RpcServer.ZincDeleteFile(doc.DocId)
+		if err != nil {
+			log.Error().Msgf("zinc delete error %s", err.Error())
+		}
+		log.Debug().Msgf("delete archive entry doc id %s path %s", doc.DocId, doc.Where)
+	}
+	return nil
+}
@@ -2,9 +2,10 @@ package inotify
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/fs"
-	"io/ioutil"
 	"math"
 	"os"
 	"path"
@@ -12,6 +13,7 @@ import (
 	"sync"
 	"time"
 	"wzinc/common"
+	"wzinc/db"
 	"wzinc/parser"
 	"wzinc/rpc"
 
@@ -47,7 +49,7 @@ func WatchPath(path string) {
 				return err
 			}
 		} else {
-			err = updateOrInputDoc(path)
+			err = updateOrInputDoc(path, false)
 			if err != nil {
 				log.Error().Msgf("udpate or input doc err %v", err)
 			}
@@ -148,13 +150,16 @@ func handleEvent(e jfsnotify.Event) error {
 			return err
 		}
 		for _, doc := range docs {
-			_, err = rpc.RpcServer.ZincDelete(doc.DocId, rpc.FileIndex)
+			_, err = rpc.RpcServer.ZincDeleteFile(doc.DocId)
 			if err != nil {
 				log.Error().Msgf("zinc delete error %s", err.Error())
 			}
 			log.Debug().Msgf("delete doc id %s path %s", doc.DocId, e.Name)
 		}
-		return nil
+		if err := db.ClearParseFailure(e.Name); err != nil {
+			log.Error().Msgf("clear parse failure %s error %v", e.Name, err)
+		}
+		return deleteArchiveEntries(e.Name)
 	}
 
 	if e.Has(jfsnotify.Create) || e.Has(jfsnotify.Write) || e.Has(jfsnotify.Chmod) {
@@ -170,7 +175,7 @@ func handleEvent(e jfsnotify.Event) error {
 				}
 			} else {
 				//input zinc file
-				err = updateOrInputDoc(docPath)
+				err = updateOrInputDoc(docPath, false)
 				if err != nil {
 					log.Error().Msgf("update or input doc error %v", err)
 				}
@@ -185,7 +190,9 @@ func handleEvent(e jfsnotify.Event) error {
 	return nil
 }
 
-func updateOrInputDoc(filepath string) error {
+// updateOrInputDoc indexes a file when it is new or changed. retry parses it
+// again even when unchanged or quarantined.
+func updateOrInputDoc(filepath string, retry bool) error {
 	log.Debug().Msg("try update or input" + filepath)
 	res, err := rpc.RpcServer.ZincQueryByPath(rpc.FileIndex, filepath)
 	if err != nil {
@@ -202,81 +209,92 @@ func updateOrInputDoc(filepath string) error {
 		if len(docs) > 1 {
 			for _, doc := range docs[1:] {
 				log.Debug().Msgf("delete redundant docid %s path %s", doc.DocId, doc.Where)
-				_, err := rpc.RpcServer.ZincDelete(doc.DocId, rpc.FileIndex)
+				_, err := rpc.RpcServer.ZincDeleteFile(doc.DocId)
 				if err != nil {
 					log.Error().Msgf("zinc delete error %v", err)
 				}
 			}
 		}
 		//update if doc changed
-		f, err := os.Open(filepath)
-		if err != nil {
-			return err
-		}
-		b, err := ioutil.ReadAll(f)
-		f.Close()
+		b, truncated, newMd5, err := readFile(filepath)
 		if err != nil {
 			return err
 		}
-		newMd5 := common.Md5File(bytes.NewReader(b))
-		if newMd5 != docs[0].Md5 {
+		if newMd5 != docs[0].Md5 || retry {
 			//doc changed
-			fileType := parser.GetTypeFromName(filepath)
-			if _, ok := parser.ParseAble[fileType]; ok {
-				log.Info().Msgf("push indexer task insert %s", filepath)
-				VectorCli.fsTask <- VectorDBTask{
-					Filename:  path.Base(filepath),
-					Filepath:  filepath,
-					IsInsert:  true,
-					Action:    AddAction,
-					TaskId:    uuid.NewString(),
-					StartTime: time.Now().Unix(),
-					FileId:    fileId(filepath),
+			if parser.IsParseAbleContent(filepath, b) {
+				if parser.IsDocument(filepath, b) {
+					log.Info().Msgf("push indexer task insert %s", filepath)
+					VectorCli.fsTask <- VectorDBTask{
+						Filename:  path.Base(filepath),
+						Filepath:  filepath,
+						IsInsert:  true,
+						Action:    AddAction,
+						TaskId:    uuid.NewString(),
+						StartTime: time.Now().Unix(),
+						FileId:    fileId(filepath),
+					}
 				}
-				content, err := parser.ParseDoc(bytes.NewReader(b), filepath)
+				content, fields, parsedMd5 := parseTracked(filepath, newMd5, b, truncated, retry)
+				newMd5 = parsedMd5
+				log.Debug().Msgf("update content from old doc id %s path %s", docs[0].DocId, filepath)
+				_, err = rpc.RpcServer.UpdateFileContentFromOldDoc(rpc.FileIndex, content, newMd5, docs[0], fields)
 				if err != nil {
 					return err
 				}
-				log.Debug().Msgf("update content from old doc id %s path %s", docs[0].DocId, filepath)
-				_, err = rpc.RpcServer.UpdateFileContentFromOldDoc(rpc.FileIndex, content, newMd5, docs[0])
+				inputPassages(docs[0].DocId, filepath, content, fields)
+				if !truncated && parser.IsArchive(filepath, b) {
+					return indexArchive(filepath, b)
+				}
+				return nil
+			}
+			if parser.IsMedia(filepath) {
+				content, fields := parseMedia(filepath, b)
+				log.Debug().Msgf("update media from old doc id %s path %s", docs[0].DocId, filepath)
+				_, err = rpc.RpcServer.UpdateFileContentFromOldDoc(rpc.FileIndex, content, newMd5, docs[0], fields)
 				return err
 			}
 			log.Debug().Msgf("doc format not parsable %s", filepath)
 			return nil
 		}
+		// archives indexed before their entries were expanded
+		if !truncated && parser.IsArchive(filepath, b) {
+			entries, err := rpc.RpcServer.ZincQueryByArchive(rpc.FileIndex, filepath, 1)
+			if err != nil {
+				return err
+			}
+			if len(entries.Hits.Hits) == 0 {
+				return indexArchive(filepath, b)
+			}
+		}
 		log.Debug().Msgf("ignore file %s md5: %s ", filepath, newMd5)
 		return nil
 	}
 
 	log.Debug().Msgf("no history doc, add new")
 	//path not exist input doc
-	f, err := os.Open(filepath)
-	if err != nil {
-		return err
-	}
-	b, err := ioutil.ReadAll(f)
-	f.Close()
+	b, truncated, md5, err := readFile(filepath)
 	if err != nil {
 		return err
 	}
-	md5 := common.Md5File(bytes.NewReader(b))
-	fileType := parser.GetTypeFromName(filepath)
 	content := ""
-	if _, ok := parser.ParseAble[fileType]; ok {
-		log.Info().Msgf("push indexer task insert %s", filepath)
-		VectorCli.fsTask <- VectorDBTask{
-			Filename:  path.Base(filepath),
-			Filepath:  filepath,
-			IsInsert:  true,
-			Action:    AddAction,
-			TaskId:    uuid.NewString(),
-			StartTime: time.Now().Unix(),
-			FileId:    fileId(filepath),
-		}
-		content, err = parser.ParseDoc(bytes.NewBuffer(b), filepath)
-		if err != nil {
-			return err
+	var fields map[string]interface{}
+	if parser.IsParseAbleContent(filepath, b) {
+		if parser.IsDocument(filepath, b) {
+			log.Info().Msgf("push indexer task insert %s", filepath)
+			VectorCli.fsTask <- VectorDBTask{
+				Filename:  path.Base(filepath),
+				Filepath:  filepath,
+				IsInsert:  true,
+				Action:    AddAction,
+				TaskId:    uuid.NewString(),
+				StartTime: time.Now().Unix(),
+				FileId:    fileId(filepath),
+			}
 		}
+		content, fields, md5 = parseTracked(filepath, md5, b, truncated, retry)
+	} else if parser.IsMedia(filepath) {
+		content, fields = parseMedia(filepath, b)
 	}
 	filename := path.Base(filepath)
 	size := 0
@@ -294,9 +312,143 @@ func updateOrInputDoc(filepath string) error {
 		"updated":     time.Now().Unix(),
 		"format_name": rpc.FormatFilename(filename),
 	}
+	for k, v := range fields {
+		doc[k] = v
+	}
 	id, err := rpc.RpcServer.ZincInput(rpc.FileIndex, doc)
 	log.Debug().Msgf("zinc input doc id %s path %s", id, filepath)
-	return err
+	if err != nil {
+		return err
+	}
+	inputPassages(string(id), filepath, content, fields)
+	if !truncated && parser.IsArchive(filepath, b) {
+		return indexArchive(filepath, b)
+	}
+	return nil
+}
+
+// inputPassages indexes the passages of a long file, which is searchable by
+// its content without them.
+func inputPassages(docId, filepath, content string, fields map[string]interface{}) {
+	err := rpc.RpcServer.ZincInputPassages(docId, filepath, path.Base(filepath), content, fields)
+	if err != nil {
+		log.Error().Msgf("zinc input passages of %s error %v", filepath, err)
+	}
+}
+
+// readFile reads a file up to the parse limit and the md5 of all of it, so
+// large files are never held in memory whole. truncated tells that b is only
+// the head of the file.
+func readFile(filepath string) (b []byte, truncated bool, md5 string, err error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, false, "", err
+	}
+	defer f.Close()
+	b, truncated, err = parser.ReadLimited(context.Background(), f, parser.DefaultParseLimits.MaxBytes)
+	if err != nil {
+		return nil, false, "", err
+	}
+	if !truncated {
+		return b, false, common.Md5File(bytes.NewReader(b)), nil
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, false, "", err
+	}
+	return b, true, common.Md5File(f), nil
+}
+
+// parseFile parses a file under the parse limits. A file that fails is still
+// indexed by name, with the outcome in parse_status.
+func parseFile(filepath, md5 string, b []byte, truncated bool) (string, map[string]interface{}) {
+	content, fields, err := parseCached(filepath, md5, b, truncated, false)
+	if err != nil {
+		log.Warn().Msgf("parse %s %v error %v", filepath, fields[parser.ParseStatusFieldName], err)
+	}
+	return content, fields
+}
+
+// parseCached parses b under the parse limits, reusing the result of content
+// with the same md5 parsed before unless refresh is set. Only results that
+// parsed are cached, failures are parsed again.
+func parseCached(filepath, md5 string, b []byte, truncated, refresh bool) (string, map[string]interface{}, error) {
+	if !refresh {
+		if content, fields, ok := parser.DefaultParseCache.Get(md5, filepath); ok {
+			return content, fields, nil
+		}
+	}
+	content, fields, err := parser.ParseDataLimited(context.Background(), b, truncated, filepath, parser.DefaultParseLimits)
+	if err != nil {
+		return content, fields, err
+	}
+	if err := parser.DefaultParseCache.Put(md5, filepath, content, fields); err != nil {
+		log.Error().Msgf("parse cache put %s error %v", filepath, err)
+	}
+	return content, fields, nil
+}
+
+// getParseFailure, recordParseFailure and clearParseFailure keep the failure
+// records, replaced in tests.
+var (
+	getParseFailure    = db.GetParseFailure
+	recordParseFailure = db.RecordParseFailure
+	clearParseFailure  = db.ClearParseFailure
+)
+
+// parseTracked parses a file of the watch dir like parseFile and keeps a
+// record of its failures. A file that failed db.MaxParseAttempts times in a
+// row is quarantined and only indexed by name until it is retried. The md5
+// to store with the doc is empty when the parse failed, so the next event
+// of the file parses it again.
+func parseTracked(filepath, md5 string, b []byte, truncated, retry bool) (string, map[string]interface{}, string) {
+	if !retry {
+		failure, err := getParseFailure(filepath)
+		if err != nil {
+			log.Error().Msgf("get parse failure %s error %v", filepath, err)
+		} else if failure != nil && failure.Quarantined && failure.Md5 == md5 {
+			// changed content gets new attempts
+			log.Debug().Msgf("skip parse quarantined %s", filepath)
+			return "", map[string]interface{}{parser.ParseStatusFieldName: parser.ParseQuarantined}, md5
+		}
+	}
+	content, fields, err := parseCached(filepath, md5, b, truncated, retry)
+	if err == nil {
+		if err := clearParseFailure(filepath); err != nil {
+			log.Error().Msgf("clear parse failure %s error %v", filepath, err)
+		}
+		return content, fields, md5
+	}
+	status, _ := fields[parser.ParseStatusFieldName].(string)
+	failure, dbErr := recordParseFailure(filepath, md5, status, err.Error())
+	if dbErr != nil {
+		log.Error().Msgf("record parse failure %s error %v", filepath, dbErr)
+	}
+	if failure != nil && failure.Quarantined {
+		log.Warn().Msgf("parse %s %s error %v, quarantined after %d attempts", filepath, status, err, failure.Attempts)
+		return content, fields, md5
+	}
+	log.Warn().Msgf("parse %s %s error %v", filepath, status, err)
+	return content, fields, ""
+}
+
+// RetryFile parses a file that failed again, lifting its quarantine. The
+// record of a file that no longer exists is dropped.
+func RetryFile(filepath string) error {
+	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+		return db.ClearParseFailure(filepath)
+	}
+	return updateOrInputDoc(filepath, true)
+}
+
+// parseMedia returns the metadata of an image, audio or video file as
+// content and fields, none when it cannot be read.
+func parseMedia(filepath string, b []byte) (string, map[string]interface{}) {
+	media, err := parser.ParseMedia(b, filepath)
+	if err != nil {
+		log.Warn().Msgf("parse media %s error %v", filepath, err)
+		return "", nil
+	}
+	return media.Content(), media.Fields()
 }
 
 func printTime(s string, args ...interface{}) {
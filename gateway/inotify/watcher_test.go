@@ -1,11 +1,16 @@
 package inotify
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/fsnotify/fsnotify"
+
+	"wzinc/common"
+	"wzinc/db"
+	"wzinc/parser"
 )
 
 func TestWatch(t *testing.T) {
@@ -64,3 +69,59 @@ func TestPathTrie(t *testing.T) {
 	fmt.Println(root.deletePath("/data/aa/bb/t3.txt"))
 	fmt.Println(root.getLeafs())
 }
+
+func TestParseTrackedQuarantine(t *testing.T) {
+	failures := map[string]*db.ParseFailure{}
+	defer func() {
+		getParseFailure, recordParseFailure, clearParseFailure = db.GetParseFailure, db.RecordParseFailure, db.ClearParseFailure
+	}()
+	getParseFailure = func(path string) (*db.ParseFailure, error) {
+		return failures[path], nil
+	}
+	recordParseFailure = func(path, md5, status, errMsg string) (*db.ParseFailure, error) {
+		failure := failures[path]
+		if failure == nil || failure.Md5 != md5 {
+			failure = &db.ParseFailure{Path: path, Md5: md5}
+			failures[path] = failure
+		}
+		failure.Attempts++
+		failure.Quarantined = failure.Attempts >= db.MaxParseAttempts
+		return failure, nil
+	}
+	clearParseFailure = func(path string) error {
+		delete(failures, path)
+		return nil
+	}
+
+	// write events of a file that never parses, the stored md5 decides
+	// whether it is parsed again like in updateOrInputDoc
+	b := []byte("not a zip")
+	md5 := common.Md5File(bytes.NewReader(b))
+	stored := ""
+	parses := 0
+	for i := 0; i < db.MaxParseAttempts+2; i++ {
+		if stored == md5 {
+			continue
+		}
+		var fields map[string]interface{}
+		_, fields, stored = parseTracked("/data/broken.docx", md5, b, false, false)
+		parses++
+		if fields[parser.ParseStatusFieldName] == parser.ParseOK {
+			t.Fatalf("expected a failed parse, got %v", fields)
+		}
+	}
+	if parses != db.MaxParseAttempts {
+		t.Fatalf("expected %d parses before the quarantine, got %d", db.MaxParseAttempts, parses)
+	}
+	if failure := failures["/data/broken.docx"]; failure == nil || !failure.Quarantined {
+		t.Fatalf("expected a quarantined failure, got %+v", failure)
+	}
+
+	// changed content is parsed again
+	if _, _, stored = parseTracked("/data/broken.docx", "changed", b, false, false); stored != "" {
+		t.Fatalf("expected no md5 stored for a failed parse, got %q", stored)
+	}
+	if failures["/data/broken.docx"].Attempts != 1 {
+		t.Fatalf("expected attempts of the changed content to restart, got %d", failures["/data/broken.docx"].Attempts)
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 
 	"syscall"
+	"time"
 
 	"wzinc/db"
 	"wzinc/inotify"
+	"wzinc/parser"
 	"wzinc/rpc"
 
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
@@ -79,14 +83,56 @@ func Start(ctx *cli.Context) {
 	}
 	indexerUrl := os.Getenv("INDEXER_MODEL_URI")
 	inotify.IndexerUrl = indexerUrl
+	parseBackend := os.Getenv("PARSE_BACKEND")
+	switch parseBackend {
+	case "":
+	case parser.BackendDocconv, parser.BackendNative:
+		parser.Backend = parseBackend
+	default:
+		log.Fatal().Msgf("invalid PARSE_BACKEND %s, want %s or %s", parseBackend, parser.BackendDocconv, parser.BackendNative)
+	}
+	setIntFromEnv("ARCHIVE_MAX_DEPTH", &parser.DefaultArchiveLimits.MaxDepth)
+	setIntFromEnv("ARCHIVE_MAX_ENTRIES", &parser.DefaultArchiveLimits.MaxEntries)
+	setInt64FromEnv("ARCHIVE_MAX_SIZE", &parser.DefaultArchiveLimits.MaxSize)
+	setInt64FromEnv("PARSE_MAX_BYTES", &parser.DefaultParseLimits.MaxBytes)
+	parser.DefaultArchiveLimits.MaxBytes = parser.DefaultParseLimits.MaxBytes
+	setIntFromEnv("PARSE_MAX_TEXT", &parser.DefaultParseLimits.MaxText)
+	setDurationFromEnv("PARSE_TIMEOUT", &parser.DefaultParseLimits.Timeout)
+	setIntFromEnv("PARSE_CONCURRENCY", &parser.ParseConcurrency)
+	setIntFromEnv("PARSE_MAX_ABANDONED", &parser.MaxAbandonedParses)
+	setIntFromEnv("PARSE_MAX_ATTEMPTS", &db.MaxParseAttempts)
+	if analyzer := os.Getenv("CONTENT_ZH_ANALYZER"); analyzer != "" {
+		rpc.ChineseAnalyzer = analyzer
+	}
+	// set empty, the index analyzer also analyzes queries
+	if analyzer, ok := os.LookupEnv("CONTENT_ZH_SEARCH_ANALYZER"); ok {
+		rpc.ChineseSearchAnalyzer = analyzer
+	}
+	setIntFromEnv("PASSAGE_SIZE", &parser.DefaultPassageSize)
+	setIntFromEnv("PASSAGE_OVERLAP", &parser.DefaultPassageOverlap)
+	setInt64FromEnv("PARSE_CACHE_SIZE", &parser.DefaultParseCacheSize)
+	parseCachePath := os.Getenv("PARSE_CACHE_PATH")
+	if parseCachePath == "" {
+		parseCachePath = "parse_cache.db"
+	}
+	if parser.DefaultParseCacheSize > 0 {
+		cache, err := parser.OpenParseCache(parseCachePath, parser.DefaultParseCacheSize)
+		if err != nil {
+			log.Error().Msgf("open parse cache %s error %v", parseCachePath, err)
+		} else {
+			parser.DefaultParseCache = cache
+		}
+	}
 
 	db.Init()
 
+	rpc.WatchRoot = watchDir
 	rpc.InitRpcService(url, port, username, password, map[string]string{
 		rpc.ChatModelName: chatModelUri,
 		rpc.FileModelName: fileModelUri,
 	})
 
+	rpc.RetryParse = inotify.RetryFile
 	inotify.WatchPath(watchDir)
 	go inotify.VectorCli.Run()
 	contx := context.Background()
@@ -97,6 +143,48 @@ func Start(ctx *cli.Context) {
 	waitToExit()
 }
 
+// setIntFromEnv overrides value when the environment variable is set to an integer.
+func setIntFromEnv(key string, value *int) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Warn().Msgf("ignore invalid %s %s", key, v)
+		return
+	}
+	*value = n
+}
+
+func setInt64FromEnv(key string, value *int64) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Warn().Msgf("ignore invalid %s %s", key, v)
+		return
+	}
+	*value = n
+}
+
+// setDurationFromEnv overrides value when the environment variable is set to
+// a duration like "90s".
+func setDurationFromEnv(key string, value *time.Duration) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Warn().Msgf("ignore invalid %s %s", key, v)
+		return
+	}
+	*value = d
+}
+
 func main() {
 	if err := app.Run(os.Args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
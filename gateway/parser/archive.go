@@ -0,0 +1,334 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// ArchiveSeparator separates an archive from the path of an entry inside it
+// in virtual paths, e.g. /data/a.zip!/docs/spec.pdf.
+const ArchiveSeparator = "!/"
+
+// ArchiveFieldName holds the path of the archive file on disk on the
+// documents of archive entries.
+const ArchiveFieldName = "archive"
+
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archive7z    = "7z"
+	archiveMbox  = "mbox"
+)
+
+var (
+	ErrArchive      = errors.New("invalid archive")
+	ErrArchiveLimit = errors.New("archive limit exceeded")
+)
+
+var (
+	gzipSignature     = []byte{0x1F, 0x8B}
+	sevenZipSignature = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+	tarSignature      = []byte("ustar")
+	mboxSignature     = []byte("From ")
+)
+
+// ArchiveLimits bound the expansion of an archive against zip bombs.
+type ArchiveLimits struct {
+	// MaxDepth is how deep archives nest, 1 only expands the outer archive.
+	MaxDepth int
+	// MaxEntries is the number of files over all nesting levels.
+	MaxEntries int
+	// MaxSize is the number of expanded bytes over all nesting levels.
+	MaxSize int64
+	// MaxBytes is how much of each file is read, the rest is left out.
+	MaxBytes int64
+}
+
+// DefaultArchiveLimits are used by the watcher, set from ARCHIVE_MAX_DEPTH,
+// ARCHIVE_MAX_ENTRIES and ARCHIVE_MAX_SIZE. MaxBytes follows PARSE_MAX_BYTES.
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxDepth:   3,
+	MaxEntries: 10000,
+	MaxSize:    1 << 30,
+	MaxBytes:   256 << 20,
+}
+
+// ArchiveEntryFunc receives every file of an archive with its virtual path.
+// truncated tells that data is only the head of a file longer than
+// ArchiveLimits.MaxBytes.
+type ArchiveEntryFunc func(virtualPath string, data []byte, truncated bool) error
+
+// archiveFileFunc receives a file inside one archive. open is only valid
+// during the call.
+type archiveFileFunc func(name string, open func() (io.Reader, error)) error
+
+func init() {
+	Register(ParserFunc(parseArchive), []string{".zip", ".tar", ".tgz", ".7z", ".mbox"}, nil)
+	Register(gzipParser{}, []string{".gz"}, nil)
+}
+
+// gzipParser lists .tar.gz archives and parses a plain gzip file as the
+// single file it holds, named like it without .gz.
+type gzipParser struct{}
+
+func (p gzipParser) Parse(f io.Reader, filename string) (string, error) {
+	doc, _, err := p.ParseContext(context.Background(), f, filename)
+	if err != nil {
+		return "", err
+	}
+	return doc.Content(), nil
+}
+
+func (gzipParser) ParseContext(ctx context.Context, f io.Reader, filename string) (*Document, map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if archiveKind(filename, data) == archiveTarGz {
+		content, err := listArchive(data, filename, archiveTarGz)
+		if err != nil {
+			return nil, nil, err
+		}
+		return DocumentFromContent(content), nil, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+	inner, _, err := ReadLimited(ctx, gz, DefaultParseLimits.MaxBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := path.Base(filename)
+	return parseData(ctx, inner, name[:len(name)-len(path.Ext(name))])
+}
+
+// parseArchive lists the files of an archive, one path per line, so the
+// archive itself is found by the names of its entries.
+func parseArchive(f io.Reader, filename string) (string, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	kind := archiveKind(filename, data)
+	if kind == "" {
+		return "", ErrArchive
+	}
+	return listArchive(data, filename, kind)
+}
+
+func listArchive(data []byte, filename, kind string) (string, error) {
+	names := make([]string, 0)
+	err := eachArchiveFile(data, filename, kind, func(name string, open func() (io.Reader, error)) error {
+		if len(names) >= DefaultArchiveLimits.MaxEntries {
+			return ErrArchiveLimit
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil && err != ErrArchiveLimit {
+		return "", err
+	}
+	return strings.Join(names, "\n"), nil
+}
+
+// IsArchive reports whether the file is an archive whose entries can be expanded.
+func IsArchive(filename string, data []byte) bool {
+	return archiveKind(filename, data) != ""
+}
+
+// ArchiveRoot returns the file on disk of a virtual path, which is the path
+// itself for files outside archives.
+func ArchiveRoot(virtualPath string) string {
+	if i := strings.Index(virtualPath, ArchiveSeparator); i >= 0 {
+		return virtualPath[:i]
+	}
+	return virtualPath
+}
+
+// WalkArchive calls fn for every file in the archive at archivePath, and for
+// the files of archives nested in it up to limits.MaxDepth. It stops with
+// ErrArchiveLimit once limits are exceeded, after the files within them were
+// passed to fn.
+func WalkArchive(data []byte, archivePath string, limits ArchiveLimits, fn ArchiveEntryFunc) error {
+	kind := archiveKind(archivePath, data)
+	if kind == "" {
+		return ErrArchive
+	}
+	w := &archiveWalker{limits: limits, fn: fn}
+	return w.walk(data, archivePath, kind, 1)
+}
+
+type archiveWalker struct {
+	limits  ArchiveLimits
+	fn      ArchiveEntryFunc
+	entries int
+	size    int64
+}
+
+func (w *archiveWalker) walk(data []byte, archivePath, kind string, depth int) error {
+	return eachArchiveFile(data, archivePath, kind, func(name string, open func() (io.Reader, error)) error {
+		w.entries++
+		if w.entries > w.limits.MaxEntries {
+			return ErrArchiveLimit
+		}
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		// the sizes in archive headers can lie, so only trust what is read,
+		// and only what is read counts against MaxSize
+		remaining := w.limits.MaxSize - w.size
+		max := w.limits.MaxBytes
+		if remaining < max {
+			max = remaining
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+		if err != nil {
+			return fmt.Errorf("read %s%s%s: %w", archivePath, ArchiveSeparator, name, err)
+		}
+		if int64(len(b)) > remaining {
+			return ErrArchiveLimit
+		}
+		truncated := int64(len(b)) > w.limits.MaxBytes
+		if truncated {
+			b = b[:w.limits.MaxBytes]
+		}
+		w.size += int64(len(b))
+
+		virtualPath := archivePath + ArchiveSeparator + name
+		if err := w.fn(virtualPath, b, truncated); err != nil {
+			return err
+		}
+		if nested := archiveKind(name, b); nested != "" && !truncated && depth < w.limits.MaxDepth {
+			return w.walk(b, virtualPath, nested, depth+1)
+		}
+		return nil
+	})
+}
+
+// archiveKind tells the archive format from the file extension, confirmed
+// by the signature of data so misnamed files are left alone.
+func archiveKind(filename string, data []byte) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		if bytes.HasPrefix(data, gzipSignature) {
+			return archiveTarGz
+		}
+	case strings.HasSuffix(name, ".zip"):
+		if bytes.HasPrefix(data, zipSignature) {
+			return archiveZip
+		}
+	case strings.HasSuffix(name, ".tar"):
+		if len(data) > 262 && bytes.HasPrefix(data[257:], tarSignature) {
+			return archiveTar
+		}
+	case strings.HasSuffix(name, ".7z"):
+		if bytes.HasPrefix(data, sevenZipSignature) {
+			return archive7z
+		}
+	case strings.HasSuffix(name, ".mbox"):
+		if bytes.HasPrefix(data, mboxSignature) {
+			return archiveMbox
+		}
+	}
+	return ""
+}
+
+// eachArchiveFile calls fn for the regular files of one archive, skipping
+// directories and links.
+func eachArchiveFile(data []byte, archivePath, kind string, fn archiveFileFunc) error {
+	switch kind {
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			if err := callArchiveFile(fn, f.Name, func() (io.ReadCloser, error) { return f.Open() }); err != nil {
+				return err
+			}
+		}
+		return nil
+	case archive7z:
+		zr, err := sevenzip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			if err := callArchiveFile(fn, f.Name, func() (io.ReadCloser, error) { return f.Open() }); err != nil {
+				return err
+			}
+		}
+		return nil
+	case archiveTar:
+		return eachTarFile(bytes.NewReader(data), fn)
+	case archiveMbox:
+		return eachMboxMessage(data, fn)
+	case archiveTarGz:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return eachTarFile(gz, fn)
+	}
+	return ErrArchive
+}
+
+func eachTarFile(r io.Reader, fn archiveFileFunc) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := fn(cleanEntryName(hdr.Name), func() (io.Reader, error) { return tr, nil }); err != nil {
+			return err
+		}
+	}
+}
+
+func callArchiveFile(fn archiveFileFunc, name string, open func() (io.ReadCloser, error)) error {
+	var rc io.ReadCloser
+	err := fn(cleanEntryName(name), func() (io.Reader, error) {
+		var err error
+		rc, err = open()
+		return rc, err
+	})
+	if rc != nil {
+		rc.Close()
+	}
+	return err
+}
+
+// cleanEntryName keeps entries inside their archive, "../x" becomes "x".
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func tarGzOf(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedKeys(files) {
+		body := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestWalkArchive(t *testing.T) {
+	inner := tarGzOf(t, map[string]string{"notes/b.txt": "inner text", "../escape.txt": "kept inside"})
+	outer := zipOf(t, map[string]string{"docs/a.txt": "outer text", "inner.tar.gz": string(inner)})
+
+	walk := func(limits ArchiveLimits) (map[string]string, error) {
+		got := make(map[string]string)
+		err := WalkArchive(outer, "/data/a.zip", limits, func(virtualPath string, data []byte, truncated bool) error {
+			got[virtualPath] = string(data)
+			return nil
+		})
+		return got, err
+	}
+
+	got, err := walk(DefaultArchiveLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/data/a.zip!/docs/a.txt",
+		"/data/a.zip!/inner.tar.gz",
+		"/data/a.zip!/inner.tar.gz!/escape.txt",
+		"/data/a.zip!/inner.tar.gz!/notes/b.txt",
+	}
+	if gotKeys := sortedKeys(got); !reflect.DeepEqual(gotKeys, want) {
+		t.Fatalf("got paths %q", gotKeys)
+	}
+	if ArchiveRoot(want[3]) != "/data/a.zip" {
+		t.Fatalf("got root %s", ArchiveRoot(want[3]))
+	}
+
+	got, err = walk(ArchiveLimits{MaxDepth: 1, MaxEntries: 10, MaxSize: 1 << 20, MaxBytes: 1 << 20})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("depth 1 got %v %v", got, err)
+	}
+	if _, err = walk(ArchiveLimits{MaxDepth: 3, MaxEntries: 3, MaxSize: 1 << 20, MaxBytes: 1 << 20}); err != ErrArchiveLimit {
+		t.Fatalf("expected entry limit, got %v", err)
+	}
+	if _, err = walk(ArchiveLimits{MaxDepth: 3, MaxEntries: 10, MaxSize: 20, MaxBytes: 1 << 20}); err != ErrArchiveLimit {
+		t.Fatalf("expected size limit, got %v", err)
+	}
+}
+
+func TestWalkArchiveTruncates(t *testing.T) {
+	// 64 MiB of zeros compress to a few KiB
+	data := zipOf(t, map[string]string{
+		"big.txt":   strings.Repeat("\x00", 64<<20),
+		"small.txt": "small text",
+	})
+	limits := ArchiveLimits{MaxDepth: 1, MaxEntries: 10, MaxSize: 4 << 10, MaxBytes: 1 << 10}
+	got := make(map[string]int)
+	truncated := make(map[string]bool)
+	err := WalkArchive(data, "/data/a.zip", limits, func(virtualPath string, data []byte, cut bool) error {
+		got[virtualPath], truncated[virtualPath] = len(data), cut
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["/data/a.zip!/big.txt"] != 1<<10 || !truncated["/data/a.zip!/big.txt"] {
+		t.Fatalf("expected big.txt cut to 1 KiB, got %d bytes truncated %v", got["/data/a.zip!/big.txt"], truncated["/data/a.zip!/big.txt"])
+	}
+	if got["/data/a.zip!/small.txt"] != len("small text") || truncated["/data/a.zip!/small.txt"] {
+		t.Fatalf("unexpected small.txt %d bytes truncated %v", got["/data/a.zip!/small.txt"], truncated["/data/a.zip!/small.txt"])
+	}
+}
+
+func TestParseArchive(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("plain"))
+	gz.Close()
+	if IsArchive("report.docx", zipOf(t, map[string]string{"word/document.xml": ""})) {
+		t.Fatal("docx is not an archive")
+	}
+	// a plain gzip file is not an archive but the file it holds
+	if IsArchive("/data/report.txt.gz", buf.Bytes()) {
+		t.Fatal("plain gzip is not an archive")
+	}
+	content, err := ParseDoc(bytes.NewReader(buf.Bytes()), "/data/report.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "plain" {
+		t.Fatalf("unexpected content %q", content)
+	}
+	content, err = ParseDoc(bytes.NewReader(tarGzOf(t, map[string]string{"a.md": ""})), "x.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "a.md" {
+		t.Fatalf("unexpected listing %q", content)
+	}
+	content, err = ParseDoc(bytes.NewReader(tarGzOf(t, map[string]string{"a.md": "", "b/c.pdf": ""})), "x.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != strings.Join([]string{"a.md", "b/c.pdf"}, "\n") {
+		t.Fatalf("unexpected listing %q", content)
+	}
+}
@@ -0,0 +1,262 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	cacheEntryBucket = []byte("entries")
+	cacheLruBucket   = []byte("lru")
+	cacheMetaBucket  = []byte("meta")
+	cacheSizeKey     = []byte("size")
+)
+
+// parseCacheVersion is part of every key, raised when parsers change what
+// they return so results of older versions are no longer used.
+const parseCacheVersion = 1
+
+// DefaultParseCacheSize bounds the cached content and fields in bytes, set
+// from PARSE_CACHE_SIZE. The file on disk does not shrink after evictions,
+// its free pages are reused.
+var DefaultParseCacheSize int64 = 1 << 30
+
+// DefaultParseCache is used by the watcher, nil when disabled.
+var DefaultParseCache *ParseCache
+
+// ParseCache keeps parse results on disk by content md5, so identical
+// content is parsed once across paths and restarts. The least recently used
+// results are evicted beyond maxSize. A nil cache misses every lookup.
+type ParseCache struct {
+	db      *bolt.DB
+	maxSize int64
+	hits    uint64
+	misses  uint64
+
+	// lookups only read, the times of use of hits are written with the
+	// next Put
+	mu   sync.Mutex
+	used map[string]int64
+}
+
+type cacheEntry struct {
+	Content string                 `json:"content"`
+	Fields  map[string]interface{} `json:"fields"`
+	Used    int64                  `json:"used"`
+}
+
+func OpenParseCache(file string, maxSize int64) (*ParseCache, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{cacheEntryBucket, cacheLruBucket, cacheMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &ParseCache{db: db, maxSize: maxSize, used: make(map[string]int64)}, nil
+}
+
+func (c *ParseCache) Close() error {
+	if c == nil {
+		return nil
+	}
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return c.writeUsed(tx)
+	})
+	if err != nil {
+		log.Error().Msgf("parse cache write times of use error %v", err)
+	}
+	return c.db.Close()
+}
+
+// Stats returns the lookups that hit and missed since the cache was opened.
+func (c *ParseCache) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
+
+// Get returns the content and fields parsed before from content with md5
+// under the type of filename.
+func (c *ParseCache) Get(md5, filename string) (string, map[string]interface{}, bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	key := parseCacheKey(md5, filename)
+	var entry *cacheEntry
+	err := c.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(cacheEntryBucket).Get(key)
+		if value == nil {
+			return nil
+		}
+		entry = new(cacheEntry)
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		// keep integer fields such as dates exact
+		decoder.UseNumber()
+		return decoder.Decode(entry)
+	})
+	if err != nil {
+		log.Error().Msgf("parse cache get %s error %v", filename, err)
+		entry = nil
+	}
+	if entry == nil {
+		misses := atomic.AddUint64(&c.misses, 1)
+		log.Debug().Msgf("parse cache miss %s %s, hits %d misses %d", md5, filename, atomic.LoadUint64(&c.hits), misses)
+		return "", nil, false
+	}
+	c.mu.Lock()
+	c.used[string(key)] = time.Now().UnixNano()
+	c.mu.Unlock()
+	hits := atomic.AddUint64(&c.hits, 1)
+	log.Debug().Msgf("parse cache hit %s %s, hits %d misses %d", md5, filename, hits, atomic.LoadUint64(&c.misses))
+	return entry.Content, entry.Fields, true
+}
+
+// Put stores the result of parsing content with md5 as filename, evicting
+// the least recently used results to stay within the size of the cache.
+func (c *ParseCache) Put(md5, filename, content string, fields map[string]interface{}) error {
+	if c == nil {
+		return nil
+	}
+	key := parseCacheKey(md5, filename)
+	entry := cacheEntry{Content: content, Fields: fields, Used: time.Now().UnixNano()}
+	value, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	if int64(len(key)+len(value)) > c.maxSize {
+		return nil
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		entries, lru, meta := tx.Bucket(cacheEntryBucket), tx.Bucket(cacheLruBucket), tx.Bucket(cacheMetaBucket)
+		size := int64(0)
+		if b := meta.Get(cacheSizeKey); len(b) == 8 {
+			size = int64(binary.BigEndian.Uint64(b))
+		}
+		// entries looked up since the last Put are not the least recently used
+		if err := c.writeUsed(tx); err != nil {
+			return err
+		}
+		if err := c.remove(entries, lru, key, &size); err != nil {
+			return err
+		}
+		cursor := lru.Cursor()
+		for k, _ := cursor.First(); k != nil && size+int64(len(key)+len(value)) > c.maxSize; k, _ = cursor.First() {
+			// k points into the page being changed, copy it first
+			k = append([]byte(nil), k...)
+			if err := lru.Delete(k); err != nil {
+				return err
+			}
+			if len(k) > 8 {
+				if err := c.remove(entries, lru, k[8:], &size); err != nil {
+					return err
+				}
+				log.Debug().Msgf("parse cache evict %s", k[8:])
+			}
+		}
+		if err := entries.Put(key, value); err != nil {
+			return err
+		}
+		if err := lru.Put(lruKey(entry.Used, key), nil); err != nil {
+			return err
+		}
+		size += int64(len(key) + len(value))
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(size))
+		return meta.Put(cacheSizeKey, b)
+	})
+}
+
+// writeUsed moves the entries looked up since the last write to their time
+// of use in the lru order. The size of an entry does not change, its time
+// of use always has the same number of digits.
+func (c *ParseCache) writeUsed(tx *bolt.Tx) error {
+	c.mu.Lock()
+	used := c.used
+	c.used = make(map[string]int64)
+	c.mu.Unlock()
+	entries, lru := tx.Bucket(cacheEntryBucket), tx.Bucket(cacheLruBucket)
+	for k, t := range used {
+		key := []byte(k)
+		value := entries.Get(key)
+		if value == nil {
+			continue
+		}
+		var entry cacheEntry
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			continue
+		}
+		if err := lru.Delete(lruKey(entry.Used, key)); err != nil {
+			return err
+		}
+		entry.Used = t
+		value, err := json.Marshal(&entry)
+		if err != nil {
+			return err
+		}
+		if err := entries.Put(key, value); err != nil {
+			return err
+		}
+		if err := lru.Put(lruKey(entry.Used, key), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove drops the entry at key if any and subtracts it from size.
+func (c *ParseCache) remove(entries, lru *bolt.Bucket, key []byte, size *int64) error {
+	value := entries.Get(key)
+	if value == nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(value, &entry); err == nil {
+		if err := lru.Delete(lruKey(entry.Used, key)); err != nil {
+			return err
+		}
+	}
+	*size -= int64(len(key) + len(value))
+	return entries.Delete(key)
+}
+
+// parseCacheKey is the md5 of the content with the extension choosing its
+// parser, the backend and limits parsing it and the cache version. Markdown
+// also keys on the directory its relative links resolve in.
+func parseCacheKey(md5, filename string) []byte {
+	ext := strings.ToLower(path.Ext(filename))
+	key := fmt.Sprintf("%s%s\x00v%d\x00%s\x00%d\x00%d", md5, ext, parseCacheVersion, Backend, DefaultParseLimits.MaxBytes, DefaultParseLimits.MaxText)
+	if ext == ".md" || ext == ".markdown" {
+		key += "\x00" + path.Dir(filename)
+	}
+	return []byte(key)
+}
+
+// lruKey orders entries by last use.
+func lruKey(used int64, key []byte) []byte {
+	b := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint64(b, uint64(used))
+	return append(b, key...)
+}
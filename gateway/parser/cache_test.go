@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.db")
+	cache, err := OpenParseCache(file, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := cache.Get("aaa", "/data/a.txt"); ok {
+		t.Fatal("expected miss")
+	}
+	fields := map[string]interface{}{ParseStatusFieldName: ParseOK, DateFieldName: int64(1700000000)}
+	if err := cache.Put("aaa", "/data/a.txt", "hello", fields); err != nil {
+		t.Fatal(err)
+	}
+	// identical content under another path and a restart still hits
+	cache.Close()
+	if cache, err = OpenParseCache(file, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	content, cached, ok := cache.Get("aaa", "/data/copy/b.TXT")
+	if !ok || content != "hello" || cached[ParseStatusFieldName] != ParseOK || cached[DateFieldName] != json.Number("1700000000") {
+		t.Fatalf("got %q %v %v", content, cached, ok)
+	}
+	if _, _, ok := cache.Get("aaa", "/data/a.pdf"); ok {
+		t.Fatal("expected miss for another parser")
+	}
+	if _, _, ok := cache.Get("aaa", "/data/a.md"); ok {
+		t.Fatal("expected miss for markdown")
+	}
+	// results of another backend or other limits are not reused
+	backend := Backend
+	Backend = "other"
+	_, _, ok = cache.Get("aaa", "/data/a.txt")
+	Backend = backend
+	limits := DefaultParseLimits
+	DefaultParseLimits.MaxText = 10
+	_, _, okLimits := cache.Get("aaa", "/data/a.txt")
+	DefaultParseLimits = limits
+	if ok || okLimits {
+		t.Fatal("expected miss for another backend and limits")
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 4 {
+		t.Fatalf("got hits %d misses %d", hits, misses)
+	}
+	cache.Close()
+
+	// a cache holding about two entries evicts the least recently used
+	if cache, err = OpenParseCache(filepath.Join(t.TempDir(), "small.db"), 2500); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	text := strings.Repeat("x", 1000)
+	cache.Put("1", "a.txt", text, nil)
+	cache.Put("2", "a.txt", text, nil)
+	cache.Get("1", "a.txt")
+	cache.Put("3", "a.txt", text, nil)
+	for md5, want := range map[string]bool{"1": true, "2": false, "3": true} {
+		if _, _, ok := cache.Get(md5, "a.txt"); ok != want {
+			t.Fatalf("entry %s cached %v", md5, ok)
+		}
+	}
+	if err := cache.Put("4", "a.txt", strings.Repeat("x", 3000), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := cache.Get("4", "a.txt"); ok {
+		t.Fatal("entry larger than the cache stored")
+	}
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const CharsetFieldName = "charset"
+
+const (
+	CharsetUTF8    = "UTF-8"
+	CharsetUTF16LE = "UTF-16LE"
+	CharsetUTF16BE = "UTF-16BE"
+	CharsetGB18030 = "GB18030"
+	CharsetBig5    = "Big5"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// charsetSample is how much of a file is looked at to guess its charset.
+const charsetSample = 64 * 1024
+
+// commonHan are the most frequent Chinese characters in simplified and
+// traditional forms. Text decoded with the right charset is full of them.
+const commonHan = "的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实" +
+	"這個們來為國說時會對於著過發後裡種經麼學現當沒動還進樣開從實"
+
+var charsetEncodings = map[string]encoding.Encoding{
+	CharsetUTF16LE: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	CharsetUTF16BE: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	CharsetGB18030: simplifiedchinese.GB18030,
+	CharsetBig5:    traditionalchinese.Big5,
+}
+
+// DetectCharset guesses the charset of text data: a byte order mark wins,
+// then valid UTF-8, then UTF-16 without a mark, and for the rest whichever
+// of GB18030 and Big5 decodes to more common Chinese characters.
+func DetectCharset(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return CharsetUTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return CharsetUTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return CharsetUTF16BE
+	}
+	sample := data
+	if len(sample) > charsetSample {
+		sample = sample[:charsetSample]
+	}
+	if validUTF8Prefix(sample, len(sample) < len(data)) {
+		if charset := detectUTF16(sample); charset != "" {
+			return charset
+		}
+		return CharsetUTF8
+	}
+	if charset := detectUTF16(sample); charset != "" {
+		return charset
+	}
+	if hanScore(sample, CharsetBig5) > hanScore(sample, CharsetGB18030) {
+		return CharsetBig5
+	}
+	return CharsetGB18030
+}
+
+// DecodeText converts text data to UTF-8 and returns it with the detected
+// charset. A byte order mark is dropped.
+func DecodeText(data []byte) (string, string, error) {
+	charset := DetectCharset(data)
+	data = bytes.TrimPrefix(data, bomUTF8)
+	if charset == CharsetUTF8 {
+		return string(data), charset, nil
+	}
+	if charset == CharsetUTF16LE {
+		data = bytes.TrimPrefix(data, bomUTF16LE)
+	} else if charset == CharsetUTF16BE {
+		data = bytes.TrimPrefix(data, bomUTF16BE)
+	}
+	decoded, err := charsetEncodings[charset].NewDecoder().Bytes(data)
+	if err != nil {
+		return "", charset, err
+	}
+	return string(decoded), charset, nil
+}
+
+// validUTF8Prefix is utf8.Valid allowing a rune cut off at the end of a sample.
+func validUTF8Prefix(data []byte, truncated bool) bool {
+	if utf8.Valid(data) {
+		return true
+	}
+	if !truncated {
+		return false
+	}
+	for i := 1; i < utf8.UTFMax && i < len(data); i++ {
+		if utf8.Valid(data[:len(data)-i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectUTF16 recognizes UTF-16 without a byte order mark by the zero high
+// bytes of its ASCII characters, on the odd bytes for little endian.
+func detectUTF16(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	even, odd := 0, 0
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(data) / 2
+	switch {
+	case odd*10 > pairs*4 && even*10 < pairs:
+		return CharsetUTF16LE
+	case even*10 > pairs*4 && odd*10 < pairs:
+		return CharsetUTF16BE
+	}
+	return ""
+}
+
+// hanScore decodes data with charset and counts the common Chinese
+// characters, less the characters that failed to decode.
+func hanScore(data []byte, charset string) int {
+	decoded, err := charsetEncodings[charset].NewDecoder().Bytes(data)
+	if err != nil {
+		return 0
+	}
+	score := 0
+	for _, r := range string(decoded) {
+		if r == utf8.RuneError {
+			score -= 2
+		} else if r > utf8.RuneSelf && strings.ContainsRune(commonHan, r) {
+			score++
+		}
+	}
+	return score
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDecodeText(t *testing.T) {
+	const simplified = "这是一个测试文件，我们在中国使用它来检查编码。"
+	const traditional = "這是一個測試文件，我們在臺灣使用它來檢查編碼。"
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(simplified))
+	big5, _ := traditionalchinese.Big5.NewEncoder().Bytes([]byte(traditional))
+	utf16le, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte(simplified))
+	utf16be, _ := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte("plain ascii text"))
+
+	cases := []struct {
+		data    []byte
+		text    string
+		charset string
+	}{
+		{[]byte(simplified), simplified, CharsetUTF8},
+		{append([]byte{0xEF, 0xBB, 0xBF}, simplified...), simplified, CharsetUTF8},
+		{gbk, simplified, CharsetGB18030},
+		{big5, traditional, CharsetBig5},
+		{utf16le, simplified, CharsetUTF16LE},
+		{utf16be, "plain ascii text", CharsetUTF16BE},
+	}
+	for _, c := range cases {
+		text, charset, err := DecodeText(c.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != c.text || charset != c.charset {
+			t.Errorf("got %q as %s, want %q as %s", text, charset, c.text, c.charset)
+		}
+	}
+}
+
+func TestParseTextCharset(t *testing.T) {
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("你好，世界，我们的文件"))
+	content, fields, err := ParseDocFields(bytes.NewReader(gbk), "hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "你好，世界，我们的文件" || fields[CharsetFieldName] != CharsetGB18030 {
+		t.Fatalf("got %q with fields %v", content, fields)
+	}
+}
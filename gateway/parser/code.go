@@ -0,0 +1,259 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MimeScript is sniffed from the "#!" line of scripts without an extension.
+const MimeScript = "text/x-script"
+
+const (
+	CodeLanguageFieldName = "code_language"
+	SymbolsFieldName      = "symbols"
+)
+
+// codeLanguage describes how to find the top-level symbols of a language.
+// Every pattern captures the symbol name in its first group and is matched
+// against single lines.
+type codeLanguage struct {
+	name     string
+	symbols  []*regexp.Regexp
+	comments []string
+	// declarations tells function definitions from prototypes in C like
+	// languages, which end in ";"
+	declarations bool
+	// nested languages declare their types indented inside a namespace
+	nested bool
+}
+
+var (
+	goLanguage = &codeLanguage{name: "go", comments: []string{"//"}, symbols: patterns(
+		`^func\s+(?:\([^)]*\)\s*)?(\w+)`,
+		`^type\s+(\w+)`,
+		`^(?:var|const)\s+(\w+)`,
+	)}
+	pythonLanguage = &codeLanguage{name: "python", comments: []string{"#"}, symbols: patterns(
+		`^(?:async\s+)?def\s+(\w+)`,
+		`^class\s+(\w+)`,
+	)}
+	javascriptSymbols = patterns(
+		`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`,
+		`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`,
+		`^(?:export\s+)?(?:declare\s+)?(?:interface|type|enum)\s+(\w+)`,
+		`^(?:export\s+)?(?:const|let|var)\s+(\w+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function|\([^)]*\)\s*(?::[^=]+)?=>|\w+\s*=>)`,
+	)
+	javascriptLanguage = &codeLanguage{name: "javascript", comments: []string{"//"}, symbols: javascriptSymbols}
+	typescriptLanguage = &codeLanguage{name: "typescript", comments: []string{"//"}, symbols: javascriptSymbols}
+	javaLanguage       = &codeLanguage{name: "java", comments: []string{"//"}, symbols: patterns(
+		`^(?:(?:public|protected|private|abstract|final|static|sealed)\s+)*(?:class|interface|enum|record|@interface)\s+(\w+)`,
+	)}
+	kotlinLanguage = &codeLanguage{name: "kotlin", comments: []string{"//"}, symbols: patterns(
+		`^(?:(?:public|internal|private|abstract|open|sealed|data|enum|inline|suspend)\s+)*(?:class|interface|object|fun|typealias)\s+(?:<[^>]*>\s*)?(?:\w+\.)?(\w+)`,
+	)}
+	csharpLanguage = &codeLanguage{name: "csharp", comments: []string{"//"}, nested: true, symbols: patterns(
+		`^\s*(?:(?:public|internal|protected|private|abstract|sealed|static|partial|readonly)\s+)*(?:class|interface|struct|enum|record)\s+(\w+)`,
+	)}
+	cSymbols = patterns(
+		`^(?:typedef\s+)?(?:struct|union|enum|class)\s+(\w+)\s*(?:[:{]|$)`,
+		`^#define\s+(\w+)`,
+		`^(?:[A-Za-z_][\w:<>,\*&]*\s+)+\**&?\s*([A-Za-z_][\w:~]*)\s*\(`,
+	)
+	cLanguage    = &codeLanguage{name: "c", comments: []string{"//", "/*", "*"}, symbols: cSymbols, declarations: true}
+	cppLanguage  = &codeLanguage{name: "cpp", comments: []string{"//", "/*", "*"}, symbols: cSymbols, declarations: true}
+	rustLanguage = &codeLanguage{name: "rust", comments: []string{"//"}, symbols: patterns(
+		`^(?:pub(?:\([^)]*\))?\s+)?(?:(?:async|const|unsafe|extern\s+"[^"]*")\s+)*fn\s+(\w+)`,
+		`^(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|type|union|mod|static|const)\s+(\w+)`,
+		`^(?:unsafe\s+)?impl(?:<[^>]*>)?\s+(?:[\w:]+(?:<[^>]*>)?\s+for\s+)?([\w:]+)`,
+	)}
+	rubyLanguage = &codeLanguage{name: "ruby", comments: []string{"#"}, symbols: patterns(
+		`^(?:class|module)\s+([\w:]+)`,
+		`^def\s+(?:self\.)?(\w+[?!=]?)`,
+	)}
+	phpLanguage = &codeLanguage{name: "php", comments: []string{"//", "#"}, symbols: patterns(
+		`^(?:(?:abstract|final|readonly)\s+)*(?:class|interface|trait|enum)\s+(\w+)`,
+		`^function\s+&?\s*(\w+)`,
+	)}
+	swiftLanguage = &codeLanguage{name: "swift", comments: []string{"//"}, symbols: patterns(
+		`^(?:(?:public|internal|private|fileprivate|open|final)\s+)*(?:func|class|struct|enum|protocol|extension|actor)\s+(\w+)`,
+	)}
+	shellLanguage = &codeLanguage{name: "shell", comments: []string{"#"}, symbols: patterns(
+		`^(?:function\s+)?([\w\-]+)\s*\(\)`,
+		`^function\s+([\w\-]+)`,
+	)}
+)
+
+var codeExtensions = map[string]*codeLanguage{
+	".go":    goLanguage,
+	".py":    pythonLanguage,
+	".pyw":   pythonLanguage,
+	".js":    javascriptLanguage,
+	".jsx":   javascriptLanguage,
+	".mjs":   javascriptLanguage,
+	".cjs":   javascriptLanguage,
+	".ts":    typescriptLanguage,
+	".tsx":   typescriptLanguage,
+	".java":  javaLanguage,
+	".kt":    kotlinLanguage,
+	".kts":   kotlinLanguage,
+	".cs":    csharpLanguage,
+	".c":     cLanguage,
+	".h":     cLanguage,
+	".cc":    cppLanguage,
+	".cpp":   cppLanguage,
+	".cxx":   cppLanguage,
+	".hpp":   cppLanguage,
+	".hh":    cppLanguage,
+	".rs":    rustLanguage,
+	".rb":    rubyLanguage,
+	".php":   phpLanguage,
+	".swift": swiftLanguage,
+	".sh":    shellLanguage,
+	".bash":  shellLanguage,
+	".zsh":   shellLanguage,
+}
+
+// shebangLanguages maps the interpreter of a "#!" line to its language.
+var shebangLanguages = map[string]*codeLanguage{
+	"python":  pythonLanguage,
+	"python2": pythonLanguage,
+	"python3": pythonLanguage,
+	"node":    javascriptLanguage,
+	"ruby":    rubyLanguage,
+	"php":     phpLanguage,
+	"sh":      shellLanguage,
+	"bash":    shellLanguage,
+	"zsh":     shellLanguage,
+}
+
+func patterns(exprs ...string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		res = append(res, regexp.MustCompile(expr))
+	}
+	return res
+}
+
+func init() {
+	exts := make([]string, 0, len(codeExtensions))
+	for ext := range codeExtensions {
+		exts = append(exts, ext)
+	}
+	Register(DocumentParserFunc(parseCode), exts, []string{MimeScript})
+	RegisterMagic(MimeScript, 0, []byte("#!"))
+}
+
+// parseCode indexes the text of a source file with one section per
+// top-level symbol, so a hit is located in the function or type defining it.
+func parseCode(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	text, charset, err := DecodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Charset: charset}
+	lang := codeLanguageOf(filename, text)
+	if lang == nil {
+		doc.Sections = []Section{{Text: text}}
+		return doc, nil
+	}
+	b := newSectionBuilder(doc, 0)
+	symbols := make([]string, 0)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if symbol := lang.symbol(line); symbol != "" {
+			b.heading(1, symbol)
+			if !seen[symbol] {
+				seen[symbol] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	doc = b.finish()
+	doc.Extra = map[string]interface{}{
+		CodeLanguageFieldName: lang.name,
+	}
+	if len(symbols) > 0 {
+		doc.Extra[SymbolsFieldName] = strings.Join(symbols, "\n")
+	}
+	return doc, nil
+}
+
+// DetectCodeLanguage tells the language of a source file from its extension,
+// or from the interpreter of its "#!" line. It returns "" when unknown.
+func DetectCodeLanguage(filename, text string) string {
+	if lang := codeLanguageOf(filename, text); lang != nil {
+		return lang.name
+	}
+	return ""
+}
+
+func codeLanguageOf(filename, text string) *codeLanguage {
+	if lang, ok := codeExtensions[GetTypeFromName(filename)]; ok {
+		return lang
+	}
+	if !strings.HasPrefix(text, "#!") {
+		return nil
+	}
+	line := text[2:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	interpreter := path.Base(fields[0])
+	// #!/usr/bin/env python3
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = path.Base(fields[len(fields)-1])
+	}
+	return shebangLanguages[interpreter]
+}
+
+// symbol returns the top-level symbol defined on line, or "".
+func (l *codeLanguage) symbol(line string) string {
+	if line == "" || (!l.nested && (line[0] == ' ' || line[0] == '\t')) {
+		return ""
+	}
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range l.comments {
+		if strings.HasPrefix(trimmed, prefix) {
+			return ""
+		}
+	}
+	if l.declarations && strings.HasSuffix(trimmed, ";") {
+		return ""
+	}
+	for _, re := range l.symbols {
+		if m := re.FindStringSubmatch(line); m != nil {
+			if codeKeywords[m[1]] {
+				return ""
+			}
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// codeKeywords are never symbols, they are matched by the loose C function
+// pattern on lines like "else if (x)".
+var codeKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "return": true,
+	"sizeof": true, "else": true, "do": true, "case": true,
+}
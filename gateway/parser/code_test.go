@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseCode(t *testing.T) {
+	cases := []struct {
+		filename string
+		source   string
+		language string
+		symbols  []string
+	}{
+		{"handler.go", "package rpc\n\n// Resp is a reply\ntype Resp struct {\n\tCode int\n}\n\nfunc (s *Service) HandleFileQuery(c *gin.Context) {\n\tif x {\n\t}\n}\n\nfunc helper() {}\n", "go", []string{"Resp", "HandleFileQuery", "helper"}},
+		{"app.py", "import os\n\nclass Watcher:\n    def run(self):\n        pass\n\nasync def main():\n    pass\n", "python", []string{"Watcher", "main"}},
+		{"api.ts", "export interface Item {}\nexport const fetchItems = async (q: string) => {}\nexport default class Client {}\nconst limit = 10\n", "typescript", []string{"Item", "fetchItems", "Client"}},
+		{"util.c", "#include <stdio.h>\n#define MAX 10\nstatic int count(char *s);\nstatic int count(char *s)\n{\n\treturn 0;\n}\nstruct node {\n};\n", "c", []string{"MAX", "count", "node"}},
+		{"deploy", "#!/usr/bin/env bash\nset -e\nbuild() {\n  go build\n}\n", "shell", []string{"build"}},
+	}
+	for _, c := range cases {
+		doc, extra, err := parseData(context.Background(), []byte(c.source), c.filename)
+		if err != nil {
+			t.Fatalf("%s: %v", c.filename, err)
+		}
+		if extra != nil {
+			t.Fatalf("%s: unexpected extra fields %v", c.filename, extra)
+		}
+		content := doc.Content()
+		fields := doc.Fields()
+		if fields[CodeLanguageFieldName] != c.language {
+			t.Fatalf("%s: got language %v", c.filename, fields[CodeLanguageFieldName])
+		}
+		if fields[SymbolsFieldName] != strings.Join(c.symbols, "\n") {
+			t.Fatalf("%s: got symbols %q", c.filename, fields[SymbolsFieldName])
+		}
+		if DetectCodeLanguage(c.filename, c.source) != c.language {
+			t.Fatalf("%s: detected %q", c.filename, DetectCodeLanguage(c.filename, c.source))
+		}
+		if c.filename == "handler.go" {
+			section := LocateSection(content, doc.Sections, []string{"gin"})
+			if section == nil || HeadingPath(section.Headings) != "HandleFileQuery" {
+				t.Fatalf("unexpected section %+v", section)
+			}
+		}
+	}
+}
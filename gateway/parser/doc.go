@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var ErrWordDocument = errors.New("invalid word document")
+
+// Offsets into the Word 97 file information block (FIB) of the WordDocument stream.
+const (
+	fibFlagsOffset   = 0x000A
+	fibCcpTextOffset = 0x004C
+	fibFcClxOffset   = 0x01A2
+	fibWhichTblStm   = 0x0200
+)
+
+// parseDocNative extracts the main text of a Word 97-2003 .doc through its piece table.
+func parseDocNative(data []byte) (string, error) {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	streams := make(map[string][]byte)
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		switch entry.Name {
+		case "WordDocument", "0Table", "1Table":
+			b, err := ioutil.ReadAll(entry)
+			if err != nil {
+				return "", err
+			}
+			streams[entry.Name] = b
+		}
+	}
+	wordDocument, ok := streams["WordDocument"]
+	if !ok {
+		return "", ErrWordDocument
+	}
+	return docText(wordDocument, streams["0Table"], streams["1Table"])
+}
+
+// docText walks the piece table stored in the CLX of the table stream and
+// decodes each piece of the main document, either cp1252 or UTF-16.
+func docText(wordDocument, table0, table1 []byte) (string, error) {
+	if len(wordDocument) < fibFcClxOffset+8 {
+		return "", ErrWordDocument
+	}
+	table := table0
+	if binary.LittleEndian.Uint16(wordDocument[fibFlagsOffset:])&fibWhichTblStm != 0 {
+		table = table1
+	}
+	ccpText := int(binary.LittleEndian.Uint32(wordDocument[fibCcpTextOffset:]))
+	fcClx := int(binary.LittleEndian.Uint32(wordDocument[fibFcClxOffset:]))
+	lcbClx := int(binary.LittleEndian.Uint32(wordDocument[fibFcClxOffset+4:]))
+	if fcClx < 0 || lcbClx < 0 || fcClx+lcbClx > len(table) {
+		return "", ErrWordDocument
+	}
+	clx := table[fcClx : fcClx+lcbClx]
+
+	// skip the Prc entries holding property modifiers
+	p := 0
+	for p < len(clx) && clx[p] == 0x01 {
+		if p+3 > len(clx) {
+			return "", ErrWordDocument
+		}
+		p += 3 + int(binary.LittleEndian.Uint16(clx[p+1:]))
+	}
+	if p+5 > len(clx) || clx[p] != 0x02 {
+		return "", ErrWordDocument
+	}
+	lcb := int(binary.LittleEndian.Uint32(clx[p+1:]))
+	plc := clx[p+5:]
+	if lcb < 4 || lcb > len(plc) {
+		return "", ErrWordDocument
+	}
+	n := (lcb - 4) / 12
+	cps := plc[:(n+1)*4]
+	pcds := plc[(n+1)*4:]
+
+	var sb strings.Builder
+	remaining := ccpText
+	for i := 0; i < n && remaining > 0; i++ {
+		start := int(binary.LittleEndian.Uint32(cps[i*4:]))
+		end := int(binary.LittleEndian.Uint32(cps[(i+1)*4:]))
+		count := end - start
+		if count <= 0 {
+			continue
+		}
+		if count > remaining {
+			count = remaining
+		}
+		remaining -= count
+		fc := binary.LittleEndian.Uint32(pcds[i*8+2:])
+		if fc&0x40000000 != 0 {
+			offset := int(fc&0x3FFFFFFF) / 2
+			if offset < 0 || offset+count > len(wordDocument) {
+				return "", ErrWordDocument
+			}
+			decoded, err := charmap.Windows1252.NewDecoder().Bytes(wordDocument[offset : offset+count])
+			if err != nil {
+				return "", err
+			}
+			sb.Write(decoded)
+		} else {
+			offset := int(fc)
+			if offset < 0 || offset+count*2 > len(wordDocument) {
+				return "", ErrWordDocument
+			}
+			units := make([]uint16, count)
+			for j := range units {
+				units[j] = binary.LittleEndian.Uint16(wordDocument[offset+j*2:])
+			}
+			sb.WriteString(string(utf16.Decode(units)))
+		}
+	}
+	return cleanDocText(sb.String()), nil
+}
+
+// cleanDocText maps Word's control characters to plain text and drops field
+// instructions, keeping only the displayed field results.
+func cleanDocText(raw string) string {
+	var sb strings.Builder
+	// one entry per open field, true while still in its instruction part
+	fields := make([]bool, 0)
+	for _, r := range raw {
+		switch r {
+		case 0x13: // field begin
+			fields = append(fields, true)
+			continue
+		case 0x14: // field separator
+			if len(fields) > 0 {
+				fields[len(fields)-1] = false
+			}
+			continue
+		case 0x15: // field end
+			if len(fields) > 0 {
+				fields = fields[:len(fields)-1]
+			}
+			continue
+		}
+		if len(fields) > 0 && fields[len(fields)-1] {
+			continue
+		}
+		switch r {
+		case '\r', 0x0B:
+			sb.WriteRune('\n')
+		case 0x07:
+			sb.WriteRune('\t')
+		case 0x0C:
+			sb.WriteString(PageSeparator)
+		case '\t', '\n':
+			sb.WriteRune(r)
+		default:
+			if r >= 0x20 {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
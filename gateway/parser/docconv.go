@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"code.sajari.com/docconv"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MimeDoc  = "application/msword"
+	MimeDocx = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimePdf  = "application/pdf"
+)
+
+const (
+	// BackendDocconv converts through docconv and its external tools
+	// (pdftotext, wvText), falling back to the native extractors on failure.
+	BackendDocconv = "docconv"
+	// BackendNative only uses the in-process Go extractors.
+	BackendNative = "native"
+)
+
+// ErrNotOle is returned for doc files without the OLE signature.
+var ErrNotOle = errors.New("doc file is not an OLE file")
+
+// Backend selects how doc and pdf files are converted, set from PARSE_BACKEND.
+// docx is always read natively, docconv drops its headings.
+var Backend = BackendDocconv
+
+func init() {
+	RegisterDocument(ContextDocumentParserFunc(parseDocument), []string{".doc", ".docx", ".pdf"}, []string{MimeDoc, MimeDocx, MimePdf})
+	RegisterMagic(MimePdf, 0, []byte("%PDF-"))
+	RegisterZipEntry(MimeDocx, "word/document.xml")
+	RegisterOleStream(MimeDoc, "WordDocument")
+}
+
+// parseDocument converts doc, docx and pdf. The MIME type comes from the
+// content so a misnamed file is still converted with the right tool. The
+// native pdf parser stops between pages once ctx is done.
+func parseDocument(ctx context.Context, f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := DetectMimeType(data)
+	if mimeType != MimeDoc && mimeType != MimeDocx && mimeType != MimePdf {
+		mimeType = docconv.MimeTypeByExtension(filename)
+	}
+	if mimeType == MimeDocx {
+		return parseDocxDocument(data)
+	}
+	content, err := convertDocument(ctx, data, mimeType, filename)
+	if err != nil {
+		return nil, err
+	}
+	doc := DocumentFromContent(content)
+	if mimeType == MimePdf {
+		readPdfInfo(data, doc)
+	}
+	return doc, nil
+}
+
+// convertDocument extracts the text of doc and pdf with the configured backend.
+func convertDocument(ctx context.Context, data []byte, mimeType, filename string) (string, error) {
+	// docconv never returns on doc files that are not OLE files
+	if mimeType == MimeDoc && !bytes.HasPrefix(data, oleSignature) {
+		return "", ErrNotOle
+	}
+	if Backend == BackendNative {
+		return parseNative(ctx, data, mimeType)
+	}
+	res, err := docconv.Convert(bytes.NewReader(data), mimeType, true)
+	if err == nil && res.Body != "" {
+		return res.Body, nil
+	}
+	// a missing pdftotext or wvText shows up as an error or an empty body
+	content, nativeErr := parseNative(ctx, data, mimeType)
+	if nativeErr != nil {
+		if err != nil {
+			return "", err
+		}
+		return "", nativeErr
+	}
+	log.Debug().Msgf("docconv gave no text for %s, used native parser", filename)
+	return content, nil
+}
+
+func parseNative(ctx context.Context, data []byte, mimeType string) (string, error) {
+	switch mimeType {
+	case MimePdf:
+		return parsePdfNative(ctx, data)
+	case MimeDocx:
+		return parseDocxNative(data)
+	case MimeDoc:
+		return parseDocNative(data)
+	}
+	return "", ErrUnsupported
+}
@@ -0,0 +1,230 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const (
+	TitleFieldName    = "title"
+	AuthorFieldName   = "author"
+	LanguageFieldName = "language"
+	SectionsFieldName = "sections"
+)
+
+// HeadingSeparator joins a heading path for display, e.g. "Setup > Install".
+const HeadingSeparator = " > "
+
+// Document is the structured result of parsing a file.
+type Document struct {
+	Title    string
+	Author   string
+	Language string
+	// Charset is the detected encoding of text files, which are transcoded to UTF-8.
+	Charset  string
+	Sections []Section
+	// Extra holds the fields only some formats have, e.g. the symbols of source files.
+	Extra map[string]interface{}
+}
+
+// Section is a run of text on one page under one heading path. Page is
+// 1-based and 0 for formats without pages.
+type Section struct {
+	Page     int      `json:"page,omitempty"`
+	Headings []string `json:"headings,omitempty"`
+	// Offset is the byte offset of Text in the content, set by Content.
+	Offset int    `json:"offset"`
+	Text   string `json:"-"`
+}
+
+// StructuredParser is implemented by parsers that know the structure of a
+// document. Parsers without it get one section per page.
+type StructuredParser interface {
+	Parser
+	ParseDocument(f io.Reader, filename string) (*Document, error)
+}
+
+// DocumentParserFunc adapts a plain function to the StructuredParser interface.
+type DocumentParserFunc func(f io.Reader, filename string) (*Document, error)
+
+func (fn DocumentParserFunc) Parse(f io.Reader, filename string) (string, error) {
+	doc, err := fn(f, filename)
+	if err != nil {
+		return "", err
+	}
+	return doc.Content(), nil
+}
+
+func (fn DocumentParserFunc) ParseDocument(f io.Reader, filename string) (*Document, error) {
+	return fn(f, filename)
+}
+
+// ContextDocumentParserFunc adapts a function that stops when ctx is done to
+// the StructuredParser and ContextParser interfaces.
+type ContextDocumentParserFunc func(ctx context.Context, f io.Reader, filename string) (*Document, error)
+
+func (fn ContextDocumentParserFunc) Parse(f io.Reader, filename string) (string, error) {
+	return DocumentParserFunc(fn.ParseDocument).Parse(f, filename)
+}
+
+func (fn ContextDocumentParserFunc) ParseDocument(f io.Reader, filename string) (*Document, error) {
+	return fn(context.Background(), f, filename)
+}
+
+func (fn ContextDocumentParserFunc) ParseContext(ctx context.Context, f io.Reader, filename string) (*Document, map[string]interface{}, error) {
+	doc, err := fn(ctx, f, filename)
+	return doc, nil, err
+}
+
+// DocumentFromContent splits flat content into one section per page.
+func DocumentFromContent(content string) *Document {
+	if !strings.Contains(content, PageSeparator) {
+		return &Document{Sections: []Section{{Text: content}}}
+	}
+	return pagedDocument(strings.Split(content, PageSeparator))
+}
+
+// pagedDocument has one section per page, empty pages included.
+func pagedDocument(pages []string) *Document {
+	doc := &Document{Sections: make([]Section, 0, len(pages))}
+	for i, page := range pages {
+		doc.Sections = append(doc.Sections, Section{Page: i + 1, Text: page})
+	}
+	return doc
+}
+
+// Content joins the sections into the indexed content and records the offset
+// of every section. Sections on the same page are separated by a newline and
+// pages by PageSeparator, one per page so empty pages keep their numbers.
+func (d *Document) Content() string {
+	var sb strings.Builder
+	page := 1
+	for i := range d.Sections {
+		s := &d.Sections[i]
+		if s.Page > page {
+			sb.WriteString(strings.Repeat(PageSeparator, s.Page-page))
+			page = s.Page
+		} else if i > 0 {
+			sb.WriteString("\n")
+		}
+		s.Offset = sb.Len()
+		sb.WriteString(s.Text)
+	}
+	return sb.String()
+}
+
+// Fields returns the index fields of the document metadata. Sections are only
+// stored when there is more than one, call Content first to set their offsets.
+func (d *Document) Fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	if d.Title != "" {
+		fields[TitleFieldName] = d.Title
+	}
+	if d.Author != "" {
+		fields[AuthorFieldName] = d.Author
+	}
+	if d.Language != "" {
+		fields[LanguageFieldName] = d.Language
+	}
+	if d.Charset != "" {
+		fields[CharsetFieldName] = d.Charset
+	}
+	if len(d.Sections) > 1 {
+		b, _ := json.Marshal(d.Sections)
+		fields[SectionsFieldName] = string(b)
+	}
+	for k, v := range d.Extra {
+		fields[k] = v
+	}
+	return fields
+}
+
+// LocateSection returns the section of content containing the most of terms,
+// or nil when none matches. sections are the stored sections of content.
+func LocateSection(content string, sections []Section, terms []string) *Section {
+	var best *Section
+	bestMatched := 0
+	for i := range sections {
+		start := sections[i].Offset
+		end := len(content)
+		if i+1 < len(sections) {
+			end = sections[i+1].Offset
+		}
+		if start < 0 || start > end || end > len(content) {
+			continue
+		}
+		if matched := countTerms(content[start:end], terms); matched > bestMatched {
+			bestMatched = matched
+			best = &sections[i]
+		}
+	}
+	return best
+}
+
+func HeadingPath(headings []string) string {
+	return strings.Join(headings, HeadingSeparator)
+}
+
+// sectionBuilder collects the sections of a document while it is read in order.
+type sectionBuilder struct {
+	doc      *Document
+	page     int
+	headings []string
+	text     strings.Builder
+	// pageText tells whether the current page has text yet
+	pageText bool
+}
+
+func newSectionBuilder(doc *Document, page int) *sectionBuilder {
+	return &sectionBuilder{doc: doc, page: page}
+}
+
+func (b *sectionBuilder) WriteString(s string) {
+	b.text.WriteString(s)
+	if strings.TrimSpace(s) != "" {
+		b.pageText = true
+	}
+}
+
+// heading starts a new section under a heading of the 1-based level.
+func (b *sectionBuilder) heading(level int, text string) {
+	b.flush()
+	if level < 1 {
+		level = 1
+	}
+	if level-1 < len(b.headings) {
+		b.headings = b.headings[:level-1]
+	}
+	b.headings = append(b.headings, text)
+}
+
+// breakPage starts a new page. Breaks with no text since the last one count
+// once, documents often record the same break twice.
+func (b *sectionBuilder) breakPage() {
+	if !b.pageText {
+		return
+	}
+	b.flush()
+	b.page++
+	b.pageText = false
+}
+
+func (b *sectionBuilder) flush() {
+	text := strings.TrimSpace(b.text.String())
+	b.text.Reset()
+	if text == "" {
+		return
+	}
+	b.doc.Sections = append(b.doc.Sections, Section{
+		Page:     b.page,
+		Headings: append([]string(nil), b.headings...),
+		Text:     text,
+	})
+}
+
+func (b *sectionBuilder) finish() *Document {
+	b.flush()
+	return b.doc
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	md := "intro\n# Setup\n## Install ##\nrun make\n```\n# not a heading\n```\n## Configure\nedit\n# Usage\nsearch\n"
+	doc, err := ParseDocument(strings.NewReader(md), "README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0)
+	for _, s := range doc.Sections {
+		paths = append(paths, HeadingPath(s.Headings))
+	}
+	want := []string{"", "Setup", "Setup > Install", "Setup > Configure", "Usage"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got headings %q", paths)
+	}
+	content := doc.Content()
+	if section := LocateSection(content, doc.Sections, []string{"heading"}); HeadingPath(section.Headings) != "Setup > Install" {
+		t.Fatalf("located %+v", section)
+	}
+}
+
+func TestParseMarkdownFrontMatter(t *testing.T) {
+	md := "---\ntitle: Search notes\ntags: [go, zinc]\ndate: 2023-01-02\nstatus: draft\n---\n" +
+		"See [[Setup Guide|setup]] and [[setup guide#install]].\n" +
+		"Also [api](../api/Query%20API.md#limit), [web](https://example.com) and [top](#usage).\n" +
+		"```\n[[not a link]]\n```\n"
+	content, fields, err := ParseDocFields(strings.NewReader(md), "/data/notes/index.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(content, "title:") || !strings.HasPrefix(content, "See [[Setup Guide") {
+		t.Fatalf("front matter left in content %q", content)
+	}
+	if fields[TitleFieldName] != "Search notes" || fields[FrontMatterFieldName] != "status: draft" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if !reflect.DeepEqual(fields[TagsFieldName], []string{"go", "zinc"}) || fields[DateFieldName] != int64(1672617600) {
+		t.Fatalf("unexpected tags or date %v", fields)
+	}
+	if !reflect.DeepEqual(fields[WikiLinksFieldName], []string{"setup guide"}) {
+		t.Fatalf("unexpected wikilinks %v", fields[WikiLinksFieldName])
+	}
+	if !reflect.DeepEqual(fields[LinksFieldName], []string{"/data/api/Query API.md"}) {
+		t.Fatalf("unexpected links %v", fields[LinksFieldName])
+	}
+	if WikiLinkName("/data/notes/Setup Guide.md") != "setup guide" {
+		t.Fatalf("unexpected wikilink name %q", WikiLinkName("/data/notes/Setup Guide.md"))
+	}
+
+	toml := "+++\ntitle = \"Release\"\ndate = 2023-01-02\n+++\nbody\n"
+	_, fields, err = ParseDocFields(strings.NewReader(toml), "release.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields[TitleFieldName] != "Release" || fields[DateFieldName] != int64(1672617600) {
+		t.Fatalf("unexpected toml fields %v", fields)
+	}
+}
+
+func TestParseDocFieldsSections(t *testing.T) {
+	docx := zipOf(t, map[string]string{
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="cp" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Manual</dc:title><dc:creator>Li Lei</dc:creator><dc:language>zh-CN</dc:language></cp:coreProperties>`,
+		"word/styles.xml": `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:styleId="1"><w:name w:val="heading 1"/></w:style>
+<w:style w:styleId="Sub"><w:name w:val="Subsection"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style></w:styles>`,
+		"word/document.xml": docxHeader + `<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t>Overview</w:t></w:r></w:p>
+<w:p><w:r><w:t>about the product</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Sub"/></w:pPr><w:r><w:br w:type="page"/><w:t>Limits</w:t></w:r></w:p>
+<w:p><w:r><w:t>at most ten users</w:t></w:r></w:p></w:body></w:document>`,
+	})
+	content, fields, err := ParseDocFields(bytes.NewReader(docx), "manual.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Overview\nabout the product"+PageSeparator+"Limits\nat most ten users" {
+		t.Fatalf("unexpected content %q", content)
+	}
+	if fields[TitleFieldName] != "Manual" || fields[AuthorFieldName] != "Li Lei" || fields[LanguageFieldName] != "zh-CN" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	var sections []Section
+	if err := json.Unmarshal([]byte(fields[SectionsFieldName].(string)), &sections); err != nil {
+		t.Fatal(err)
+	}
+	section := LocateSection(content, sections, []string{"users"})
+	if section == nil || section.Page != 2 || HeadingPath(section.Headings) != "Overview > Limits" {
+		t.Fatalf("located %+v in %+v", section, sections)
+	}
+}
+
+func TestDocumentContent(t *testing.T) {
+	doc := &Document{Sections: []Section{{Page: 1, Text: "a"}, {Page: 1, Text: "b"}, {Page: 3, Text: "c"}}}
+	if content := doc.Content(); content != "a\nb"+PageSeparator+PageSeparator+"c" {
+		t.Fatalf("unexpected content %q", content)
+	}
+	if doc.Sections[2].Offset != 5 {
+		t.Fatalf("unexpected offset %d", doc.Sections[2].Offset)
+	}
+	if fields := DocumentFromContent("plain").Fields(); len(fields) != 0 {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+}
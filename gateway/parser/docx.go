@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const wordprocessingmlNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// docxStyles is word/styles.xml, read to find the heading styles.
+type docxStyles struct {
+	Styles []struct {
+		Id   string `xml:"styleId,attr"`
+		Name struct {
+			Val string `xml:"val,attr"`
+		} `xml:"name"`
+		OutlineLvl *struct {
+			Val string `xml:"val,attr"`
+		} `xml:"pPr>outlineLvl"`
+	} `xml:"style"`
+}
+
+// titleLevel marks the Title style in the levels of docxHeadingLevels.
+const titleLevel = 0
+
+// docxHeadingLevels maps the ids of heading styles to their 1-based level.
+// Localized documents rename the style ids, so the level comes from the
+// style name or its outline level.
+func docxHeadingLevels(files map[string]*zip.File) map[string]int {
+	levels := make(map[string]int)
+	var styles docxStyles
+	if err := decodeZipXml(files, "word/styles.xml", &styles); err != nil {
+		return levels
+	}
+	for _, style := range styles.Styles {
+		name := strings.ToLower(style.Name.Val)
+		if name == "title" {
+			levels[style.Id] = titleLevel
+			continue
+		}
+		if style.OutlineLvl != nil {
+			if lvl, ok := outlineLevel(style.OutlineLvl.Val); ok {
+				levels[style.Id] = lvl
+			}
+			continue
+		}
+		if strings.HasPrefix(name, "heading ") {
+			if lvl, err := strconv.Atoi(strings.TrimPrefix(name, "heading ")); err == nil && lvl > 0 {
+				levels[style.Id] = lvl
+			}
+		}
+	}
+	return levels
+}
+
+// outlineLevel converts a 0-based w:outlineLvl, where 9 is body text.
+func outlineLevel(val string) (int, bool) {
+	lvl, err := strconv.Atoi(val)
+	if err != nil || lvl < 0 || lvl > 8 {
+		return 0, false
+	}
+	return lvl + 1, true
+}
+
+func parseDocxNative(data []byte) (string, error) {
+	doc, err := parseDocxDocument(data)
+	if err != nil {
+		return "", err
+	}
+	return doc.Content(), nil
+}
+
+// parseDocxDocument reads word/document.xml into sections split at headings
+// and pages. Explicit page breaks and the page breaks Word recorded at its
+// last layout both start a new page.
+func parseDocxDocument(data []byte) (*Document, error) {
+	files, err := zipFiles(data)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := openZipEntry(files, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	doc := &Document{}
+	readCoreProperties(files, doc)
+	levels := docxHeadingLevels(files)
+	b := newSectionBuilder(doc, 1)
+
+	// text of the current paragraph and its heading level, -1 for body text
+	var para bytes.Buffer
+	level := -1
+	inText := false
+	d := xml.NewDecoder(rc)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordprocessingmlNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				// paragraphs nest inside text boxes, keep the outer text
+				b.WriteString(para.String())
+				para.Reset()
+				level = -1
+			case "pStyle":
+				if lvl, ok := levels[wordAttr(t, "val")]; ok {
+					level = lvl
+				}
+			case "outlineLvl":
+				if lvl, ok := outlineLevel(wordAttr(t, "val")); ok {
+					level = lvl
+				}
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteString("\t")
+			case "br", "cr":
+				if wordAttr(t, "type") == "page" {
+					b.WriteString(para.String())
+					para.Reset()
+					b.breakPage()
+				} else {
+					para.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				b.WriteString(para.String())
+				para.Reset()
+				b.breakPage()
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordprocessingmlNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if text != "" && level == titleLevel && doc.Title == "" {
+					doc.Title = text
+				} else if text != "" && level > titleLevel {
+					b.heading(level, text)
+				}
+				b.WriteString(para.String())
+				b.WriteString("\n")
+				para.Reset()
+			case "tc":
+				b.WriteString("\t")
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return b.finish(), nil
+}
+
+func wordAttr(t xml.StartElement, local string) string {
+	for _, attr := range t.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TagsFieldName        = "tags"
+	FrontMatterFieldName = "front_matter"
+)
+
+// frontMatterDateLayouts are tried in order for dates written as strings.
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// splitFrontMatter separates YAML front matter between "---" lines or TOML
+// front matter between "+++" lines from the text after it. Text without
+// valid front matter is returned whole with a nil map.
+func splitFrontMatter(text string) (map[string]interface{}, string) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	var delimiter string
+	switch {
+	case strings.HasPrefix(text, "---\n"), strings.HasPrefix(text, "---\r\n"):
+		delimiter = "---"
+	case strings.HasPrefix(text, "+++\n"), strings.HasPrefix(text, "+++\r\n"):
+		delimiter = "+++"
+	default:
+		return nil, text
+	}
+	start := strings.IndexByte(text, '\n') + 1
+	for pos := start; pos < len(text); {
+		end := strings.IndexByte(text[pos:], '\n')
+		next := len(text)
+		if end >= 0 {
+			next = pos + end + 1
+		}
+		line := strings.TrimRight(text[pos:next], "\r\n")
+		// YAML documents may also end with "..."
+		if line == delimiter || (delimiter == "---" && line == "...") {
+			meta := make(map[string]interface{})
+			var err error
+			if delimiter == "---" {
+				err = yaml.Unmarshal([]byte(text[start:pos]), &meta)
+			} else {
+				err = toml.Unmarshal([]byte(text[start:pos]), &meta)
+			}
+			if err != nil {
+				return nil, text
+			}
+			return meta, text[next:]
+		}
+		pos = next
+	}
+	return nil, text
+}
+
+// applyFrontMatter sets the title, author and language of doc from front
+// matter and returns the other index fields: tags, the date in unix seconds
+// and every remaining key as "key: value" lines.
+func applyFrontMatter(meta map[string]interface{}, doc *Document) map[string]interface{} {
+	fields := make(map[string]interface{})
+	tags := make([]string, 0)
+	rest := make([]string, 0)
+	for key, value := range meta {
+		switch strings.ToLower(key) {
+		case "title":
+			doc.Title = frontMatterString(value)
+		case "author", "authors":
+			doc.Author = strings.Join(frontMatterStrings(value), ", ")
+		case "lang", "language":
+			doc.Language = frontMatterString(value)
+		case "tags", "keywords", "categories":
+			tags = append(tags, frontMatterStrings(value)...)
+		case "date":
+			if date, ok := frontMatterTime(value); ok {
+				fields[DateFieldName] = date.Unix()
+				continue
+			}
+			rest = append(rest, key+": "+frontMatterString(value))
+		default:
+			rest = append(rest, key+": "+strings.Join(frontMatterStrings(value), ", "))
+		}
+	}
+	if len(tags) > 0 {
+		fields[TagsFieldName] = tags
+	}
+	if len(rest) > 0 {
+		// map order is random, keep the field stable between parses
+		sort.Strings(rest)
+		fields[FrontMatterFieldName] = strings.Join(rest, "\n")
+	}
+	return fields
+}
+
+func frontMatterString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// frontMatterStrings reads a list, or a comma separated string as in
+// "tags: go, search".
+func frontMatterStrings(value interface{}) []string {
+	res := make([]string, 0)
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s := frontMatterString(item); s != "" {
+				res = append(res, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				res = append(res, s)
+			}
+		}
+	default:
+		if s := frontMatterString(v); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// frontMatterTime reads dates that YAML and TOML decoded as times, and
+// dates left as strings.
+func frontMatterTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case toml.LocalDate:
+		return v.AsTime(time.UTC), true
+	case toml.LocalDateTime:
+		return v.AsTime(time.UTC), true
+	case string:
+		for _, layout := range frontMatterDateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var htmlSpace = regexp.MustCompile(`\s+`)
+
+// htmlBlocks are the elements that start a new line in the extracted text.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "hr": true,
+}
+
+// htmlToText returns the visible text of an html document, dropping scripts and styles.
+func htmlToText(s string) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(sb.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				skip++
+			default:
+				if htmlBlocks[string(name)] {
+					sb.WriteString("\n")
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				if skip > 0 {
+					skip--
+				}
+			default:
+				if htmlBlocks[string(name)] {
+					sb.WriteString("\n")
+				}
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.WriteString(htmlSpace.ReplaceAllString(string(z.Text()), " "))
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageSample is how much of the content language detection looks at.
+const languageSample = 64 << 10
+
+// minLanguageLetters is the fewest letters detection decides on.
+const minLanguageLetters = 20
+
+// languageStopwords tell the languages written in Latin script apart.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "this"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "eine", "zu", "auf", "ich"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "que", "pour", "dans", "pas", "du"},
+	"es": {"el", "la", "los", "las", "que", "y", "es", "por", "una", "para", "con", "del"},
+	"it": {"il", "di", "che", "e", "la", "per", "una", "sono", "non", "gli", "con", "del"},
+	"pt": {"o", "que", "de", "não", "uma", "para", "com", "os", "é", "do", "da", "em"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met"},
+}
+
+var stopwordLanguages = func() map[string][]string {
+	res := make(map[string][]string)
+	for lang, words := range languageStopwords {
+		for _, w := range words {
+			res[w] = append(res[w], lang)
+		}
+	}
+	return res
+}()
+
+// DetectLanguage guesses the language of text from its scripts, and from
+// common words for Latin script. It returns a two letter code like "zh" or
+// "en", or "" when there is too little text to tell.
+func DetectLanguage(text string) string {
+	if len(text) > languageSample {
+		text = truncateText(text, languageSample)
+	}
+	var han, kana, hangul, cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	// one CJK character carries about as much as a word of Latin letters
+	cjk := han + kana + hangul
+	if cjk*4 >= latin+cyrillic && cjk >= minLanguageLetters/4 {
+		switch {
+		case kana*10 >= cjk:
+			return "ja"
+		case hangul*2 >= cjk:
+			return "ko"
+		}
+		return "zh"
+	}
+	if latin+cyrillic < minLanguageLetters {
+		return ""
+	}
+	if cyrillic > latin {
+		return "ru"
+	}
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for _, lang := range stopwordLanguages[word] {
+			counts[lang]++
+		}
+	}
+	best := ""
+	for lang, n := range counts {
+		if n > counts[best] || (n == counts[best] && lang < best) {
+			best = lang
+		}
+	}
+	return best
+}
+
+// PrimaryLanguage reduces a language tag like "en-US" or "zh_CN" to "en"
+// or "zh".
+func PrimaryLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,27 @@
+package parser
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"敏感词过滤是内容安全的重要组成部分，我们需要支持 Go 和 Python 的 API。":                                "zh",
+		"これは日本語の文章です。ひらがなとカタカナが含まれています。":                                             "ja",
+		"한국어 문장입니다. 검색 엔진이 한국어를 구분해야 합니다.":                                           "ko",
+		"The quick brown fox jumps over the lazy dog and this is the end of it.":     "en",
+		"Der schnelle braune Fuchs springt über den faulen Hund, das ist nicht neu.": "de",
+		"Le renard brun rapide saute par-dessus le chien paresseux dans la forêt.":   "fr",
+		"Быстрая коричневая лиса прыгает через ленивую собаку.":                      "ru",
+		"ok":          "",
+		"12345 67890": "",
+	}
+	for text, want := range cases {
+		if got := DetectLanguage(text); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+	for tag, want := range map[string]string{"en-US": "en", "zh_CN": "zh", "ZH": "zh", "": ""} {
+		if got := PrimaryLanguage(tag); got != want {
+			t.Errorf("PrimaryLanguage(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
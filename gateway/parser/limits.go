@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const ParseStatusFieldName = "parse_status"
+
+// Outcomes of parsing a file recorded in the parse_status field.
+const (
+	ParseOK        = "ok"
+	ParseTruncated = "truncated"
+	ParseTimeout   = "timeout"
+	ParseError     = "error"
+	// set by the watcher on files that failed too often to be parsed again
+	ParseQuarantined = "quarantined"
+)
+
+var ErrParseTimeout = errors.New("parse timeout")
+
+// ParseLimits bound the memory and time spent on one file.
+type ParseLimits struct {
+	// MaxBytes is how much of a file is read, the rest is left out.
+	MaxBytes int64
+	// MaxText is the length in bytes the extracted content is cut to.
+	MaxText int
+	// Timeout is the wall-clock time a parser gets before the file is given up.
+	Timeout time.Duration
+}
+
+// DefaultParseLimits are used by the watcher and the input API, set from
+// PARSE_MAX_BYTES, PARSE_MAX_TEXT and PARSE_TIMEOUT.
+var DefaultParseLimits = ParseLimits{
+	MaxBytes: 256 << 20,
+	MaxText:  16 << 20,
+	Timeout:  2 * time.Minute,
+}
+
+// ParseConcurrency is how many files are parsed at once, set from
+// PARSE_CONCURRENCY.
+var ParseConcurrency = runtime.NumCPU()
+
+// MaxAbandonedParses bounds the parsers still running after their timeout,
+// set from PARSE_MAX_ABANDONED. Their slots go to the next files until that
+// many run, later ones keep their slot until they return, so parsers stuck
+// on bad files cannot pile up.
+var MaxAbandonedParses = 16
+
+// ErrParseBusy is returned when no parse slot frees up within the timeout.
+var ErrParseBusy = errors.New("no free parse slot")
+
+type parseSlots struct {
+	active    chan struct{}
+	abandoned chan struct{}
+}
+
+func newParseSlots(n, maxAbandoned int) *parseSlots {
+	if n <= 0 {
+		n = 1
+	}
+	if maxAbandoned < 0 {
+		maxAbandoned = 0
+	}
+	return &parseSlots{
+		active:    make(chan struct{}, n),
+		abandoned: make(chan struct{}, maxAbandoned),
+	}
+}
+
+var (
+	parseSlotsOnce    sync.Once
+	defaultParseSlots *parseSlots
+)
+
+func getParseSlots() *parseSlots {
+	parseSlotsOnce.Do(func() {
+		defaultParseSlots = newParseSlots(ParseConcurrency, MaxAbandonedParses)
+	})
+	return defaultParseSlots
+}
+
+// acquire waits for a free slot, or for ctx.
+func (p *parseSlots) acquire(ctx context.Context) (*parseSlot, error) {
+	select {
+	case p.active <- struct{}{}:
+		return &parseSlot{slots: p}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// parseSlot is the slot of one parse.
+type parseSlot struct {
+	slots     *parseSlots
+	mu        sync.Mutex
+	done      bool
+	abandoned bool
+}
+
+// finish gives back the slot once the parser returned.
+func (s *parseSlot) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	if s.abandoned {
+		<-s.slots.abandoned
+	} else {
+		<-s.slots.active
+	}
+}
+
+// abandon gives the slot of a parse that timed out to the next file, when
+// fewer than MaxAbandonedParses run after their timeout.
+func (s *parseSlot) abandon() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done || s.abandoned {
+		return
+	}
+	select {
+	case s.slots.abandoned <- struct{}{}:
+		s.abandoned = true
+		<-s.slots.active
+	default:
+	}
+}
+
+// ReadLimited reads at most max bytes of r and tells whether there was more.
+// Reading stops early with the error of ctx once it is done.
+func ReadLimited(ctx context.Context, r io.Reader, max int64) ([]byte, bool, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: r}, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > max {
+		return data[:max], true, nil
+	}
+	return data, false, nil
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ParseDocFieldsLimited reads and parses f like ParseDocFields under limits.
+// See ParseDataLimited for the result.
+func ParseDocFieldsLimited(ctx context.Context, f io.Reader, filename string, limits ParseLimits) (string, map[string]interface{}, error) {
+	data, truncated, err := ReadLimited(ctx, f, limits.MaxBytes)
+	if err != nil {
+		return "", map[string]interface{}{ParseStatusFieldName: ParseError}, err
+	}
+	return ParseDataLimited(ctx, data, truncated, filename, limits)
+}
+
+type parseResult struct {
+	doc   *Document
+	extra map[string]interface{}
+	err   error
+}
+
+// ParseDataLimited parses data like ParseDocFields, giving up after
+// limits.Timeout or when ctx is done, and cutting the content to
+// limits.MaxText. truncated tells that data is only the head of the file.
+//
+// The fields always hold the outcome in parse_status, so a file that failed
+// can still be indexed by name. The error explains a timeout or failure.
+// Parsing waits up to limits.Timeout for a free slot of ParseConcurrency
+// before the timeout starts, failing with ErrParseBusy. Parsers implementing
+// ContextParser stop once it passes, others keep running in the background
+// until they return and their result is dropped.
+func ParseDataLimited(ctx context.Context, data []byte, truncated bool, filename string, limits ParseLimits) (string, map[string]interface{}, error) {
+	acquireCtx := ctx
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		acquireCtx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	slot, err := getParseSlots().acquire(acquireCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			return "", map[string]interface{}{ParseStatusFieldName: ParseTimeout}, ErrParseBusy
+		}
+		return "", map[string]interface{}{ParseStatusFieldName: ParseError}, err
+	}
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	done := make(chan parseResult, 1)
+	go func() {
+		defer slot.finish()
+		// a panicking parser must not take down the gateway
+		defer func() {
+			if r := recover(); r != nil {
+				done <- parseResult{err: fmt.Errorf("parse %s panic: %v", filename, r)}
+			}
+		}()
+		doc, extra, err := parseData(ctx, data, filename)
+		done <- parseResult{doc: doc, extra: extra, err: err}
+	}()
+
+	var res parseResult
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		slot.abandon()
+		status := ParseError
+		err := ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			status, err = ParseTimeout, ErrParseTimeout
+		}
+		return "", map[string]interface{}{ParseStatusFieldName: status}, err
+	}
+	if res.err != nil {
+		status := ParseError
+		// the head of a large file is often not a valid file on its own
+		if truncated {
+			status = ParseTruncated
+		}
+		return "", map[string]interface{}{ParseStatusFieldName: status}, res.err
+	}
+
+	content := res.doc.Content()
+	if limits.MaxText > 0 && len(content) > limits.MaxText {
+		content = truncateText(content, limits.MaxText)
+		truncated = true
+		sections := res.doc.Sections[:0]
+		for _, s := range res.doc.Sections {
+			if s.Offset < len(content) {
+				sections = append(sections, s)
+			}
+		}
+		res.doc.Sections = sections
+	}
+	fields := make(map[string]interface{})
+	for k, v := range res.doc.Fields() {
+		fields[k] = v
+	}
+	for k, v := range res.extra {
+		fields[k] = v
+	}
+	// declared languages are often the default of a template, trust the text
+	if lang := DetectLanguage(content); lang != "" {
+		fields[LanguageFieldName] = lang
+	}
+	fields[ParseStatusFieldName] = ParseOK
+	if truncated {
+		fields[ParseStatusFieldName] = ParseTruncated
+	}
+	return content, fields, nil
+}
+
+// truncateText cuts s to at most max bytes without splitting a character.
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
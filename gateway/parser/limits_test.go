@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDataLimited(t *testing.T) {
+	useTestRegistry(t)
+	release := make(chan struct{})
+	Register(ParserFunc(func(f io.Reader, filename string) (string, error) {
+		<-release
+		return "late", nil
+	}), []string{".slow"}, nil)
+	Register(ParserFunc(func(f io.Reader, filename string) (string, error) {
+		panic("broken parser")
+	}), []string{".panic"}, nil)
+	stopped := make(chan error, 1)
+	Register(ContextDocumentParserFunc(func(ctx context.Context, f io.Reader, filename string) (*Document, error) {
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	}), []string{".loop"}, nil)
+
+	limits := ParseLimits{MaxBytes: 16, MaxText: 10, Timeout: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	content, fields, err := ParseDocFieldsLimited(ctx, strings.NewReader("short"), "a.txt", limits)
+	if err != nil || content != "short" || fields[ParseStatusFieldName] != ParseOK {
+		t.Fatalf("got %q %v %v", content, fields, err)
+	}
+	// cut at MaxBytes when read, then at MaxText without splitting characters
+	content, fields, err = ParseDocFieldsLimited(ctx, strings.NewReader("héllo wörld and more text"), "a.txt", limits)
+	if err != nil || content != "héllo wö" || fields[ParseStatusFieldName] != ParseTruncated {
+		t.Fatalf("got %q %v %v", content, fields, err)
+	}
+	// one slot, one abandoned parser: the first slow parser gives its slot
+	// to the next file, the second keeps it and the third file cannot start
+	useTestParseSlots(t, 1, 1)
+	for i := 0; i < 2; i++ {
+		_, fields, err = ParseDocFieldsLimited(ctx, strings.NewReader("data"), "a.slow", limits)
+		if err != ErrParseTimeout || fields[ParseStatusFieldName] != ParseTimeout {
+			t.Fatalf("got %v %v", fields, err)
+		}
+	}
+	_, fields, err = ParseDocFieldsLimited(ctx, strings.NewReader("short"), "a.txt", limits)
+	if err != ErrParseBusy || fields[ParseStatusFieldName] != ParseTimeout {
+		t.Fatalf("got %v %v", fields, err)
+	}
+	close(release)
+	waitParseSlots(t, defaultParseSlots)
+	content, _, err = ParseDocFieldsLimited(ctx, strings.NewReader("short"), "a.txt", limits)
+	if err != nil || content != "short" {
+		t.Fatalf("got %q %v", content, err)
+	}
+	_, fields, err = ParseDocFieldsLimited(ctx, strings.NewReader("data"), "a.panic", limits)
+	if err == nil || fields[ParseStatusFieldName] != ParseError {
+		t.Fatalf("got %v %v", fields, err)
+	}
+
+	// a context parser stops at the timeout and gives back its slot
+	for i := 0; i <= cap(defaultParseSlots.active)+cap(defaultParseSlots.abandoned); i++ {
+		_, fields, err = ParseDocFieldsLimited(ctx, strings.NewReader("data"), "a.loop", limits)
+		if err != ErrParseTimeout || fields[ParseStatusFieldName] != ParseTimeout {
+			t.Fatalf("got %v %v", fields, err)
+		}
+		if err := <-stopped; err != context.DeadlineExceeded {
+			t.Fatalf("expected the parser to stop, got %v", err)
+		}
+	}
+
+	data, truncated, err := ReadLimited(ctx, strings.NewReader("0123456789"), 4)
+	if err != nil || string(data) != "0123" || !truncated {
+		t.Fatalf("got %q %v %v", data, truncated, err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := ReadLimited(cancelled, strings.NewReader("0123"), 4); err != context.Canceled {
+		t.Fatalf("expected cancel, got %v", err)
+	}
+}
+
+// useTestParseSlots replaces the parse slots for the test.
+func useTestParseSlots(t *testing.T, n, maxAbandoned int) {
+	slots := getParseSlots()
+	defaultParseSlots = newParseSlots(n, maxAbandoned)
+	t.Cleanup(func() { defaultParseSlots = slots })
+}
+
+// waitParseSlots waits for the parsers left running to return.
+func waitParseSlots(t *testing.T, p *parseSlots) {
+	for i := 0; len(p.active)+len(p.abandoned) > 0; i++ {
+		if i == 100 {
+			t.Fatal("parse slots still taken")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestZipEntryLimit(t *testing.T) {
+	max := DefaultParseLimits.MaxBytes
+	DefaultParseLimits.MaxBytes = 1 << 10
+	t.Cleanup(func() { DefaultParseLimits.MaxBytes = max })
+
+	// compresses to a few bytes, read in full it would be 1MB
+	body := `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>` +
+		strings.Repeat("a", 1<<20) + `</w:t></w:r></w:p></w:body></w:document>`
+	docx := zipOf(t, map[string]string{
+		"[Content_Types].xml": `<Types/>`,
+		"word/document.xml":   body,
+	})
+	files, err := zipFiles(docx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct{}
+	if err := decodeZipXml(files, "word/document.xml", &v); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("expected entry too large, got %v", err)
+	}
+	if _, err := parseDocxDocument(docx); err == nil {
+		t.Fatal("expected the cut document to fail")
+	}
+	odt := zipOf(t, map[string]string{"mimetype": MimeOdt + strings.Repeat(" ", 1<<20)})
+	if got := defaultRegistry.sniff.detectZip(odt); got != MimeOdt {
+		t.Fatalf("got mime type %q", got)
+	}
+}
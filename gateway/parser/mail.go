@@ -0,0 +1,355 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const (
+	MimeEml = "message/rfc822"
+	MimeMsg = "application/vnd.ms-outlook"
+)
+
+const (
+	FromFieldName        = "from"
+	ToFieldName          = "to"
+	SubjectFieldName     = "subject"
+	DateFieldName        = "date"
+	AttachmentsFieldName = "attachments"
+)
+
+// maxMailParts bounds the MIME parts read from one message.
+const maxMailParts = 1000
+
+// Mail is an email message read from an .eml or .msg file.
+type Mail struct {
+	From        string
+	To          string
+	Subject     string
+	Date        time.Time
+	Body        string
+	Attachments []MailAttachment
+}
+
+type MailAttachment struct {
+	Name string
+	Data []byte
+}
+
+type mailParser struct{}
+
+func init() {
+	Register(mailParser{}, []string{".eml", ".msg"}, []string{MimeEml, MimeMsg})
+	RegisterOleStream(MimeMsg, "__properties_version1.0")
+}
+
+func (p mailParser) Parse(f io.Reader, filename string) (string, error) {
+	content, _, err := p.ParseFields(f, filename)
+	return content, err
+}
+
+func (p mailParser) ParseFields(f io.Reader, filename string) (string, map[string]interface{}, error) {
+	doc, fields, err := p.ParseContext(context.Background(), f, filename)
+	if err != nil {
+		return "", nil, err
+	}
+	return doc.Content(), fields, nil
+}
+
+// ParseContext returns the headers and body of a message as content with the
+// text of every attachment the registry can parse, and the header fields.
+// The attachments are parsed under ctx, so they stop with the message.
+func (mailParser) ParseContext(ctx context.Context, f io.Reader, filename string) (*Document, map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m *Mail
+	if DetectMimeType(data) == MimeMsg {
+		m, err = ParseMsg(data)
+	} else {
+		m, err = ParseMail(data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return DocumentFromContent(m.Content(ctx)), m.Fields(), nil
+}
+
+// Content renders the message for the index: subject, sender and recipients,
+// the body and the text of the attachments, each under its name. The
+// attachments left once ctx is done are skipped.
+func (m *Mail) Content(ctx context.Context) string {
+	var sb strings.Builder
+	sb.WriteString(m.Subject)
+	sb.WriteString("\nFrom: ")
+	sb.WriteString(m.From)
+	sb.WriteString("\nTo: ")
+	sb.WriteString(m.To)
+	sb.WriteString("\n\n")
+	sb.WriteString(m.Body)
+	for _, a := range m.Attachments {
+		if ctx.Err() != nil {
+			break
+		}
+		if !IsParseAbleContent(a.Name, a.Data) {
+			continue
+		}
+		doc, _, err := parseData(ctx, a.Data, a.Name)
+		if err != nil {
+			continue
+		}
+		content := doc.Content()
+		if content == "" {
+			continue
+		}
+		sb.WriteString("\n\n")
+		sb.WriteString(a.Name)
+		sb.WriteString("\n")
+		sb.WriteString(content)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Fields returns the header fields stored on the message document, the date
+// in unix seconds so it can be filtered by range.
+func (m *Mail) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		FromFieldName:    m.From,
+		ToFieldName:      m.To,
+		SubjectFieldName: m.Subject,
+	}
+	if !m.Date.IsZero() {
+		fields[DateFieldName] = m.Date.Unix()
+	}
+	if len(m.Attachments) > 0 {
+		names := make([]string, 0, len(m.Attachments))
+		for _, a := range m.Attachments {
+			names = append(names, a.Name)
+		}
+		fields[AttachmentsFieldName] = strings.Join(names, "\n")
+	}
+	return fields
+}
+
+var mailWordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// ParseMail reads an RFC 5322 message.
+func ParseMail(data []byte) (*Mail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	m := &Mail{
+		From:    mailAddresses(msg.Header.Get("From")),
+		To:      mailAddresses(msg.Header.Get("To")),
+		Subject: decodeMailHeader(msg.Header.Get("Subject")),
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		m.Date = date
+	}
+	r := &mailReader{mail: m}
+	if err := r.readPart(textproto.MIMEHeader(msg.Header), msg.Body); err != nil {
+		return nil, err
+	}
+	m.Body = r.text.String()
+	if strings.TrimSpace(m.Body) == "" {
+		m.Body = htmlToText(r.html.String())
+	}
+	m.Body = strings.TrimSpace(m.Body)
+	return m, nil
+}
+
+func decodeMailHeader(value string) string {
+	decoded, err := mailWordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// mailAddresses formats an address list header as "Name <addr>, addr".
+func mailAddresses(value string) string {
+	if value == "" {
+		return ""
+	}
+	parser := mail.AddressParser{WordDecoder: mailWordDecoder}
+	list, err := parser.ParseList(value)
+	if err != nil {
+		return decodeMailHeader(value)
+	}
+	addresses := make([]string, 0, len(list))
+	for _, a := range list {
+		if a.Name == "" {
+			addresses = append(addresses, a.Address)
+		} else {
+			addresses = append(addresses, fmt.Sprintf("%s <%s>", a.Name, a.Address))
+		}
+	}
+	return strings.Join(addresses, ", ")
+}
+
+// mailReader walks the MIME tree of a message, collecting the plain and
+// html bodies and the attachments.
+type mailReader struct {
+	mail  *Mail
+	text  strings.Builder
+	html  strings.Builder
+	parts int
+}
+
+func (r *mailReader) readPart(header textproto.MIMEHeader, body io.Reader) error {
+	r.parts++
+	if r.parts > maxMailParts {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	body = transferDecoder(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				// keep what was read of a truncated message
+				return nil
+			}
+			if err := r.readPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	// a corrupt transfer encoding keeps what decoded before it
+	data, _ := ioutil.ReadAll(body)
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := decodeMailHeader(dispositionParams["filename"])
+	if name == "" {
+		name = decodeMailHeader(params["name"])
+	}
+	if disposition == "attachment" || name != "" || mediaType == MimeEml {
+		if name == "" {
+			name = fmt.Sprintf("attachment%d%s", len(r.mail.Attachments)+1, mimeExtension(mediaType))
+		}
+		r.mail.Attachments = append(r.mail.Attachments, MailAttachment{Name: name, Data: data})
+		return nil
+	}
+	switch mediaType {
+	case "text/plain":
+		r.text.WriteString(decodeCharset(data, params["charset"]))
+		r.text.WriteString("\n")
+	case "text/html":
+		r.html.WriteString(decodeCharset(data, params["charset"]))
+	}
+	return nil
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// decodeCharset converts a body in the declared charset to UTF-8, guessing
+// when the charset is missing or unknown.
+func decodeCharset(data []byte, charset string) string {
+	if charset != "" {
+		if enc, err := htmlindex.Get(charset); err == nil {
+			if decoded, err := enc.NewDecoder().Bytes(data); err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	text, _, err := DecodeText(data)
+	if err != nil {
+		return string(data)
+	}
+	return text
+}
+
+func mimeExtension(mediaType string) string {
+	if mediaType == MimeEml {
+		return ".eml"
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// mboxQuoted matches body lines starting with "From " that mboxrd writers
+// escaped with a ">".
+var mboxQuoted = regexp.MustCompile(`(?m)^>(>*From )`)
+
+// eachMboxMessage calls fn for every message of an mbox file, named by its
+// position like 1.eml. A message starts at a "From " line at the start of the
+// file or after a blank line.
+func eachMboxMessage(data []byte, fn archiveFileFunc) error {
+	count := 0
+	emit := func(msg []byte) error {
+		count++
+		msg = mboxQuoted.ReplaceAll(msg, []byte("$1"))
+		return fn(fmt.Sprintf("%d.eml", count), func() (io.Reader, error) { return bytes.NewReader(msg), nil })
+	}
+	start := -1
+	for pos := 0; pos < len(data); {
+		next := len(data)
+		if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+			next = pos + i + 1
+		}
+		if bytes.HasPrefix(data[pos:], mboxSignature) && (pos == 0 || afterBlankLine(data[:pos])) {
+			if start >= 0 {
+				if err := emit(data[start:pos]); err != nil {
+					return err
+				}
+			}
+			// the "From " separator line is not part of the message
+			start = next
+		}
+		pos = next
+	}
+	if start >= 0 && start < len(data) {
+		return emit(data[start:])
+	}
+	return nil
+}
+
+func afterBlankLine(b []byte) bool {
+	return bytes.HasSuffix(b, []byte("\n\n")) || bytes.HasSuffix(b, []byte("\r\n\r\n"))
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testMail = "From: =?ISO-8859-1?Q?Ren=E9?= <rene@example.com>\r\n" +
+	"To: bob@example.com, Carol <carol@example.com>\r\n" +
+	"Subject: =?UTF-8?B?5Lya6K6u57qq6KaB?= notes\r\n" +
+	"Date: Mon, 02 Jan 2023 15:04:05 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Budget caf=C3=A9 review\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Budget caf&eacute; review</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; name=\"minutes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"minutes.txt\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"cXVhcnRlcmx5IHRhcmdldHM=\r\n" +
+	"--outer--\r\n"
+
+func TestParseMail(t *testing.T) {
+	m, err := ParseMail([]byte(testMail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "René <rene@example.com>" || m.To != "bob@example.com, Carol <carol@example.com>" {
+		t.Fatalf("unexpected addresses %q %q", m.From, m.To)
+	}
+	if m.Subject != "会议纪要 notes" {
+		t.Fatalf("unexpected subject %q", m.Subject)
+	}
+	if m.Body != "Budget café review" {
+		t.Fatalf("unexpected body %q", m.Body)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "minutes.txt" || string(m.Attachments[0].Data) != "quarterly targets" {
+		t.Fatalf("unexpected attachments %+v", m.Attachments)
+	}
+
+	content, fields, err := ParseDocFields(strings.NewReader(testMail), "/data/notes.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "Budget café review") || !strings.Contains(content, "minutes.txt\nquarterly targets") {
+		t.Fatalf("unexpected content %q", content)
+	}
+	if fields[DateFieldName] != time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC).Unix() {
+		t.Fatalf("unexpected date %v", fields[DateFieldName])
+	}
+	if fields[AttachmentsFieldName] != "minutes.txt" {
+		t.Fatalf("unexpected attachments %v", fields[AttachmentsFieldName])
+	}
+
+	// attachments are not parsed once the message is given up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if content := m.Content(ctx); strings.Contains(content, "quarterly targets") || !strings.Contains(content, "Budget café review") {
+		t.Fatalf("unexpected content %q", content)
+	}
+}
+
+func TestWalkMbox(t *testing.T) {
+	mbox := "From alice@example.com Mon Jan  2 15:04:05 2023\n" +
+		"From: alice@example.com\nSubject: first\n\nhello\n>From the start\n\n" +
+		"From bob@example.com Tue Jan  3 15:04:05 2023\n" +
+		"From: bob@example.com\nSubject: second\n\n>From here on, bye\n"
+	got := make(map[string]string)
+	err := WalkArchive([]byte(mbox), "/data/inbox.mbox", DefaultArchiveLimits, func(virtualPath string, data []byte, truncated bool) error {
+		got[virtualPath] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := sortedKeys(got); !reflect.DeepEqual(keys, []string{"/data/inbox.mbox!/1.eml", "/data/inbox.mbox!/2.eml"}) {
+		t.Fatalf("got paths %q", keys)
+	}
+	first, err := ParseMail([]byte(got["/data/inbox.mbox!/1.eml"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Subject != "first" || first.Body != "hello\nFrom the start" {
+		t.Fatalf("unexpected first message %+v", first)
+	}
+	second, err := ParseMail([]byte(got["/data/inbox.mbox!/2.eml"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.From != "bob@example.com" || second.Body != "From here on, bye" {
+		t.Fatalf("unexpected second message %+v", second)
+	}
+}
+
+func TestMsgProperties(t *testing.T) {
+	id, typ, ok := msgPropertyTag("__substg1.0_0037001F")
+	if !ok || id != mapiSubject || typ != mapiUnicode {
+		t.Fatalf("got %x %x %v", id, typ, ok)
+	}
+	if _, _, ok := msgPropertyTag("__substg1.0_xyz"); ok {
+		t.Fatal("expected invalid tag")
+	}
+	if got := string(msgValue([]byte{'H', 0, 'i', 0}, mapiUnicode)); got != "Hi" {
+		t.Fatalf("got %q", got)
+	}
+
+	sent := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	stream := make([]byte, msgPropertiesHeader+16)
+	entry := stream[msgPropertiesHeader:]
+	binary.LittleEndian.PutUint32(entry, mapiClientSubmitTime<<16|mapiSysTime)
+	binary.LittleEndian.PutUint64(entry[8:], uint64(sent.UnixNano()/100+116444736000000000))
+	if got := msgTime(stream, mapiClientSubmitTime); !got.Equal(sent) {
+		t.Fatalf("got %v", got)
+	}
+	if got := msgTime(stream, mapiDeliveryTime); !got.IsZero() {
+		t.Fatalf("got %v", got)
+	}
+	if _, err := ParseMsg(bytes.Repeat([]byte{0}, 512)); err == nil {
+		t.Fatal("expected error for invalid compound file")
+	}
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const MimeMarkdown = "text/markdown"
+
+const (
+	// LinksFieldName holds the paths of the files a note links to relatively.
+	LinksFieldName = "links"
+	// WikiLinksFieldName holds the lower case names of [[wikilink]] targets,
+	// which are resolved by file name.
+	WikiLinksFieldName = "wikilinks"
+)
+
+var (
+	wikiLinkPattern     = regexp.MustCompile(`\[\[([^\[\]|#]+)(?:#[^\[\]|]*)?(?:\|[^\[\]]*)?\]\]`)
+	markdownLinkPattern = regexp.MustCompile(`\]\(\s*<?([^()\s<>]+)>?(?:\s+"[^"]*")?\s*\)`)
+)
+
+func init() {
+	RegisterDocument(DocumentParserFunc(parseMarkdown), []string{".md", ".markdown"}, []string{MimeMarkdown, "text/x-markdown"})
+}
+
+// parseMarkdown splits the text at its ATX headings ("## Install"). Lines in
+// fenced code blocks are never headings. Front matter is indexed as fields
+// instead of text, and the links to other notes are collected outside code.
+func parseMarkdown(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	text, charset, err := DecodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Charset: charset}
+	meta, text := splitFrontMatter(text)
+	fields := applyFrontMatter(meta, doc)
+	links := newLinkCollector(filename)
+	b := newSectionBuilder(doc, 0)
+	fence := ""
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = "```"
+		case strings.HasPrefix(trimmed, "~~~"):
+			fence = "~~~"
+		default:
+			if level, text := markdownHeading(trimmed); level > 0 && text != "" {
+				b.heading(level, text)
+			}
+			links.scan(line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	doc = b.finish()
+	if len(links.links) > 0 {
+		fields[LinksFieldName] = links.links
+	}
+	if len(links.wikiLinks) > 0 {
+		fields[WikiLinksFieldName] = links.wikiLinks
+	}
+	if len(fields) > 0 {
+		doc.Extra = fields
+	}
+	return doc, nil
+}
+
+// WikiLinkName is the name a [[wikilink]] to the file at filename uses, in
+// the form stored in the wikilinks field.
+func WikiLinkName(filename string) string {
+	name := path.Base(filename)
+	if ext := path.Ext(name); strings.EqualFold(ext, ".md") || strings.EqualFold(ext, ".markdown") {
+		name = name[:len(name)-len(ext)]
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// linkCollector gathers the distinct links of a note in order.
+type linkCollector struct {
+	dir       string
+	links     []string
+	wikiLinks []string
+	seen      map[string]bool
+}
+
+func newLinkCollector(filename string) *linkCollector {
+	return &linkCollector{dir: path.Dir(filename), seen: make(map[string]bool)}
+}
+
+func (c *linkCollector) scan(line string) {
+	for _, m := range wikiLinkPattern.FindAllStringSubmatch(line, -1) {
+		if name := WikiLinkName(m[1]); name != "" && !c.seen["[["+name] {
+			c.seen["[["+name] = true
+			c.wikiLinks = append(c.wikiLinks, name)
+		}
+	}
+	for _, m := range markdownLinkPattern.FindAllStringSubmatch(line, -1) {
+		target := m[1]
+		// only links to other files next to the note, not to the web or an anchor
+		if strings.HasPrefix(target, "#") || strings.HasPrefix(target, "/") || strings.Contains(target, ":") {
+			continue
+		}
+		if i := strings.IndexAny(target, "#?"); i >= 0 {
+			target = target[:i]
+		}
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		target = path.Join(c.dir, target)
+		if !c.seen[target] {
+			c.seen[target] = true
+			c.links = append(c.links, target)
+		}
+	}
+}
+
+// markdownHeading returns the level and text of an ATX heading line, or 0.
+func markdownHeading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, ""
+	}
+	rest := line[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, ""
+	}
+	// an optional closing sequence of #s is not part of the text
+	rest = strings.TrimSpace(rest)
+	if trimmed := strings.TrimRight(rest, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		rest = strings.TrimSpace(trimmed)
+	}
+	return level, rest
+}
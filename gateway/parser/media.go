@@ -0,0 +1,409 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+	MediaVideo = "video"
+)
+
+const (
+	MediaFieldName     = "media"
+	CameraFieldName    = "camera"
+	TakenFieldName     = "taken"
+	LatitudeFieldName  = "latitude"
+	LongitudeFieldName = "longitude"
+	ArtistFieldName    = "artist"
+	AlbumFieldName     = "album"
+	GenreFieldName     = "genre"
+	YearFieldName      = "year"
+	DurationFieldName  = "duration"
+	WidthFieldName     = "width"
+	HeightFieldName    = "height"
+)
+
+var mediaKinds = map[string]string{
+	".jpg": MediaImage, ".jpeg": MediaImage, ".png": MediaImage, ".gif": MediaImage,
+	".tif": MediaImage, ".tiff": MediaImage,
+	".mp3": MediaAudio, ".flac": MediaAudio, ".m4a": MediaAudio, ".ogg": MediaAudio,
+	".wav": MediaAudio,
+	".mp4": MediaVideo, ".m4v": MediaVideo, ".mov": MediaVideo,
+}
+
+// Media is the metadata of an image, audio or video file. Zero values are unknown.
+type Media struct {
+	Kind   string
+	Camera string
+	Taken  time.Time
+	// HasGPS tells a location at 0,0 from none
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+	Title     string
+	Artist    string
+	Album     string
+	Genre     string
+	Year      int
+	Duration  time.Duration
+	Width     int
+	Height    int
+}
+
+// IsMedia reports whether filename is an image, audio or video file whose
+// metadata ParseMedia reads.
+func IsMedia(filename string) bool {
+	_, ok := mediaKinds[GetTypeFromName(filename)]
+	return ok
+}
+
+// ParseMedia reads the EXIF, ID3 and container metadata of a media file.
+// Metadata that is missing or damaged is left out rather than failing the file.
+func ParseMedia(data []byte, filename string) (*Media, error) {
+	kind, ok := mediaKinds[GetTypeFromName(filename)]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	m := &Media{Kind: kind}
+	switch kind {
+	case MediaImage:
+		m.readImage(data)
+	default:
+		m.readTags(data)
+		switch GetTypeFromName(filename) {
+		case ".flac":
+			m.readFlac(data)
+		case ".wav":
+			m.readWav(data)
+		case ".mp3":
+			m.readMp3(data)
+		case ".m4a", ".mp4", ".m4v", ".mov":
+			m.readMp4(data)
+		}
+	}
+	return m, nil
+}
+
+// Content renders the metadata as "name: value" lines so a query for an
+// artist or camera finds the file.
+func (m *Media) Content() string {
+	lines := make([]string, 0)
+	add := func(name, value string) {
+		if value != "" {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	add(TitleFieldName, m.Title)
+	add(ArtistFieldName, m.Artist)
+	add(AlbumFieldName, m.Album)
+	add(GenreFieldName, m.Genre)
+	if m.Year > 0 {
+		add(YearFieldName, fmt.Sprint(m.Year))
+	}
+	add(CameraFieldName, m.Camera)
+	if !m.Taken.IsZero() {
+		add(TakenFieldName, m.Taken.Format("2006-01-02 15:04:05"))
+	}
+	if m.Width > 0 && m.Height > 0 {
+		add("resolution", fmt.Sprintf("%dx%d", m.Width, m.Height))
+	}
+	if m.Duration > 0 {
+		add(DurationFieldName, m.Duration.Round(time.Second).String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Fields returns the metadata stored on the Files document, times in unix
+// seconds and the duration in seconds so they can be filtered by range.
+func (m *Media) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		MediaFieldName: m.Kind,
+	}
+	set := func(name, value string) {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	set(TitleFieldName, m.Title)
+	set(ArtistFieldName, m.Artist)
+	set(AlbumFieldName, m.Album)
+	set(GenreFieldName, m.Genre)
+	set(CameraFieldName, m.Camera)
+	if m.Year > 0 {
+		fields[YearFieldName] = m.Year
+	}
+	if !m.Taken.IsZero() {
+		fields[TakenFieldName] = m.Taken.Unix()
+	}
+	if m.HasGPS {
+		fields[LatitudeFieldName] = m.Latitude
+		fields[LongitudeFieldName] = m.Longitude
+	}
+	if m.Duration > 0 {
+		fields[DurationFieldName] = math.Round(m.Duration.Seconds()*1000) / 1000
+	}
+	if m.Width > 0 && m.Height > 0 {
+		fields[WidthFieldName] = m.Width
+		fields[HeightFieldName] = m.Height
+	}
+	return fields
+}
+
+// readImage reads the size of the image and the camera, time and location
+// of photos with EXIF data.
+func (m *Media) readImage(data []byte) {
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		m.Width, m.Height = cfg.Width, cfg.Height
+	}
+	// the exif decoder panics on some corrupt tiff directories
+	defer func() {
+		recover()
+	}()
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	camera := make([]string, 0, 2)
+	for _, name := range []exif.FieldName{exif.Make, exif.Model} {
+		if t, err := x.Get(name); err == nil {
+			if s, err := t.StringVal(); err == nil && strings.TrimSpace(s) != "" {
+				camera = append(camera, strings.TrimSpace(s))
+			}
+		}
+	}
+	// models usually repeat the make, "Canon Canon EOS 5D" reads badly
+	if len(camera) == 2 && strings.HasPrefix(strings.ToLower(camera[1]), strings.ToLower(camera[0])) {
+		camera = camera[1:]
+	}
+	m.Camera = strings.Join(camera, " ")
+	if taken, err := x.DateTime(); err == nil {
+		m.Taken = taken
+	}
+	if lat, long, err := x.LatLong(); err == nil && !math.IsNaN(lat) && !math.IsNaN(long) {
+		m.HasGPS, m.Latitude, m.Longitude = true, lat, long
+	}
+	if m.Width == 0 {
+		if w, err := x.Get(exif.PixelXDimension); err == nil {
+			m.Width, _ = w.Int(0)
+		}
+		if h, err := x.Get(exif.PixelYDimension); err == nil {
+			m.Height, _ = h.Int(0)
+		}
+	}
+}
+
+// readTags reads ID3, MP4, FLAC and Ogg tags.
+func (m *Media) readTags(data []byte) {
+	defer func() {
+		recover()
+	}()
+	t, err := tag.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	m.Title = strings.TrimSpace(t.Title())
+	m.Artist = strings.TrimSpace(t.Artist())
+	if m.Artist == "" {
+		m.Artist = strings.TrimSpace(t.AlbumArtist())
+	}
+	m.Album = strings.TrimSpace(t.Album())
+	m.Genre = strings.TrimSpace(t.Genre())
+	m.Year = t.Year()
+}
+
+// readFlac reads the duration from the STREAMINFO block, which is always
+// the first metadata block.
+func (m *Media) readFlac(data []byte) {
+	if len(data) < 26 || !bytes.HasPrefix(data, []byte("fLaC")) || data[4]&0x7F != 0 {
+		return
+	}
+	b := data[8:]
+	rate := int64(b[10])<<12 | int64(b[11])<<4 | int64(b[12])>>4
+	samples := int64(b[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(b[14:]))
+	m.Duration = mediaDuration(samples, rate)
+}
+
+// readWav reads the duration from the byte rate of the fmt chunk and the
+// size of the data chunk.
+func (m *Media) readWav(data []byte) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return
+	}
+	var byteRate uint32
+	for p := 12; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		body := data[p+8:]
+		switch {
+		case id == "fmt " && len(body) >= 12:
+			byteRate = binary.LittleEndian.Uint32(body[8:])
+		case id == "data" && byteRate > 0:
+			m.Duration = mediaDuration(int64(size), int64(byteRate))
+			return
+		}
+		if size < 0 || size > len(body) {
+			return
+		}
+		// chunks are padded to even sizes
+		p += 8 + size + size%2
+	}
+}
+
+// readMp4 reads the duration from the movie header and the resolution from
+// the header of the first track with a picture.
+func (m *Media) readMp4(data []byte) {
+	eachMp4Box(data, func(typ string, body []byte) bool {
+		switch typ {
+		case "moov", "trak":
+			return true
+		case "mvhd":
+			if len(body) >= 32 && body[0] == 1 {
+				scale := binary.BigEndian.Uint32(body[20:])
+				m.Duration = mediaDuration(int64(binary.BigEndian.Uint64(body[24:])), int64(scale))
+			} else if len(body) >= 20 {
+				scale := binary.BigEndian.Uint32(body[12:])
+				m.Duration = mediaDuration(int64(binary.BigEndian.Uint32(body[16:])), int64(scale))
+			}
+		case "tkhd":
+			// width and height are 16.16 fixed point after the matrix
+			offset := 76
+			if len(body) > 0 && body[0] == 1 {
+				offset = 88
+			}
+			if m.Width == 0 && len(body) >= offset+8 {
+				m.Width = int(binary.BigEndian.Uint32(body[offset:]) >> 16)
+				m.Height = int(binary.BigEndian.Uint32(body[offset+4:]) >> 16)
+			}
+		}
+		return false
+	})
+}
+
+// mediaDuration is the duration of n units at rate units per second, zero
+// when the values are invalid.
+func mediaDuration(n, rate int64) time.Duration {
+	if n <= 0 || rate <= 0 {
+		return 0
+	}
+	seconds := float64(n) / float64(rate)
+	if seconds > math.MaxInt64/float64(time.Second) {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// eachMp4Box calls fn with the type and body of the boxes in data, and of
+// the boxes inside a box when fn returns true.
+func eachMp4Box(data []byte, fn func(typ string, body []byte) bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		if body := data[header:size]; fn(typ, body) {
+			eachMp4Box(body, fn)
+		}
+		data = data[size:]
+	}
+}
+
+// Bit rates in kbps and sample rates of MPEG audio layer III, by the index
+// in the frame header.
+var (
+	mp3BitRates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = map[byte][3]int{
+		3: {44100, 48000, 32000},
+		2: {22050, 24000, 16000},
+		0: {11025, 12000, 8000},
+	}
+)
+
+// readMp3 reads the duration from the frame count of a Xing or Info header,
+// or estimates it from the bit rate of the first frame for constant bit
+// rate files.
+func (m *Media) readMp3(data []byte) {
+	p := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		p = 10 + size
+		if data[5]&0x10 != 0 {
+			p += 10
+		}
+	}
+	for ; p+4 <= len(data); p++ {
+		if data[p] == 0xFF && data[p+1]&0xE0 == 0xE0 {
+			break
+		}
+	}
+	if p+4 > len(data) {
+		return
+	}
+	version := (data[p+1] >> 3) & 3
+	layer := (data[p+1] >> 1) & 3
+	rates, ok := mp3SampleRates[version]
+	if !ok || layer != 1 || (data[p+2]>>2)&3 == 3 {
+		return
+	}
+	table, samplesPerFrame := 0, 1152
+	if version != 3 {
+		table, samplesPerFrame = 1, 576
+	}
+	bitRate := mp3BitRates[table][data[p+2]>>4] * 1000
+	sampleRate := rates[(data[p+2]>>2)&3]
+	mono := data[p+3]>>6 == 3
+
+	// the Xing header follows the side information of the first frame
+	side := 32
+	switch {
+	case version == 3 && mono:
+		side = 17
+	case version != 3 && !mono:
+		side = 17
+	case version != 3 && mono:
+		side = 9
+	}
+	if x := p + 4 + side; x+12 <= len(data) {
+		id := string(data[x : x+4])
+		if (id == "Xing" || id == "Info") && data[x+7]&1 != 0 {
+			frames := int64(binary.BigEndian.Uint32(data[x+8:]))
+			m.Duration = mediaDuration(frames*int64(samplesPerFrame), int64(sampleRate))
+			return
+		}
+	}
+	if bitRate == 0 {
+		return
+	}
+	end := len(data)
+	if end-128 >= p && string(data[end-128:end-125]) == "TAG" {
+		end -= 128
+	}
+	m.Duration = mediaDuration(int64(end-p)*8, int64(bitRate))
+}
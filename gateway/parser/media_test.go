@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exifJpeg returns a jpeg with an EXIF segment holding the camera and the
+// time the photo was taken.
+func exifJpeg(t *testing.T, maker, model, taken string) []byte {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 3)), nil); err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	// header, IFD0 with 3 entries at 8, Exif IFD with 1 entry at 50, strings at 68
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	strs := []string{maker + "\x00", model + "\x00", taken + "\x00"}
+	offsets := []uint32{68, 68 + uint32(len(strs[0])), 68 + uint32(len(strs[0])+len(strs[1]))}
+	entry := func(tag, typ uint16, count, value uint32) {
+		b := make([]byte, 12)
+		le.PutUint16(b, tag)
+		le.PutUint16(b[2:], typ)
+		le.PutUint32(b[4:], count)
+		le.PutUint32(b[8:], value)
+		tiff = append(tiff, b...)
+	}
+	tiff = append(tiff, 3, 0)
+	entry(0x010F, 2, uint32(len(strs[0])), offsets[0])
+	entry(0x0110, 2, uint32(len(strs[1])), offsets[1])
+	entry(0x8769, 4, 1, 50)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, 1, 0)
+	entry(0x9003, 2, uint32(len(strs[2])), offsets[2])
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, strings.Join(strs, "")...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(out[4:], uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, img.Bytes()[2:]...)
+}
+
+func id3Frame(id, text string) []byte {
+	b := make([]byte, 11, 11+len(text))
+	copy(b, id)
+	binary.BigEndian.PutUint32(b[4:], uint32(len(text)+1))
+	return append(b, text...)
+}
+
+func mp4Box(typ string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, uint32(8+len(data)))
+	copy(b[4:], typ)
+	return append(b, data...)
+}
+
+func TestParseMedia(t *testing.T) {
+	photo, err := ParseMedia(exifJpeg(t, "Canon", "Canon EOS 5D", "2023:01:02 15:04:05"), "/data/IMG_0001.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photo.Kind != MediaImage || photo.Camera != "Canon EOS 5D" || photo.Width != 4 || photo.Height != 3 {
+		t.Fatalf("unexpected photo %+v", photo)
+	}
+	if photo.Taken.Format("2006-01-02 15:04:05") != "2023-01-02 15:04:05" {
+		t.Fatalf("unexpected time taken %v", photo.Taken)
+	}
+	if !strings.Contains(photo.Content(), "camera: Canon EOS 5D") {
+		t.Fatalf("unexpected content %q", photo.Content())
+	}
+
+	// ID3v2.3 tag and one second of 128kbps frames
+	frames := bytes.Join([][]byte{id3Frame("TIT2", "Bohemian Rhapsody"), id3Frame("TPE1", "Queen"), id3Frame("TALB", "A Night at the Opera")}, nil)
+	mp3 := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}
+	mp3 = append(mp3, frames...)
+	audio := make([]byte, 16000)
+	copy(audio, []byte{0xFF, 0xFB, 0x90, 0x00})
+	song, err := ParseMedia(append(mp3, audio...), "song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := song.Fields()
+	if fields[ArtistFieldName] != "Queen" || fields[AlbumFieldName] != "A Night at the Opera" || fields[TitleFieldName] != "Bohemian Rhapsody" {
+		t.Fatalf("unexpected song fields %v", fields)
+	}
+	if fields[DurationFieldName] != 1.0 || fields[MediaFieldName] != MediaAudio {
+		t.Fatalf("unexpected song fields %v", fields)
+	}
+
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 5000)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1280<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 720<<16)
+	mp4 := append(mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")), mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("trak", mp4Box("tkhd", tkhd)))...)
+	movie, err := ParseMedia(mp4, "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Kind != MediaVideo || movie.Duration != 5*time.Second || movie.Width != 1280 || movie.Height != 720 {
+		t.Fatalf("unexpected movie %+v", movie)
+	}
+
+	wav := []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00")
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint32(fmtChunk[8:], 8000)
+	wav = append(wav, fmtChunk...)
+	wav = append(wav, "data\x80\x3e\x00\x00"...)
+	wav = append(wav, make([]byte, 16000)...)
+	sound, err := ParseMedia(wav, "memo.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sound.Duration != 2*time.Second {
+		t.Fatalf("unexpected duration %v", sound.Duration)
+	}
+
+	if _, err := ParseMedia([]byte("text"), "a.txt"); err != ErrUnsupported {
+		t.Fatalf("expected unsupported, got %v", err)
+	}
+	if broken, err := ParseMedia([]byte("ID3\x03\x00\x00\x7F\x7F"), "broken.mp3"); err != nil || broken.Duration != 0 {
+		t.Fatalf("unexpected %+v %v", broken, err)
+	}
+}
@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// MAPI property ids read from Outlook .msg files.
+const (
+	mapiSubject          = 0x0037
+	mapiClientSubmitTime = 0x0039
+	mapiSenderName       = 0x0C1A
+	mapiSenderEmail      = 0x0C1F
+	mapiDisplayTo        = 0x0E04
+	mapiDeliveryTime     = 0x0E06
+	mapiBody             = 0x1000
+	mapiBodyHtml         = 0x1013
+	mapiAttachData       = 0x3701
+	mapiAttachFilename   = 0x3704
+	mapiAttachLongName   = 0x3707
+	mapiSenderSmtp       = 0x5D01
+)
+
+// MAPI property types.
+const (
+	mapiString8 = 0x001E
+	mapiUnicode = 0x001F
+	mapiSysTime = 0x0040
+	mapiBinary  = 0x0102
+)
+
+const (
+	msgPropertyPrefix   = "__substg1.0_"
+	msgPropertiesStream = "__properties_version1.0"
+	msgAttachPrefix     = "__attach_version1.0_"
+	// msgPropertiesHeader is the size of the header of the top level
+	// properties stream, before its 16 byte entries.
+	msgPropertiesHeader = 32
+)
+
+// msgProperties holds the variable length properties of one storage by id.
+type msgProperties map[uint16][]byte
+
+func (p msgProperties) text(id uint16) string {
+	if b, ok := p[id]; ok {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	return ""
+}
+
+// ParseMsg reads an Outlook .msg file, which keeps every MAPI property of the
+// message in its own stream of a compound file.
+func ParseMsg(data []byte) (*Mail, error) {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	message := make(msgProperties)
+	attachments := make(map[string]msgProperties)
+	order := make([]string, 0)
+	var times []byte
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		var props msgProperties
+		switch {
+		case len(entry.Path) == 0:
+			props = message
+		case len(entry.Path) == 1 && strings.HasPrefix(entry.Path[0], msgAttachPrefix):
+			props = attachments[entry.Path[0]]
+			if props == nil {
+				props = make(msgProperties)
+				attachments[entry.Path[0]] = props
+				order = append(order, entry.Path[0])
+			}
+		default:
+			// recipients and embedded messages
+			continue
+		}
+		if len(entry.Path) == 0 && entry.Name == msgPropertiesStream {
+			if times, err = ioutil.ReadAll(entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		id, typ, ok := msgPropertyTag(entry.Name)
+		if !ok || (typ != mapiString8 && typ != mapiUnicode && typ != mapiBinary) {
+			continue
+		}
+		b, err := ioutil.ReadAll(entry)
+		if err != nil {
+			return nil, err
+		}
+		props[id] = msgValue(b, typ)
+	}
+
+	m := &Mail{
+		Subject: message.text(mapiSubject),
+		To:      message.text(mapiDisplayTo),
+		Body:    strings.TrimSpace(message.text(mapiBody)),
+	}
+	sender := message.text(mapiSenderSmtp)
+	if sender == "" {
+		sender = message.text(mapiSenderEmail)
+	}
+	if name := message.text(mapiSenderName); name != "" && name != sender {
+		sender = name + " <" + sender + ">"
+	}
+	m.From = sender
+	if m.Body == "" {
+		m.Body = htmlToText(decodeCharset(message[mapiBodyHtml], ""))
+	}
+	m.Date = msgTime(times, mapiClientSubmitTime)
+	if m.Date.IsZero() {
+		m.Date = msgTime(times, mapiDeliveryTime)
+	}
+	for _, storage := range order {
+		props := attachments[storage]
+		data, ok := props[mapiAttachData]
+		if !ok {
+			continue
+		}
+		name := props.text(mapiAttachLongName)
+		if name == "" {
+			name = props.text(mapiAttachFilename)
+		}
+		m.Attachments = append(m.Attachments, MailAttachment{Name: name, Data: data})
+	}
+	return m, nil
+}
+
+// msgPropertyTag splits a stream name like __substg1.0_0037001F into the
+// property id and type.
+func msgPropertyTag(name string) (uint16, uint16, bool) {
+	if !strings.HasPrefix(name, msgPropertyPrefix) || len(name) != len(msgPropertyPrefix)+8 {
+		return 0, 0, false
+	}
+	tag, err := strconv.ParseUint(name[len(msgPropertyPrefix):], 16, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint16(tag >> 16), uint16(tag), true
+}
+
+// msgValue decodes string properties to UTF-8 and keeps binary ones.
+func msgValue(b []byte, typ uint16) []byte {
+	switch typ {
+	case mapiUnicode:
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(b[i*2:])
+		}
+		return []byte(string(utf16.Decode(units)))
+	case mapiString8:
+		return []byte(decodeCharset(b, ""))
+	}
+	return b
+}
+
+// msgTime finds a FILETIME property in the fixed size entries of the top
+// level properties stream.
+func msgTime(stream []byte, id uint16) time.Time {
+	for p := msgPropertiesHeader; p+16 <= len(stream); p += 16 {
+		tag := binary.LittleEndian.Uint32(stream[p:])
+		if uint16(tag>>16) != id || uint16(tag) != mapiSysTime {
+			continue
+		}
+		ft := int64(binary.LittleEndian.Uint64(stream[p+8:]))
+		// FILETIME counts 100ns intervals since 1601
+		const epochDiff = 116444736000000000
+		if ft <= epochDiff {
+			return time.Time{}
+		}
+		return time.Unix(0, (ft-epochDiff)*100).UTC()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pdfOf builds a minimal pdf with one Helvetica text object per page.
+func pdfOf(pages ...string) []byte {
+	var buf bytes.Buffer
+	offsets := make([]int, 0)
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i*2)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	for i, text := range pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+i*2))
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// wordStreams builds a WordDocument stream holding text as a single
+// compressed piece and the 0Table stream with its piece table.
+func wordStreams(text string) ([]byte, []byte) {
+	const textOffset = 0x200
+	wordDocument := make([]byte, textOffset+len(text))
+	copy(wordDocument[textOffset:], text)
+	binary.LittleEndian.PutUint32(wordDocument[fibCcpTextOffset:], uint32(len(text)))
+
+	table := make([]byte, 21)
+	table[0] = 0x02
+	binary.LittleEndian.PutUint32(table[1:], 16)
+	binary.LittleEndian.PutUint32(table[9:], uint32(len(text)))
+	binary.LittleEndian.PutUint32(table[15:], 0x40000000|textOffset*2)
+	binary.LittleEndian.PutUint32(wordDocument[fibFcClxOffset+4:], uint32(len(table)))
+	return wordDocument, table
+}
+
+const docxHeader = `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`
+
+func TestDocText(t *testing.T) {
+	wordDocument, table := wordStreams("Total \x13 PAGE \x143\x15 pages\rnext\x07cell\x0cEnd")
+	content, err := docText(wordDocument, table, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Total 3 pages\nnext\tcell"+PageSeparator+"End" {
+		t.Fatalf("unexpected content %q", content)
+	}
+	if _, err := docText(wordDocument[:0x100], table, nil); err != ErrWordDocument {
+		t.Fatalf("expected ErrWordDocument, got %v", err)
+	}
+}
+
+func TestParseNative(t *testing.T) {
+	docx := zipOf(t, map[string]string{
+		"word/document.xml": docxHeader + `<w:p><w:r><w:t>Hello</w:t><w:tab/><w:t>world</w:t></w:r></w:p>
+<w:p><w:r><w:br w:type="page"/><w:lastRenderedPageBreak/><w:t>second</w:t></w:r></w:p></w:body></w:document>`,
+	})
+	content, err := parseNative(context.Background(), docx, MimeDocx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hello\tworld"+PageSeparator+"second" {
+		t.Fatalf("unexpected docx content %q", content)
+	}
+
+	content, err = parseNative(context.Background(), pdfOf("first page", "second page"), MimePdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := strings.Split(content, PageSeparator)
+	if len(pages) != 2 || !strings.Contains(pages[0], "first") || !strings.Contains(pages[1], "second") {
+		t.Fatalf("unexpected pdf pages %q", pages)
+	}
+
+	if _, err := parseNative(context.Background(), []byte("%PDF-1.4 truncated"), MimePdf); err == nil {
+		t.Fatal("expected error for a truncated pdf")
+	}
+}
+
+func TestConvertDocumentNotOle(t *testing.T) {
+	data := zipOf(t, map[string]string{"a.txt": "not a doc"})
+	defer func(backend string) { Backend = backend }(Backend)
+	for _, backend := range []string{BackendDocconv, BackendNative} {
+		Backend = backend
+		if _, err := convertDocument(context.Background(), data, MimeDoc, "a.doc"); err != ErrNotOle {
+			t.Fatalf("%s: expected ErrNotOle, got %v", backend, err)
+		}
+	}
+}
+
+func FuzzParseNative(f *testing.F) {
+	f.Add(pdfOf("fuzz"), MimePdf)
+	f.Add(zipOf(f, map[string]string{"word/document.xml": docxHeader + `<w:p><w:r><w:t>fuzz</w:t></w:r></w:p></w:body></w:document>`}), MimeDocx)
+	f.Fuzz(func(t *testing.T, data []byte, mimeType string) {
+		// only panics fail, malformed input is expected to return an error
+		parseNative(context.Background(), data, mimeType)
+	})
+}
+
+func FuzzDocText(f *testing.F) {
+	wordDocument, table := wordStreams("fuzz\rtext")
+	f.Add(wordDocument, table)
+	f.Fuzz(func(t *testing.T, wordDocument, table []byte) {
+		docText(wordDocument, table, table)
+	})
+}
+
+func BenchmarkParsePdf(b *testing.B) {
+	pages := make([]string, 50)
+	for i := range pages {
+		pages[i] = fmt.Sprintf("page %d of the benchmark document", i)
+	}
+	data := pdfOf(pages...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseNative(context.Background(), data, MimePdf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseDocx(b *testing.B) {
+	body := strings.Repeat(`<w:p><w:r><w:t>benchmark paragraph text</w:t></w:r></w:p>`, 2000)
+	data := zipOf(b, map[string]string{"word/document.xml": docxHeader + body + `</w:body></w:document>`})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseNative(context.Background(), data, MimeDocx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	MimeOdt = "application/vnd.oasis.opendocument.text"
+	MimeOds = "application/vnd.oasis.opendocument.spreadsheet"
+	MimeOdp = "application/vnd.oasis.opendocument.presentation"
+)
+
+const (
+	odfTextNamespace  = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	odfDrawNamespace  = "urn:oasis:names:tc:opendocument:xmlns:drawing:1.0"
+	odfTableNamespace = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+)
+
+// maxOdfRepeat caps how often repeated content is expanded. LibreOffice sets
+// table:number-*-repeated to huge values for the trailing empty rows and columns.
+const maxOdfRepeat = 256
+
+func init() {
+	RegisterDocument(DocumentParserFunc(parseOdt), []string{".odt"}, []string{MimeOdt})
+	RegisterDocument(DocumentParserFunc(parseOdp), []string{".odp"}, []string{MimeOdp})
+}
+
+// parseOdt reads the document into sections split at its headings and at
+// the soft page breaks LibreOffice records when saving.
+func parseOdt(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	files, err := zipFiles(data)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := openZipEntry(files, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	doc := &Document{}
+	readOdfMeta(files, doc)
+	b := newSectionBuilder(doc, 1)
+	var para bytes.Buffer
+	level := 1
+	d := xml.NewDecoder(rc)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == odfTextNamespace && t.Name.Local == "soft-page-break" {
+				b.WriteString(para.String())
+				para.Reset()
+				b.breakPage()
+				continue
+			}
+			if t.Name.Space == odfTextNamespace && t.Name.Local == "h" {
+				level = odfIntAttr(t, odfTextNamespace, "outline-level")
+			}
+			writeOdfSpacing(&para, t)
+		case xml.EndElement:
+			if t.Name.Space != odfTextNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "h":
+				if text := strings.TrimSpace(para.String()); text != "" {
+					b.heading(level, text)
+				}
+				fallthrough
+			case "p":
+				b.WriteString(para.String())
+				b.WriteString("\n")
+				para.Reset()
+			}
+		case xml.CharData:
+			para.Write(t)
+		}
+	}
+	return b.finish(), nil
+}
+
+// parseOdp returns one page per draw:page, which is a slide in a presentation.
+func parseOdp(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	files, err := zipFiles(data)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := openZipEntry(files, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	slides, err := odpSlides(rc)
+	if err != nil {
+		return nil, err
+	}
+	doc := pagedDocument(slides)
+	readOdfMeta(files, doc)
+	return doc, nil
+}
+
+func odfContent(f io.Reader) (io.ReadCloser, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	files, err := zipFiles(data)
+	if err != nil {
+		return nil, err
+	}
+	return openZipEntry(files, "content.xml")
+}
+
+// odpSlides extracts the text of every draw:page in content.xml.
+func odpSlides(r io.Reader) ([]string, error) {
+	slides := make([]string, 0)
+	var sb bytes.Buffer
+	started := false
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == odfDrawNamespace && t.Name.Local == "page" {
+				if started {
+					slides = append(slides, strings.TrimSpace(sb.String()))
+					sb.Reset()
+				}
+				started = true
+				continue
+			}
+			writeOdfSpacing(&sb, t)
+		case xml.EndElement:
+			if t.Name.Space == odfTextNamespace && (t.Name.Local == "p" || t.Name.Local == "h") {
+				sb.WriteString("\n")
+			}
+		case xml.CharData:
+			if started {
+				sb.Write(t)
+			}
+		}
+	}
+	if started {
+		slides = append(slides, strings.TrimSpace(sb.String()))
+	}
+	return slides, nil
+}
+
+// writeOdfSpacing expands the elements ODF uses for whitespace inside paragraphs.
+func writeOdfSpacing(sb *bytes.Buffer, t xml.StartElement) {
+	if t.Name.Space != odfTextNamespace {
+		return
+	}
+	switch t.Name.Local {
+	case "s":
+		sb.WriteString(strings.Repeat(" ", capOdfRepeat(odfIntAttr(t, odfTextNamespace, "c"))))
+	case "tab":
+		sb.WriteString("\t")
+	case "line-break":
+		sb.WriteString("\n")
+	}
+}
+
+// odfIntAttr reads a positive count attribute such as a repeat or a level,
+// which defaults to 1.
+func odfIntAttr(t xml.StartElement, space, local string) int {
+	for _, attr := range t.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			if n, err := strconv.Atoi(attr.Value); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 1
+}
+
+// odfMeta is meta.xml of OpenDocument packages.
+type odfMeta struct {
+	Title          string `xml:"meta>title"`
+	Creator        string `xml:"meta>creator"`
+	InitialCreator string `xml:"meta>initial-creator"`
+	Language       string `xml:"meta>language"`
+}
+
+func readOdfMeta(files map[string]*zip.File, doc *Document) {
+	var meta odfMeta
+	if err := decodeZipXml(files, "meta.xml", &meta); err != nil {
+		return
+	}
+	doc.Title = strings.TrimSpace(meta.Title)
+	doc.Author = strings.TrimSpace(meta.Creator)
+	if doc.Author == "" {
+		doc.Author = strings.TrimSpace(meta.InitialCreator)
+	}
+	doc.Language = strings.TrimSpace(meta.Language)
+}
+
+func capOdfRepeat(n int) int {
+	if n > maxOdfRepeat {
+		return maxOdfRepeat
+	}
+	return n
+}
+
+// capSheetIndex advances a row or column position by n, no further than max.
+func capSheetIndex(pos, n, max int) int {
+	if n > max-pos {
+		return max
+	}
+	return pos + n
+}
+
+// parseOds reads the sheets of an OpenDocument spreadsheet.
+func parseOds(ctx context.Context, data []byte) ([]Sheet, error) {
+	rc, err := odfContent(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	sheets := make([]Sheet, 0)
+	var (
+		sheet   *Sheet
+		row     SheetRow
+		rowNum  = 0
+		rowRep  = 1
+		col     = 0
+		colRep  = 1
+		inCell  = false
+		cell    bytes.Buffer
+		textEnd = false
+	)
+	d := xml.NewDecoder(rc)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == odfTableNamespace {
+				switch t.Name.Local {
+				case "table":
+					name := ""
+					for _, attr := range t.Attr {
+						if attr.Name.Space == odfTableNamespace && attr.Name.Local == "name" {
+							name = attr.Value
+						}
+					}
+					sheets = append(sheets, Sheet{Name: name})
+					sheet = &sheets[len(sheets)-1]
+					rowNum = 0
+				case "table-row":
+					row = SheetRow{Row: rowNum + 1}
+					rowRep = odfIntAttr(t, odfTableNamespace, "number-rows-repeated")
+					col = 0
+				case "table-cell", "covered-table-cell":
+					inCell = true
+					textEnd = false
+					cell.Reset()
+					colRep = odfIntAttr(t, odfTableNamespace, "number-columns-repeated")
+				}
+				continue
+			}
+			if inCell {
+				if t.Name.Space == odfTextNamespace && t.Name.Local == "p" && textEnd {
+					cell.WriteString("\n")
+				}
+				writeOdfSpacing(&cell, t)
+			}
+		case xml.EndElement:
+			if t.Name.Space == odfTextNamespace && t.Name.Local == "p" {
+				textEnd = true
+			}
+			if t.Name.Space != odfTableNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				if text := cell.String(); text != "" {
+					for i := 0; i < capOdfRepeat(colRep) && col+i < maxSheetColumns; i++ {
+						row.setCell(col+i, text)
+					}
+				}
+				// repeats are valid up to any size, stop counting at the limit
+				col = capSheetIndex(col, colRep, maxSheetColumns)
+			case "table-row":
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				if sheet != nil && len(row.Cells) > 0 {
+					for i := 0; i < capOdfRepeat(rowRep) && row.Row+i <= maxSheetRows; i++ {
+						r := SheetRow{Row: row.Row + i, Cells: row.Cells}
+						sheet.Rows = append(sheet.Rows, r)
+					}
+				}
+				rowNum = capSheetIndex(rowNum, rowRep, maxSheetRows)
+			}
+		case xml.CharData:
+			if inCell {
+				cell.Write(t)
+			}
+		}
+	}
+	return sheets, nil
+}
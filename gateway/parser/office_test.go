@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func zipOf(t testing.TB, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// OpenDocument requires the mimetype entry to come first
+	if mimeType, ok := files["mimetype"]; ok {
+		w, _ := zw.Create("mimetype")
+		w.Write([]byte(mimeType))
+	}
+	for name, body := range files {
+		if name == "mimetype" {
+			continue
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParsePptx(t *testing.T) {
+	data := zipOf(t, map[string]string{
+		"ppt/presentation.xml": `<p:presentation xmlns:p="p" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<p:sldIdLst><p:sldId r:id="rId3"/><p:sldId r:id="rId2"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships><Relationship Id="rId2" Target="slides/slide1.xml"/><Relationship Id="rId3" Target="slides/slide2.xml"/></Relationships>`,
+		"ppt/slides/slide1.xml":           `<p:sld xmlns:p="p" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:p><a:r><a:t>Roadmap</a:t></a:r></a:p></p:sld>`,
+		"ppt/slides/slide2.xml":           `<p:sld xmlns:p="p" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:p><a:r><a:t>Welcome</a:t></a:r><a:r><a:t> all</a:t></a:r></a:p></p:sld>`,
+	})
+	content, err := ParseDoc(bytes.NewReader(data), "deck.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Welcome all"+PageSeparator+"Roadmap" {
+		t.Fatalf("unexpected content %q", content)
+	}
+	if page := LocatePage(content, []string{"roadmap"}); page != 2 {
+		t.Fatalf("got page %d", page)
+	}
+}
+
+const odfHeader = `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:draw="urn:oasis:names:tc:opendocument:xmlns:drawing:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"><office:body>`
+
+func TestParseOdf(t *testing.T) {
+	odt := zipOf(t, map[string]string{
+		"mimetype":    MimeOdt,
+		"content.xml": odfHeader + `<office:text><text:h>Title</text:h><text:p>first<text:s text:c="2"/>page</text:p><text:p><text:soft-page-break/>second page</text:p></office:text></office:body></office:document-content>`,
+	})
+	content, err := ParseDoc(bytes.NewReader(odt), "notes.odt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := strings.Split(content, PageSeparator)
+	if len(pages) != 2 || pages[0] != "Title\nfirst  page" || pages[1] != "second page" {
+		t.Fatalf("unexpected odt pages %q", pages)
+	}
+
+	odp := zipOf(t, map[string]string{
+		"mimetype":    MimeOdp,
+		"content.xml": odfHeader + `<office:presentation><draw:page><text:p>one</text:p></draw:page><draw:page/><draw:page><text:p>three</text:p></draw:page></office:presentation></office:body></office:document-content>`,
+	})
+	content, err = ParseDoc(bytes.NewReader(odp), "talk.odp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "one"+PageSeparator+PageSeparator+"three" {
+		t.Fatalf("unexpected odp content %q", content)
+	}
+
+	ods := zipOf(t, map[string]string{
+		"mimetype": MimeOds,
+		"content.xml": odfHeader + `<office:spreadsheet><table:table table:name="Budget">
+<table:table-row><table:table-cell><text:p>item</text:p></table:table-cell><table:table-cell><text:p>cost</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="1000"/></table:table-row>
+<table:table-row><table:table-cell table:number-columns-repeated="2"/><table:table-cell><text:p>travel</text:p></table:table-cell></table:table-row>
+</table:table></office:spreadsheet></office:body></office:document-content>`,
+	})
+	sheets, err := ParseSpreadsheet(bytes.NewReader(ods), "budget.ods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := LocateInSheets(sheets, []string{"travel"}); ref != "Budget!C4" {
+		t.Fatalf("got %s from %+v", ref, sheets)
+	}
+}
+
+func TestParseRtf(t *testing.T) {
+	rtf := `{\rtf1\ansi\ansicpg936{\fonttbl{\f0 SimSun;}}{\*\generator Riched20;}\f0 Hello \b world\b0\par
+\'c4\'e3\'ba\'c3 \u20320?\page Next\tab page}`
+	content, err := ParseDoc(strings.NewReader(rtf), "memo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hello world\n你好 你"+PageSeparator+"Next\tpage" {
+		t.Fatalf("unexpected content %q", content)
+	}
+}
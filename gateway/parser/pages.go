@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"strings"
+)
+
+// PageSeparator separates pages and slides in the parsed content of paged
+// formats, so hits can still be traced back to the page they came from.
+const PageSeparator = "\f"
+
+func JoinPages(pages []string) string {
+	return strings.Join(pages, PageSeparator)
+}
+
+// LocatePage returns the 1-based page of content containing the most of
+// terms, or 0 when content has no page breaks or no page matches.
+func LocatePage(content string, terms []string) int {
+	if !strings.Contains(content, PageSeparator) {
+		return 0
+	}
+	best, bestPage := 0, 0
+	for i, page := range strings.Split(content, PageSeparator) {
+		if matched := countTerms(page, terms); matched > best {
+			best = matched
+			bestPage = i + 1
+		}
+	}
+	return bestPage
+}
+
+// countTerms counts the terms text contains, ignoring case.
+func countTerms(text string, terms []string) int {
+	text = strings.ToLower(text)
+	matched := 0
+	for _, term := range terms {
+		if term != "" && strings.Contains(text, strings.ToLower(term)) {
+			matched++
+		}
+	}
+	return matched
+}
+
+// PageUnit names the pages of a file type in locations, "slide" for decks and "page" otherwise.
+func PageUnit(fileType string) string {
+	switch fileType {
+	case ".pptx", ".odp":
+		return "slide"
+	}
+	return "page"
+}
@@ -1,49 +1,131 @@
 package parser
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"path"
 	"strings"
-
-	"code.sajari.com/docconv"
 )
 
-var ParseAble = map[string]bool{
-	".doc":      true,
-	".docx":     true,
-	".pdf":      true,
-	".txt":      true,
-	".md":       true,
-	".markdown": true,
+var ErrUnsupported = errors.New("unsupported format")
+
+// Parser extracts the plain text content of a document.
+type Parser interface {
+	Parse(f io.Reader, filename string) (string, error)
+}
+
+// FieldParser is implemented by parsers that extract structured data besides
+// the text. The fields are stored beside content on the Files document.
+type FieldParser interface {
+	Parser
+	ParseFields(f io.Reader, filename string) (string, map[string]interface{}, error)
 }
 
+// ContextParser is implemented by parsers that loop over large files, so
+// they stop once ctx is done instead of running on after a timeout.
+type ContextParser interface {
+	Parser
+	ParseContext(ctx context.Context, f io.Reader, filename string) (*Document, map[string]interface{}, error)
+}
+
+// ParserFunc adapts a plain function to the Parser interface.
+type ParserFunc func(f io.Reader, filename string) (string, error)
+
+func (fn ParserFunc) Parse(f io.Reader, filename string) (string, error) {
+	return fn(f, filename)
+}
+
+// IsParseAble reports whether filename has an extension with a registered parser.
 func IsParseAble(filename string) bool {
-	fileType := GetTypeFromName(filename)
-	_, ok := ParseAble[fileType]
+	_, ok := defaultRegistry.byExtension(GetTypeFromName(filename))
+	return ok
+}
+
+// IsParseAbleContent is like IsParseAble but falls back to sniffing data,
+// so files without an extension or with the wrong one are still accepted.
+func IsParseAbleContent(filename string, data []byte) bool {
+	_, ok := defaultRegistry.lookup(filename, data)
 	return ok
 }
 
+// IsDocument reports whether the parser picked for filename and data is for
+// prose documents, which go to the vector indexer.
+func IsDocument(filename string, data []byte) bool {
+	reg, ok := defaultRegistry.lookup(filename, data)
+	return ok && reg.document
+}
+
 func GetTypeFromName(filename string) string {
 	return strings.ToLower(path.Ext(filename))
 }
 
 func ParseDoc(f io.Reader, filename string) (string, error) {
-	fileType := GetTypeFromName(filename)
-	if _, ok := ParseAble[fileType]; !ok {
-		return "", nil
+	content, _, err := ParseDocFields(f, filename)
+	return content, err
+}
+
+// ParseDocFields parses like ParseDoc and also returns the extra index fields:
+// the document metadata and sections, and the fields of parsers implementing
+// FieldParser. Fields is never nil.
+func ParseDocFields(f io.Reader, filename string) (string, map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", fields, err
+	}
+	doc, extra, err := parseData(context.Background(), data, filename)
+	if err != nil {
+		return "", fields, err
+	}
+	content := doc.Content()
+	for k, v := range doc.Fields() {
+		fields[k] = v
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return content, fields, nil
+}
+
+// ParseDocument returns the structured result of parsing a file. Files
+// without a parser give an empty document.
+func ParseDocument(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	doc, _, err := parseData(context.Background(), data, filename)
+	if err != nil {
+		return nil, err
+	}
+	doc.Content()
+	return doc, nil
+}
+
+func parseData(ctx context.Context, data []byte, filename string) (*Document, map[string]interface{}, error) {
+	reg, ok := defaultRegistry.lookup(filename, data)
+	if !ok {
+		return &Document{}, nil, nil
 	}
-	if fileType == ".txt" || fileType == ".md" || fileType == ".markdown" {
-		data, err := ioutil.ReadAll(f)
+	switch p := reg.parser.(type) {
+	case ContextParser:
+		return p.ParseContext(ctx, bytes.NewReader(data), filename)
+	case StructuredParser:
+		doc, err := p.ParseDocument(bytes.NewReader(data), filename)
+		return doc, nil, err
+	case FieldParser:
+		content, extra, err := p.ParseFields(bytes.NewReader(data), filename)
 		if err != nil {
-			return "", err
+			return nil, nil, err
 		}
-		return string(data), nil
+		return DocumentFromContent(content), extra, nil
 	}
-	mimeType := docconv.MimeTypeByExtension(filename)
-	res, err := docconv.Convert(f, mimeType, true)
+	content, err := reg.parser.Parse(bytes.NewReader(data), filename)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	return res.Body, nil
+	return DocumentFromContent(content), nil, nil
 }
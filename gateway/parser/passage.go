@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultPassageSize and DefaultPassageOverlap are the length in bytes of the
+// passages long content is split into and how much of it neighbouring
+// passages share, set from PASSAGE_SIZE and PASSAGE_OVERLAP.
+var (
+	DefaultPassageSize    = 2000
+	DefaultPassageOverlap = 200
+)
+
+// Passage is a run of content indexed on its own, so long files are ranked
+// and highlighted by the part that matches.
+type Passage struct {
+	Text string
+	// Offset is the byte offset of Text in the content.
+	Offset   int
+	Page     int
+	Headings []string
+}
+
+// passageBreaks are tried in order for the end of a passage, from paragraphs
+// to words.
+var passageBreaks = [][]string{
+	{"\n\n", PageSeparator},
+	{". ", "! ", "? ", "。", "！", "？", "\n"},
+	{" ", "\t", "，", "、"},
+}
+
+// SplitPassages splits content longer than size into passages of at most size
+// bytes, each starting about overlap bytes before the previous one ended.
+// Passages end at a paragraph, sentence or word break in their last quarter
+// when there is one. The page and headings of a passage are those of the
+// section it starts in. Content no longer than size has no passages.
+func SplitPassages(content string, sections []Section, size, overlap int) []Passage {
+	if size <= 0 || len(content) <= size {
+		return nil
+	}
+	if overlap < 0 || overlap > size/2 {
+		overlap = size / 2
+	}
+	passages := make([]Passage, 0, len(content)/(size-overlap)+1)
+	for start := 0; start < len(content); {
+		end := len(content)
+		if start+size < len(content) {
+			end = passageEnd(content, start+size*3/4, start+size)
+		}
+		if text := strings.TrimSpace(content[start:end]); text != "" {
+			passage := Passage{Text: text, Offset: start}
+			if section := sectionAt(sections, start); section != nil {
+				passage.Page, passage.Headings = section.Page, section.Headings
+			}
+			passages = append(passages, passage)
+		}
+		if end == len(content) {
+			break
+		}
+		next := passageStart(content, end-overlap, end)
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return passages
+}
+
+// passageEnd returns the end of the last break between min and max, or max
+// moved back to a character boundary.
+func passageEnd(content string, min, max int) int {
+	for _, breaks := range passageBreaks {
+		end := -1
+		for _, b := range breaks {
+			if i := strings.LastIndex(content[min:max], b); i >= 0 && min+i+len(b) > end {
+				end = min + i + len(b)
+			}
+		}
+		if end > min {
+			return end
+		}
+	}
+	for max > min && !utf8.RuneStart(content[max]) {
+		max--
+	}
+	return max
+}
+
+// passageStart moves pos to the next word before end, or to a character
+// boundary when there is none.
+func passageStart(content string, pos, end int) int {
+	if i := strings.IndexAny(content[pos:end], " \t\n"); i >= 0 && pos+i+1 < end {
+		return pos + i + 1
+	}
+	for pos < end && !utf8.RuneStart(content[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// sectionAt returns the section containing offset, nil without sections.
+func sectionAt(sections []Section, offset int) *Section {
+	var found *Section
+	for i := range sections {
+		if sections[i].Offset > offset {
+			break
+		}
+		found = &sections[i]
+	}
+	return found
+}
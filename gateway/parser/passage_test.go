@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitPassages(t *testing.T) {
+	if passages := SplitPassages("short text", nil, 100, 10); len(passages) != 0 {
+		t.Fatalf("expected no passages, got %v", passages)
+	}
+
+	doc := &Document{Sections: []Section{
+		{Page: 1, Headings: []string{"Intro"}, Text: strings.Repeat("The quick brown fox jumps. ", 10)},
+		{Page: 2, Headings: []string{"Body"}, Text: strings.Repeat("敏捷的狐狸跳过了懒狗。", 10)},
+	}}
+	content := doc.Content()
+	passages := SplitPassages(content, doc.Sections, 100, 20)
+	if len(passages) < 6 {
+		t.Fatalf("expected at least 6 passages, got %d", len(passages))
+	}
+	for i, p := range passages {
+		if len(p.Text) > 100 {
+			t.Fatalf("passage %d longer than size: %q", i, p.Text)
+		}
+		if !strings.Contains(content, p.Text) {
+			t.Fatalf("passage %d not in content: %q", i, p.Text)
+		}
+		if i > 0 && p.Offset >= passages[i-1].Offset+len(passages[i-1].Text) {
+			t.Fatalf("passage %d does not overlap the previous one", i)
+		}
+	}
+	first, last := passages[0], passages[len(passages)-1]
+	if first.Page != 1 || HeadingPath(first.Headings) != "Intro" || !strings.HasSuffix(first.Text, ".") {
+		t.Fatalf("got first %+v", first)
+	}
+	if last.Page != 2 || HeadingPath(last.Headings) != "Body" || !strings.HasSuffix(last.Text, "。") {
+		t.Fatalf("got last %+v", last)
+	}
+	// text without breaks is cut at character boundaries
+	for _, p := range SplitPassages(strings.Repeat("狐", 100), nil, 50, 10) {
+		if !strings.HasPrefix(p.Text, "狐") || !strings.HasSuffix(p.Text, "狐") {
+			t.Fatalf("split inside a character: %q", p.Text)
+		}
+	}
+}
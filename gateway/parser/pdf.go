@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// parsePdfNative extracts the text of every page, one page per pdf page,
+// until ctx is done. The pdf reader panics on some malformed files, which is
+// returned as an error.
+func parsePdfNative(ctx context.Context, data []byte) (content string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			content = ""
+			err = fmt.Errorf("parse pdf error: %v", r)
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	pages := make([]string, 0)
+	for i := 1; i <= r.NumPage(); i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		p := r.Page(i)
+		// a damaged page count may claim more pages than the tree holds
+		if p.V.IsNull() {
+			break
+		}
+		// font names are only unique within a page, so no cache is shared
+		text, err := p.GetPlainText(nil)
+		if err != nil {
+			return "", err
+		}
+		pages = append(pages, strings.TrimSpace(text))
+	}
+	return JoinPages(pages), nil
+}
+
+// readPdfInfo fills the metadata of doc from the document information
+// dictionary and the catalog language. Unreadable files are skipped.
+func readPdfInfo(data []byte, doc *Document) {
+	defer func() {
+		recover()
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+	info := r.Trailer().Key("Info")
+	doc.Title = strings.TrimSpace(info.Key("Title").Text())
+	doc.Author = strings.TrimSpace(info.Key("Author").Text())
+	doc.Language = strings.TrimSpace(r.Trailer().Key("Root").Key("Lang").Text())
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const MimePptx = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+
+const drawingmlNamespace = "http://schemas.openxmlformats.org/drawingml/2006/main"
+
+func init() {
+	RegisterDocument(DocumentParserFunc(parsePptx), []string{".pptx"}, []string{MimePptx})
+	RegisterZipEntry(MimePptx, "ppt/presentation.xml")
+}
+
+type pptxPresentation struct {
+	Slides []struct {
+		Rid string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sldIdLst>sldId"`
+}
+
+// parsePptx returns the text of every slide in presentation order, one page per slide.
+func parsePptx(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	files, err := zipFiles(data)
+	if err != nil {
+		return nil, err
+	}
+	var presentation pptxPresentation
+	if err := decodeZipXml(files, "ppt/presentation.xml", &presentation); err != nil {
+		return nil, err
+	}
+	targets, err := readRelationships(files, "ppt/_rels/presentation.xml.rels", "ppt")
+	if err != nil {
+		return nil, err
+	}
+	slides := make([]string, 0, len(presentation.Slides))
+	for _, slide := range presentation.Slides {
+		rc, err := openZipEntry(files, targets[slide.Rid])
+		if err != nil {
+			return nil, err
+		}
+		text, err := drawingmlText(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		slides = append(slides, text)
+	}
+	doc := pagedDocument(slides)
+	readCoreProperties(files, doc)
+	return doc, nil
+}
+
+// drawingmlText collects the <a:t> runs of a slide, one line per <a:p> paragraph.
+func drawingmlText(r io.Reader) (string, error) {
+	var sb bytes.Buffer
+	inText := false
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == drawingmlNamespace && t.Name.Local == "t" {
+				inText = true
+			}
+		case xml.EndElement:
+			if t.Name.Space != drawingmlNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				sb.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
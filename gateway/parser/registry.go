@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"sync"
+)
+
+type registry struct {
+	mu     sync.RWMutex
+	byExt  map[string]registration
+	byMime map[string]registration
+	sniff  sniffer
+}
+
+// registration is a registered parser. document marks prose documents,
+// which are also sent to the vector indexer.
+type registration struct {
+	parser   Parser
+	document bool
+}
+
+var defaultRegistry = newRegistry()
+
+func newRegistry() *registry {
+	return &registry{
+		byExt:  make(map[string]registration),
+		byMime: make(map[string]registration),
+	}
+}
+
+// Register makes p the parser for the given extensions (with leading dot) and MIME types.
+// A later registration for the same key replaces the earlier one.
+func Register(p Parser, extensions []string, mimeTypes []string) {
+	defaultRegistry.register(registration{parser: p}, extensions, mimeTypes)
+}
+
+// RegisterDocument is like Register for parsers of prose documents, whose
+// files are also sent to the vector indexer. Code, mail, archives and
+// spreadsheets are not documents.
+func RegisterDocument(p Parser, extensions []string, mimeTypes []string) {
+	defaultRegistry.register(registration{parser: p, document: true}, extensions, mimeTypes)
+}
+
+// RegisterMagic maps a signature found at offset in the file content to mimeType.
+func RegisterMagic(mimeType string, offset int, signature []byte) {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	defaultRegistry.sniff.addMagic(mimeType, offset, signature)
+}
+
+// RegisterZipEntry maps zip containers holding entryName to mimeType, e.g. word/document.xml for docx.
+func RegisterZipEntry(mimeType, entryName string) {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	defaultRegistry.sniff.addZipEntry(mimeType, entryName)
+}
+
+// RegisterOleStream maps OLE2 compound files holding streamName to mimeType, e.g. WordDocument for doc.
+func RegisterOleStream(mimeType, streamName string) {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	defaultRegistry.sniff.addOleStream(mimeType, streamName)
+}
+
+// DetectMimeType sniffs the MIME type of data.
+func DetectMimeType(data []byte) string {
+	defaultRegistry.mu.RLock()
+	defer defaultRegistry.mu.RUnlock()
+	mimeType, _ := defaultRegistry.sniff.detect(data)
+	return mimeType
+}
+
+func (r *registry) register(reg registration, extensions []string, mimeTypes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ext := range extensions {
+		r.byExt[ext] = reg
+	}
+	for _, mimeType := range mimeTypes {
+		r.byMime[mimeType] = reg
+	}
+}
+
+func (r *registry) byExtension(ext string) (registration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byExt[ext]
+	return p, ok
+}
+
+func (r *registry) byMimeType(mimeType string) (registration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byMime[mimeType]
+	return p, ok
+}
+
+// lookup picks a parser for a file. A signature match wins over the extension,
+// so a pdf saved as .bin or .txt still goes to the pdf parser. Generic guesses
+// such as text/plain are only trusted when the file has no extension at all.
+func (r *registry) lookup(filename string, data []byte) (registration, bool) {
+	r.mu.RLock()
+	mimeType, exact := r.sniff.detect(data)
+	r.mu.RUnlock()
+	if exact {
+		if p, ok := r.byMimeType(mimeType); ok {
+			return p, true
+		}
+	}
+	ext := GetTypeFromName(filename)
+	if p, ok := r.byExtension(ext); ok {
+		return p, true
+	}
+	if ext == "" {
+		return r.byMimeType(mimeType)
+	}
+	return registration{}, false
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	cases := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("%PDF-1.7\n..."), MimePdf},
+		{zipOf(t, map[string]string{"[Content_Types].xml": "<xml/>", "word/document.xml": "<xml/>"}), MimeDocx},
+		{zipOf(t, map[string]string{"a.txt": "<xml/>"}), MimeZip},
+		{append(append([]byte{}, oleSignature...), utf16le("WordDocument")...), MimeDoc},
+		{[]byte("hello world"), MimeText},
+	}
+	for i, c := range cases {
+		if got := DetectMimeType(c.data); got != c.want {
+			t.Errorf("case %d: got %s want %s", i, got, c.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n")
+	cases := []struct {
+		filename string
+		data     []byte
+		want     bool
+	}{
+		{"report.bin", pdf, true},
+		{"report", pdf, true},
+		{"README", []byte("plain notes"), true},
+		{"notes.md", []byte("# title"), true},
+		{"main.go", []byte("package main"), true},
+		{"main.xyz", []byte("package main"), false},
+		{"archive.zip", zipOf(t, map[string]string{"a.txt": "<xml/>"}), true},
+		{"data.bin", zipOf(t, map[string]string{"a.txt": "<xml/>"}), false},
+	}
+	for _, c := range cases {
+		if got := IsParseAbleContent(c.filename, c.data); got != c.want {
+			t.Errorf("%s: got %v want %v", c.filename, got, c.want)
+		}
+	}
+}
+
+func TestIsDocument(t *testing.T) {
+	cases := []struct {
+		filename string
+		data     []byte
+		want     bool
+	}{
+		{"slides.pptx", zipOf(t, map[string]string{"ppt/presentation.xml": "<xml/>"}), true},
+		{"slides.bin", zipOf(t, map[string]string{"ppt/presentation.xml": "<xml/>"}), true},
+		{"notes.odt", zipOf(t, map[string]string{"content.xml": "<xml/>"}), true},
+		{"slides.odp", zipOf(t, map[string]string{"content.xml": "<xml/>"}), true},
+		{"letter.rtf", []byte(`{\rtf1 hello}`), true},
+		{"report.bin", []byte("%PDF-1.4\n"), true},
+		{"notes.md", []byte("# title"), true},
+		{"main.go", []byte("package main"), false},
+		{"sheet.xlsx", zipOf(t, map[string]string{"xl/workbook.xml": "<xml/>"}), false},
+		{"report.pdf", zipOf(t, map[string]string{"xl/workbook.xml": "<xml/>"}), false},
+		{"archive.zip", zipOf(t, map[string]string{"a.txt": "<xml/>"}), false},
+		{"mail.eml", []byte("From: a@b.c\n\nhello"), false},
+	}
+	for _, c := range cases {
+		if got := IsDocument(c.filename, c.data); got != c.want {
+			t.Errorf("%s: got %v want %v", c.filename, got, c.want)
+		}
+	}
+}
+
+func TestLookupPrefersSignature(t *testing.T) {
+	r := newRegistry()
+	text := DocumentParserFunc(parseText)
+	pdf := ParserFunc(func(f io.Reader, filename string) (string, error) { return "pdf", nil })
+	r.register(registration{parser: text}, []string{".txt"}, []string{MimeText})
+	r.register(registration{parser: pdf}, []string{".pdf"}, []string{MimePdf})
+	r.sniff.addMagic(MimePdf, 0, []byte("%PDF-"))
+
+	reg, ok := r.lookup("misnamed.txt", []byte("%PDF-1.4"))
+	if !ok {
+		t.Fatal("no parser found")
+	}
+	s, _ := reg.parser.Parse(bytes.NewReader(nil), "misnamed.txt")
+	if s != "pdf" {
+		t.Fatalf("expected pdf parser, got %q", s)
+	}
+}
+
+// useTestRegistry replaces the default registry with a copy for the rest of
+// the test, so parsers registered by it do not leak into other tests.
+func useTestRegistry(t *testing.T) {
+	saved := defaultRegistry
+	r := newRegistry()
+	saved.mu.RLock()
+	for ext, p := range saved.byExt {
+		r.byExt[ext] = p
+	}
+	for mimeType, p := range saved.byMime {
+		r.byMime[mimeType] = p
+	}
+	r.sniff = sniffer{
+		magics:     append([]magic(nil), saved.sniff.magics...),
+		zipEntries: append([]namedEntry(nil), saved.sniff.zipEntries...),
+		oleStreams: append([]namedEntry(nil), saved.sniff.oleStreams...),
+	}
+	saved.mu.RUnlock()
+	defaultRegistry = r
+	t.Cleanup(func() { defaultRegistry = saved })
+}
@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+const MimeRtf = "application/rtf"
+
+func init() {
+	RegisterDocument(ParserFunc(parseRtf), []string{".rtf"}, []string{MimeRtf, "text/rtf"})
+	RegisterMagic(MimeRtf, 0, []byte(`{\rtf`))
+}
+
+// rtfCodePages maps \ansicpg values to decoders for \'hh escapes.
+var rtfCodePages = map[int]encoding.Encoding{
+	874:  charmap.Windows874,
+	932:  japanese.ShiftJIS,
+	936:  simplifiedchinese.GBK,
+	949:  korean.EUCKR,
+	950:  traditionalchinese.Big5,
+	1250: charmap.Windows1250,
+	1251: charmap.Windows1251,
+	1252: charmap.Windows1252,
+	1253: charmap.Windows1253,
+	1254: charmap.Windows1254,
+	1255: charmap.Windows1255,
+	1256: charmap.Windows1256,
+	1257: charmap.Windows1257,
+	1258: charmap.Windows1258,
+}
+
+// rtfDestinations are groups holding no document text.
+var rtfDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "object": true, "header": true, "footer": true,
+	"headerl": true, "headerr": true, "headerf": true, "footerl": true,
+	"footerr": true, "footerf": true, "listtable": true, "listoverridetable": true,
+	"rsidtbl": true, "generator": true, "themedata": true, "colorschememapping": true,
+	"latentstyles": true, "datastore": true, "xmlnstbl": true, "fldinst": true,
+	"filetbl": true, "revtbl": true, "pgdsctbl": true,
+}
+
+type rtfState struct {
+	skip     bool
+	ucSkip   int
+	codePage encoding.Encoding
+}
+
+// parseRtf strips RTF control words, splitting pages at \page.
+func parseRtf(f io.Reader, filename string) (string, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	var pending bytes.Buffer // \'hh bytes waiting to be decoded together
+	state := rtfState{ucSkip: 1, codePage: charmap.Windows1252}
+	stack := make([]rtfState, 0)
+
+	flush := func() {
+		if pending.Len() == 0 {
+			return
+		}
+		if decoded, err := state.codePage.NewDecoder().Bytes(pending.Bytes()); err == nil {
+			out.Write(decoded)
+		}
+		pending.Reset()
+	}
+	write := func(s string) {
+		flush()
+		if !state.skip {
+			out.WriteString(s)
+		}
+	}
+	// skipChars drops the fallback characters following a \u escape
+	skipChars := 0
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '{':
+			flush()
+			stack = append(stack, state)
+			skipChars = 0
+		case '}':
+			flush()
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+			skipChars = 0
+		case '\\':
+			if i+1 >= len(data) {
+				break
+			}
+			next := data[i+1]
+			switch {
+			case next == '\'':
+				if i+3 < len(data) {
+					if v, err := strconv.ParseUint(string(data[i+2:i+4]), 16, 8); err == nil {
+						if skipChars > 0 {
+							skipChars--
+						} else if !state.skip {
+							pending.WriteByte(byte(v))
+						}
+					}
+				}
+				i += 3
+			case next == '*':
+				state.skip = true
+				i++
+			case next == '\\' || next == '{' || next == '}':
+				write(string(next))
+				i++
+			case next == '~':
+				write(" ")
+				i++
+			case next == '\n' || next == '\r':
+				write("\n")
+				i++
+			case isRtfLetter(next):
+				j := i + 1
+				for j < len(data) && isRtfLetter(data[j]) {
+					j++
+				}
+				word := string(data[i+1 : j])
+				k := j
+				if k < len(data) && (data[k] == '-' || isRtfDigit(data[k])) {
+					k++
+					for k < len(data) && isRtfDigit(data[k]) {
+						k++
+					}
+				}
+				param, hasParam := 0, k > j
+				if hasParam {
+					param, _ = strconv.Atoi(string(data[j:k]))
+				}
+				if k < len(data) && data[k] == ' ' {
+					k++
+				}
+				i = k - 1
+				switch {
+				case rtfDestinations[word]:
+					state.skip = true
+				case word == "par" || word == "line" || word == "row" || word == "sect":
+					write("\n")
+				case word == "page":
+					write(PageSeparator)
+				case word == "tab" || word == "cell":
+					write("\t")
+				case word == "uc" && hasParam:
+					state.ucSkip = param
+				case word == "ansicpg" && hasParam:
+					if enc, ok := rtfCodePages[param]; ok {
+						state.codePage = enc
+					}
+				case word == "u" && hasParam:
+					if param < 0 {
+						param += 65536
+					}
+					write(string(rune(param)))
+					skipChars = state.ucSkip
+				}
+			default:
+				i++
+			}
+		case '\r', '\n':
+		default:
+			if skipChars > 0 {
+				skipChars--
+				continue
+			}
+			write(string(c))
+		}
+	}
+	flush()
+	return strings.TrimSpace(out.String()), nil
+}
+
+func isRtfLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isRtfDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
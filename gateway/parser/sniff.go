@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	MimeZip = "application/zip"
+	MimeOle = "application/x-ole-storage"
+)
+
+var (
+	zipSignature = []byte("PK\x03\x04")
+	oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+)
+
+type magic struct {
+	mimeType  string
+	offset    int
+	signature []byte
+}
+
+type namedEntry struct {
+	mimeType string
+	name     string
+}
+
+type sniffer struct {
+	magics     []magic
+	zipEntries []namedEntry
+	oleStreams []namedEntry
+}
+
+func (s *sniffer) addMagic(mimeType string, offset int, signature []byte) {
+	s.magics = append(s.magics, magic{mimeType: mimeType, offset: offset, signature: signature})
+}
+
+func (s *sniffer) addZipEntry(mimeType, entryName string) {
+	s.zipEntries = append(s.zipEntries, namedEntry{mimeType: mimeType, name: entryName})
+}
+
+func (s *sniffer) addOleStream(mimeType, streamName string) {
+	s.oleStreams = append(s.oleStreams, namedEntry{mimeType: mimeType, name: streamName})
+}
+
+// detect returns the MIME type of data and whether it came from a registered
+// signature (exact) rather than a generic guess like text/plain.
+func (s *sniffer) detect(data []byte) (string, bool) {
+	if bytes.HasPrefix(data, zipSignature) {
+		if mimeType := s.detectZip(data); mimeType != "" {
+			return mimeType, true
+		}
+		return MimeZip, false
+	}
+	if bytes.HasPrefix(data, oleSignature) {
+		if mimeType := s.detectOle(data); mimeType != "" {
+			return mimeType, true
+		}
+		return MimeOle, false
+	}
+	for _, m := range s.magics {
+		end := m.offset + len(m.signature)
+		if end <= len(data) && bytes.Equal(data[m.offset:end], m.signature) {
+			return m.mimeType, true
+		}
+	}
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream", false
+	}
+	return mimeType, false
+}
+
+// maxMimetypeEntry bounds the "mimetype" entry read, a MIME type is short and
+// the entry may be a zip bomb.
+const maxMimetypeEntry = 256
+
+// detectZip tells OOXML and OpenDocument files apart by the entries they contain.
+func (s *sniffer) detectZip(data []byte) string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	names := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		names[f.Name] = f
+	}
+	// OpenDocument stores its MIME type in an uncompressed "mimetype" entry.
+	if f, ok := names["mimetype"]; ok {
+		if rc, err := f.Open(); err == nil {
+			b, err := ioutil.ReadAll(io.LimitReader(rc, maxMimetypeEntry))
+			rc.Close()
+			if err == nil && len(b) > 0 {
+				return strings.TrimSpace(string(b))
+			}
+		}
+	}
+	for _, e := range s.zipEntries {
+		if _, ok := names[e.name]; ok {
+			return e.mimeType
+		}
+	}
+	return ""
+}
+
+// detectOle looks for the UTF-16 directory entry name of a known stream.
+// It does not walk the compound file, which is enough to tell doc, xls and msg apart.
+func (s *sniffer) detectOle(data []byte) string {
+	for _, e := range s.oleStreams {
+		if bytes.Contains(data, utf16le(e.name)) {
+			return e.mimeType
+		}
+	}
+	return ""
+}
+
+func utf16le(str string) []byte {
+	units := utf16.Encode([]rune(str))
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
@@ -0,0 +1,308 @@
+package parser
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	MimeXlsx = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	MimeXls  = "application/vnd.ms-excel"
+	MimeCsv  = "text/csv"
+	MimeTsv  = "text/tab-separated-values"
+)
+
+// SheetsFieldName holds the json encoded []SheetRows of a spreadsheet on the
+// Files document, which locate the cells in its content.
+const SheetsFieldName = "sheets"
+
+var ErrSpreadsheet = errors.New("invalid spreadsheet")
+
+// maxSheetColumns and maxSheetRows are the limits of Excel, XFD and 1048576.
+// Cells beyond them are dropped, so a reference to a far cell cannot make
+// rows of millions of empty cells.
+const (
+	maxSheetColumns = 16384
+	maxSheetRows    = 1048576
+)
+
+var spreadsheetExtensions = []string{".xlsx", ".xls", ".ods", ".csv", ".tsv"}
+
+func init() {
+	Register(spreadsheetParser{}, spreadsheetExtensions, []string{MimeXlsx, MimeXls, MimeOds, MimeCsv, MimeTsv})
+	RegisterZipEntry(MimeXlsx, "xl/workbook.xml")
+	RegisterOleStream(MimeXls, "Workbook")
+}
+
+// Sheet is one worksheet of a spreadsheet. Rows keep their 1-based row
+// number and cells their column position, so a match can be reported as Sheet2!B14.
+type Sheet struct {
+	Name   string     `json:"name"`
+	Header []string   `json:"header"`
+	Rows   []SheetRow `json:"rows"`
+}
+
+type SheetRow struct {
+	Row   int      `json:"row"`
+	Cells []string `json:"cells"`
+}
+
+// SheetRows are the row numbers of a sheet rendered by SheetsText, as ranges
+// of consecutive rows, so the cells found in the content can be reported as
+// Sheet2!B14 without storing them twice.
+type SheetRows struct {
+	Name string   `json:"name"`
+	Rows [][2]int `json:"rows"`
+}
+
+type spreadsheetParser struct{}
+
+func (p spreadsheetParser) Parse(f io.Reader, filename string) (string, error) {
+	sheets, err := ParseSpreadsheet(f, filename)
+	if err != nil {
+		return "", err
+	}
+	return SheetsText(sheets), nil
+}
+
+func (p spreadsheetParser) ParseFields(f io.Reader, filename string) (string, map[string]interface{}, error) {
+	doc, fields, err := p.ParseContext(context.Background(), f, filename)
+	if err != nil {
+		return "", nil, err
+	}
+	return doc.Content(), fields, nil
+}
+
+func (p spreadsheetParser) ParseContext(ctx context.Context, f io.Reader, filename string) (*Document, map[string]interface{}, error) {
+	sheets, err := parseSpreadsheet(ctx, f, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := json.Marshal(SheetsRows(sheets))
+	if err != nil {
+		return nil, nil, err
+	}
+	return DocumentFromContent(SheetsText(sheets)), map[string]interface{}{SheetsFieldName: string(b)}, nil
+}
+
+// ParseSpreadsheet reads every sheet of an xlsx, xls, ods, csv or tsv file.
+func ParseSpreadsheet(f io.Reader, filename string) ([]Sheet, error) {
+	return parseSpreadsheet(context.Background(), f, filename)
+}
+
+// parseSpreadsheet is ParseSpreadsheet stopping between rows once ctx is done.
+func parseSpreadsheet(ctx context.Context, f io.Reader, filename string) ([]Sheet, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var sheets []Sheet
+	switch mimeType := DetectMimeType(data); {
+	case mimeType == MimeXlsx:
+		sheets, err = parseXlsx(ctx, data)
+	case mimeType == MimeXls:
+		sheets, err = parseXls(data)
+	case mimeType == MimeOds:
+		sheets, err = parseOds(ctx, data)
+	case GetTypeFromName(filename) == ".tsv":
+		sheets, err = parseDelimited(ctx, data, filename, '\t')
+	case GetTypeFromName(filename) == ".csv":
+		sheets, err = parseDelimited(ctx, data, filename, ',')
+	default:
+		return nil, ErrSpreadsheet
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range sheets {
+		if len(sheets[i].Rows) > 0 {
+			sheets[i].Header = sheets[i].Rows[0].Cells
+		}
+	}
+	return sheets, nil
+}
+
+func parseDelimited(ctx context.Context, data []byte, filename string, comma rune) ([]Sheet, error) {
+	// Excel exports csv in the ANSI code page, GBK on Chinese systems
+	text, _, err := DecodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	name := strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+	sheet := Sheet{Name: name}
+	for row := 1; ; row++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sheet.Rows = append(sheet.Rows, SheetRow{Row: row, Cells: record})
+	}
+	return []Sheet{sheet}, nil
+}
+
+// IsSpreadsheet reports whether filename has the extension of a spreadsheet.
+func IsSpreadsheet(filename string) bool {
+	ext := GetTypeFromName(filename)
+	for _, e := range spreadsheetExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// cellSeparators keep the cells of a row on one line of the content.
+var cellSeparators = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// SheetsText renders sheets as the indexed content: the sheet name followed
+// by one tab separated line per row.
+func SheetsText(sheets []Sheet) string {
+	var sb strings.Builder
+	for i, sheet := range sheets {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(sheet.Name)
+		sb.WriteString("\n")
+		for _, row := range sheet.Rows {
+			for j, cell := range row.Cells {
+				if j > 0 {
+					sb.WriteString("\t")
+				}
+				sb.WriteString(cellSeparators.Replace(cell))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// SheetsRows returns the row numbers of sheets in the lines of SheetsText.
+func SheetsRows(sheets []Sheet) []SheetRows {
+	res := make([]SheetRows, 0, len(sheets))
+	for _, sheet := range sheets {
+		rows := SheetRows{Name: sheet.Name, Rows: make([][2]int, 0)}
+		for _, row := range sheet.Rows {
+			if n := len(rows.Rows); n > 0 && rows.Rows[n-1][1]+1 == row.Row {
+				rows.Rows[n-1][1] = row.Row
+				continue
+			}
+			rows.Rows = append(rows.Rows, [2]int{row.Row, row.Row})
+		}
+		res = append(res, rows)
+	}
+	return res
+}
+
+// LocateInSheets returns the reference of the first cell containing the most
+// of terms, e.g. "Sheet2!B14", or "" when no cell matches.
+func LocateInSheets(sheets []Sheet, terms []string) string {
+	best, bestRef := 0, ""
+	for _, sheet := range sheets {
+		for _, row := range sheet.Rows {
+			for col, cell := range row.Cells {
+				if matched := matchedTerms(cell, terms); matched > best {
+					best = matched
+					bestRef = sheet.Name + "!" + CellRef(col, row.Row)
+				}
+			}
+		}
+	}
+	return bestRef
+}
+
+// LocateInContent is LocateInSheets for the content rendered by SheetsText,
+// with the rows of its sheets. Rows cut off the content are not searched.
+func LocateInContent(content string, sheets []SheetRows, terms []string) string {
+	lines := strings.Split(content, "\n")
+	line := 0
+	best, bestRef := 0, ""
+	for i, sheet := range sheets {
+		if i > 0 {
+			line++
+		}
+		// the name of the sheet
+		line++
+		for _, rows := range sheet.Rows {
+			for row := rows[0]; row <= rows[1]; row++ {
+				if line >= len(lines) {
+					return bestRef
+				}
+				for col, cell := range strings.Split(lines[line], "\t") {
+					if matched := matchedTerms(cell, terms); matched > best {
+						best = matched
+						bestRef = sheet.Name + "!" + CellRef(col, row)
+					}
+				}
+				line++
+			}
+		}
+	}
+	return bestRef
+}
+
+// matchedTerms counts the terms found in cell, ignoring case.
+func matchedTerms(cell string, terms []string) int {
+	cell = strings.ToLower(cell)
+	matched := 0
+	for _, term := range terms {
+		if term != "" && strings.Contains(cell, strings.ToLower(term)) {
+			matched++
+		}
+	}
+	return matched
+}
+
+// CellRef formats a 0-based column and 1-based row as an A1 style reference.
+func CellRef(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// columnIndex parses the letters of an A1 style reference into a 0-based
+// column, maxSheetColumns for any column beyond the limit.
+func columnIndex(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		if col > maxSheetColumns {
+			return maxSheetColumns
+		}
+	}
+	return col - 1
+}
+
+// setCell stores text at column col, padding the row with empty cells.
+// Columns beyond maxSheetColumns are dropped.
+func (r *SheetRow) setCell(col int, text string) {
+	if col < 0 || col >= maxSheetColumns {
+		return
+	}
+	for len(r.Cells) <= col {
+		r.Cells = append(r.Cells, "")
+	}
+	r.Cells[col] = text
+}
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCellRef(t *testing.T) {
+	cases := map[string][2]int{
+		"A1":   {0, 1},
+		"B14":  {1, 14},
+		"Z3":   {25, 3},
+		"AA7":  {26, 7},
+		"XFD2": {16383, 2},
+	}
+	for want, c := range cases {
+		if got := CellRef(c[0], c[1]); got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+		if col := columnIndex(want); col != c[0] {
+			t.Errorf("column of %s: got %d want %d", want, col, c[0])
+		}
+	}
+}
+
+func TestParseCsv(t *testing.T) {
+	data := "name,city\nalice,berlin\nbob,\"new york\"\n"
+	content, fields, err := ParseDocFields(strings.NewReader(data), "people.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "bob\tnew york") {
+		t.Fatalf("unexpected content %q", content)
+	}
+	if _, ok := fields[SheetsFieldName]; !ok {
+		t.Fatal("sheets field missing")
+	}
+	sheets, _ := ParseSpreadsheet(strings.NewReader(data), "people.csv")
+	if sheets[0].Name != "people" || sheets[0].Header[1] != "city" {
+		t.Fatalf("unexpected sheet %+v", sheets[0])
+	}
+	if ref := LocateInSheets(sheets, []string{"York"}); ref != "people!B3" {
+		t.Fatalf("got %s", ref)
+	}
+}
+
+func TestLocateInContent(t *testing.T) {
+	sheets := []Sheet{
+		{Name: "Summary", Rows: []SheetRow{{Row: 1, Cells: []string{"total", "42"}}}},
+		{Name: "Sheet2", Rows: []SheetRow{
+			{Row: 2, Cells: []string{"a"}},
+			{Row: 3, Cells: []string{"multi\nline", "b"}},
+			{Row: 14, Cells: []string{"", "quarterly report"}},
+		}},
+	}
+	content := SheetsText(sheets)
+	rows := SheetsRows(sheets)
+	if len(rows[1].Rows) != 2 || rows[1].Rows[0] != [2]int{2, 3} || rows[1].Rows[1] != [2]int{14, 14} {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if ref := LocateInContent(content, rows, []string{"quarterly", "report"}); ref != "Sheet2!B14" {
+		t.Fatalf("got %s", ref)
+	}
+	if ref := LocateInContent(content, rows, []string{"b"}); ref != "Sheet2!B3" {
+		t.Fatalf("got %s", ref)
+	}
+	// rows cut off the content are not found
+	if ref := LocateInContent(content[:strings.Index(content, "quarterly")], rows, []string{"quarterly"}); ref != "" {
+		t.Fatalf("got %s", ref)
+	}
+}
+
+func TestParseXlsx(t *testing.T) {
+	files := map[string]string{
+		"[Content_Types].xml": `<Types/>`,
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Summary" sheetId="1" r:id="rId1"/><sheet name="Sheet2" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>
+<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>product</t></si><si><r><t>quarterly </t></r><r><t>report</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>id</t></is></c></row>
+<row r="14"><c r="A14"><v>42</v></c><c r="B14" t="s"><v>1</v></c></row></sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(body))
+	}
+	zw.Close()
+
+	sheets, err := ParseSpreadsheet(bytes.NewReader(buf.Bytes()), "book.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 2 || sheets[1].Name != "Sheet2" {
+		t.Fatalf("unexpected sheets %+v", sheets)
+	}
+	if ref := LocateInSheets(sheets, []string{"quarterly", "report"}); ref != "Sheet2!B14" {
+		t.Fatalf("got %s", ref)
+	}
+}
+
+func TestSheetLimits(t *testing.T) {
+	if col := columnIndex("ZZZZZZZZZZZZZZZZ1"); col != maxSheetColumns {
+		t.Fatalf("got column %d", col)
+	}
+	xlsx := zipOf(t, map[string]string{
+		"[Content_Types].xml": `<Types/>`,
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>kept</t></is></c><c r="ZZZZZ1" t="inlineStr"><is><t>far</t></is></c></row>
+<row r="2000000"><c r="A2000000" t="inlineStr"><is><t>low</t></is></c></row></sheetData></worksheet>`,
+	})
+	sheets, err := ParseSpreadsheet(bytes.NewReader(xlsx), "book.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets[0].Rows) != 1 || len(sheets[0].Rows[0].Cells) != 1 {
+		t.Fatalf("unexpected xlsx sheet %+v", sheets[0])
+	}
+
+	ods := zipOf(t, map[string]string{
+		"mimetype": MimeOds,
+		"content.xml": odfHeader + `<office:spreadsheet><table:table table:name="Big">
+<table:table-row><table:table-cell table:number-columns-repeated="1000000000"/><table:table-cell><text:p>far</text:p></table:table-cell><table:table-cell><text:p>farther</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1000000000"><table:table-cell/></table:table-row>
+<table:table-row><table:table-cell><text:p>low</text:p></table:table-cell></table:table-row>
+</table:table></office:spreadsheet></office:body></office:document-content>`,
+	})
+	sheets, err = ParseSpreadsheet(bytes.NewReader(ods), "big.ods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets[0].Rows) != 0 {
+		t.Fatalf("unexpected ods sheet %+v", sheets[0])
+	}
+}
+
+func TestReadSSTContinue(t *testing.T) {
+	// "hello" split over a CONTINUE record that switches to 16-bit chars
+	first := []byte{2, 0, 0, 0, 2, 0, 0, 0, 5, 0, 0, 'h', 'e', 'l'}
+	second := []byte{1, 'l', 0, 'o', 0, 2, 0, 0, 'h', 'i'}
+	strs := readSST([][]byte{first, second})
+	if len(strs) != 2 || strs[0] != "hello" || strs[1] != "hi" {
+		t.Fatalf("got %q", strs)
+	}
+}
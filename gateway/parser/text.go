@@ -0,0 +1,26 @@
+package parser
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+const MimeText = "text/plain"
+
+func init() {
+	RegisterDocument(DocumentParserFunc(parseText), []string{".txt"}, []string{MimeText})
+}
+
+func parseText(f io.Reader, filename string) (*Document, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	content, charset, err := DecodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := DocumentFromContent(content)
+	doc.Charset = charset
+	return doc, nil
+}
@@ -0,0 +1,60 @@
+package parser
+
+import "strings"
+
+// TypeFieldName holds the lowercase extension of a file, e.g. ".pdf".
+const TypeFieldName = "type"
+
+// Type groups name kinds of files for filtering, image, audio and video being
+// the media kinds.
+const (
+	TypeDocument     = "document"
+	TypeSpreadsheet  = "spreadsheet"
+	TypePresentation = "presentation"
+	TypeText         = "text"
+	TypeMail         = "mail"
+	TypeArchive      = "archive"
+	TypeCode         = "code"
+)
+
+var typeGroups = map[string][]string{
+	TypeDocument:     {".pdf", ".doc", ".docx", ".odt", ".rtf", ".pages", ".epub"},
+	TypeSpreadsheet:  {".xls", ".xlsx", ".ods", ".csv", ".tsv", ".numbers"},
+	TypePresentation: {".ppt", ".pptx", ".odp", ".key"},
+	TypeText:         {".txt", ".md", ".markdown", ".html", ".htm", ".log"},
+	TypeMail:         {".eml", ".msg", ".mbox"},
+	TypeArchive:      {".zip", ".tar", ".tgz", ".gz", ".7z", ".rar"},
+}
+
+// TypeExtensions returns the extensions a type filter stands for: those of
+// a group like "document" or "image", or the one extension given with or
+// without its dot.
+func TypeExtensions(t string) []string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if exts, ok := typeGroups[t]; ok {
+		return exts
+	}
+	switch t {
+	case "":
+		return nil
+	case MediaImage, MediaAudio, MediaVideo:
+		return kindExtensions(mediaKinds, t)
+	case TypeCode:
+		exts := make([]string, 0, len(codeExtensions))
+		for ext := range codeExtensions {
+			exts = append(exts, ext)
+		}
+		return exts
+	}
+	return []string{"." + strings.TrimPrefix(t, ".")}
+}
+
+func kindExtensions(kinds map[string]string, kind string) []string {
+	exts := make([]string, 0)
+	for ext, k := range kinds {
+		if k == kind {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
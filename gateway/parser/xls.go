@@ -0,0 +1,356 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// BIFF8 record types used to read cell text from legacy .xls workbooks.
+const (
+	biffFormula    = 0x0006
+	biffEOF        = 0x000A
+	biffContinue   = 0x003C
+	biffBoundSheet = 0x0085
+	biffMulRk      = 0x00BD
+	biffSST        = 0x00FC
+	biffLabelSST   = 0x00FD
+	biffNumber     = 0x0203
+	biffLabel      = 0x0204
+	biffBoolErr    = 0x0205
+	biffString     = 0x0207
+	biffRk         = 0x027E
+	biffBOF        = 0x0809
+)
+
+type biffRecord struct {
+	typ    uint16
+	offset int
+	data   []byte
+}
+
+func parseXls(data []byte) ([]Sheet, error) {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var stream []byte
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if entry.Name == "Workbook" {
+			stream, err = ioutil.ReadAll(entry)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if stream == nil {
+		return nil, ErrSpreadsheet
+	}
+	records := readBiffRecords(stream)
+
+	var sst []string
+	sheetAt := make(map[int]int) // BOF stream offset -> sheets index
+	sheets := make([]Sheet, 0)
+	for i, rec := range records {
+		switch rec.typ {
+		case biffBoundSheet:
+			if len(rec.data) < 8 {
+				continue
+			}
+			sheetAt[int(binary.LittleEndian.Uint32(rec.data))] = len(sheets)
+			name, _ := biffShortString(rec.data[6:])
+			sheets = append(sheets, Sheet{Name: name})
+		case biffSST:
+			segments := [][]byte{rec.data}
+			for _, next := range records[i+1:] {
+				if next.typ != biffContinue {
+					break
+				}
+				segments = append(segments, next.data)
+			}
+			sst = readSST(segments)
+		}
+	}
+
+	current := -1
+	rows := make(map[int]*SheetRow)
+	var order []int
+	flush := func() {
+		if current < 0 {
+			return
+		}
+		sort.Ints(order)
+		for _, r := range order {
+			sheets[current].Rows = append(sheets[current].Rows, *rows[r])
+		}
+		rows = make(map[int]*SheetRow)
+		order = nil
+	}
+	set := func(row, col int, text string) {
+		if current < 0 {
+			return
+		}
+		r, ok := rows[row]
+		if !ok {
+			r = &SheetRow{Row: row + 1}
+			rows[row] = r
+			order = append(order, row)
+		}
+		r.setCell(col, text)
+	}
+	for i, rec := range records {
+		d := rec.data
+		switch rec.typ {
+		case biffBOF:
+			flush()
+			current = -1
+			if idx, ok := sheetAt[rec.offset]; ok {
+				current = idx
+			}
+		case biffEOF:
+			flush()
+			current = -1
+		case biffLabelSST:
+			if len(d) >= 10 {
+				idx := int(binary.LittleEndian.Uint32(d[6:]))
+				if idx < len(sst) {
+					set(biffRowCol(d, sst[idx]))
+				}
+			}
+		case biffLabel:
+			if len(d) >= 8 {
+				text, _ := biffLongString(d[6:])
+				set(biffRowCol(d, text))
+			}
+		case biffNumber:
+			if len(d) >= 14 {
+				v := math.Float64frombits(binary.LittleEndian.Uint64(d[6:]))
+				set(biffRowCol(d, formatNumber(v)))
+			}
+		case biffRk:
+			if len(d) >= 10 {
+				set(biffRowCol(d, formatNumber(rkValue(binary.LittleEndian.Uint32(d[6:])))))
+			}
+		case biffMulRk:
+			if len(d) < 6 {
+				continue
+			}
+			row := int(binary.LittleEndian.Uint16(d))
+			col := int(binary.LittleEndian.Uint16(d[2:]))
+			for p := 4; p+6 <= len(d)-2; p += 6 {
+				set(row, col, formatNumber(rkValue(binary.LittleEndian.Uint32(d[p+2:]))))
+				col++
+			}
+		case biffBoolErr:
+			if len(d) >= 8 && d[7] == 0 {
+				text := "FALSE"
+				if d[6] != 0 {
+					text = "TRUE"
+				}
+				set(biffRowCol(d, text))
+			}
+		case biffFormula:
+			if len(d) < 14 {
+				continue
+			}
+			if d[12] != 0xFF || d[13] != 0xFF {
+				v := math.Float64frombits(binary.LittleEndian.Uint64(d[6:]))
+				set(biffRowCol(d, formatNumber(v)))
+				continue
+			}
+			// string results follow in a STRING record
+			if d[6] == 0 && i+1 < len(records) && records[i+1].typ == biffString {
+				text, _ := biffLongString(records[i+1].data)
+				set(biffRowCol(d, text))
+			}
+		}
+	}
+	flush()
+	return sheets, nil
+}
+
+func readBiffRecords(stream []byte) []biffRecord {
+	records := make([]biffRecord, 0)
+	for p := 0; p+4 <= len(stream); {
+		typ := binary.LittleEndian.Uint16(stream[p:])
+		size := int(binary.LittleEndian.Uint16(stream[p+2:]))
+		if p+4+size > len(stream) {
+			break
+		}
+		records = append(records, biffRecord{typ: typ, offset: p, data: stream[p+4 : p+4+size]})
+		p += 4 + size
+	}
+	return records
+}
+
+func biffRowCol(d []byte, text string) (int, int, string) {
+	return int(binary.LittleEndian.Uint16(d)), int(binary.LittleEndian.Uint16(d[2:])), text
+}
+
+// biffShortString reads a ShortXLUnicodeString (8-bit length).
+func biffShortString(d []byte) (string, int) {
+	if len(d) < 2 {
+		return "", len(d)
+	}
+	return biffChars(d[2:], int(d[0]), d[1]&1 != 0)
+}
+
+// biffLongString reads an XLUnicodeString (16-bit length).
+func biffLongString(d []byte) (string, int) {
+	if len(d) < 3 {
+		return "", len(d)
+	}
+	return biffChars(d[3:], int(binary.LittleEndian.Uint16(d)), d[2]&1 != 0)
+}
+
+func biffChars(d []byte, n int, high bool) (string, int) {
+	if !high {
+		if n > len(d) {
+			n = len(d)
+		}
+		return latin1(d[:n]), n
+	}
+	if n*2 > len(d) {
+		n = len(d) / 2
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(d[i*2:])
+	}
+	return string(utf16.Decode(units)), n * 2
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// sstReader walks the shared string table across its CONTINUE records. A
+// string split over a record boundary restarts with a fresh option byte.
+type sstReader struct {
+	segments [][]byte
+	seg, pos int
+}
+
+func (r *sstReader) next() (byte, bool) {
+	for r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+		r.seg++
+		r.pos = 0
+	}
+	if r.seg >= len(r.segments) {
+		return 0, false
+	}
+	b := r.segments[r.seg][r.pos]
+	r.pos++
+	return b, true
+}
+
+func (r *sstReader) uint16() (int, bool) {
+	lo, ok1 := r.next()
+	hi, ok2 := r.next()
+	return int(lo) | int(hi)<<8, ok1 && ok2
+}
+
+func (r *sstReader) uint32() (int, bool) {
+	lo, ok1 := r.uint16()
+	hi, ok2 := r.uint16()
+	return lo | hi<<16, ok1 && ok2
+}
+
+func (r *sstReader) skip(n int) {
+	for ; n > 0; n-- {
+		if _, ok := r.next(); !ok {
+			return
+		}
+	}
+}
+
+func (r *sstReader) chars(n int, high bool) (string, bool) {
+	units := make([]uint16, 0, n)
+	for len(units) < n {
+		if r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+			r.seg++
+			r.pos = 0
+			flags, ok := r.next()
+			if !ok {
+				return "", false
+			}
+			high = flags&1 != 0
+		}
+		if high {
+			u, ok := r.uint16()
+			if !ok {
+				return "", false
+			}
+			units = append(units, uint16(u))
+		} else {
+			b, ok := r.next()
+			if !ok {
+				return "", false
+			}
+			units = append(units, uint16(b))
+		}
+	}
+	return string(utf16.Decode(units)), true
+}
+
+func readSST(segments [][]byte) []string {
+	r := &sstReader{segments: segments}
+	r.skip(4)
+	unique, ok := r.uint32()
+	if !ok {
+		return nil
+	}
+	strs := make([]string, 0)
+	for i := 0; i < unique; i++ {
+		n, ok := r.uint16()
+		if !ok {
+			break
+		}
+		flags, ok := r.next()
+		if !ok {
+			break
+		}
+		runs, ext := 0, 0
+		if flags&0x08 != 0 {
+			runs, _ = r.uint16()
+		}
+		if flags&0x04 != 0 {
+			ext, _ = r.uint32()
+		}
+		s, ok := r.chars(n, flags&1 != 0)
+		if !ok {
+			break
+		}
+		r.skip(runs*4 + ext)
+		strs = append(strs, s)
+	}
+	return strs
+}
+
+func rkValue(rk uint32) float64 {
+	var v float64
+	if rk&0x02 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
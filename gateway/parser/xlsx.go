@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		Rid  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	sb.WriteString(t.T)
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string    `xml:"r,attr"`
+			T      string    `xml:"t,attr"`
+			V      string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func parseXlsx(ctx context.Context, data []byte) ([]Sheet, error) {
+	files, err := zipFiles(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeZipXml(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	targets, err := readRelationships(files, "xl/_rels/workbook.xml.rels", "xl")
+	if err != nil {
+		return nil, err
+	}
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXml(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	sheets := make([]Sheet, 0, len(workbook.Sheets))
+	for _, ws := range workbook.Sheets {
+		var worksheet xlsxWorksheet
+		if err := decodeZipXml(files, targets[ws.Rid], &worksheet); err != nil {
+			return nil, err
+		}
+		sheet := Sheet{Name: ws.Name}
+		for i, row := range worksheet.Rows {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			sheetRow := SheetRow{Row: row.R}
+			if sheetRow.Row == 0 {
+				sheetRow.Row = i + 1
+			}
+			if sheetRow.Row < 0 || sheetRow.Row > maxSheetRows {
+				continue
+			}
+			for j, c := range row.Cells {
+				col := j
+				if c.R != "" {
+					col = columnIndex(c.R)
+				}
+				text := c.V
+				switch c.T {
+				case "s":
+					idx, err := strconv.Atoi(c.V)
+					if err == nil && idx >= 0 && idx < len(shared.Items) {
+						text = shared.Items[idx].String()
+					}
+				case "inlineStr":
+					if c.Inline != nil {
+						text = c.Inline.String()
+					}
+				case "b":
+					if c.V == "1" {
+						text = "TRUE"
+					} else {
+						text = "FALSE"
+					}
+				}
+				sheetRow.setCell(col, text)
+			}
+			if len(sheetRow.Cells) > 0 {
+				sheet.Rows = append(sheet.Rows, sheetRow)
+			}
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets, nil
+}
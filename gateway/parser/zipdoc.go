@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// helpers shared by the zip based office formats (OOXML and OpenDocument)
+
+type ooxmlRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+func zipFiles(data []byte) (map[string]*zip.File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	return files, nil
+}
+
+// openZipEntry opens an entry for reading up to DefaultParseLimits.MaxBytes,
+// so a small entry that inflates to gigabytes is cut before it fills memory.
+func openZipEntry(files map[string]*zip.File, name string) (io.ReadCloser, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("zip entry %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return limitedReadCloser{io.LimitReader(rc, DefaultParseLimits.MaxBytes), rc}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decodeZipXml unmarshals an entry, failing on one larger than
+// DefaultParseLimits.MaxBytes rather than inflating it whole.
+func decodeZipXml(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("zip entry %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	b, truncated, err := ReadLimited(context.Background(), rc, DefaultParseLimits.MaxBytes)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		return fmt.Errorf("zip entry %s larger than %d bytes", name, DefaultParseLimits.MaxBytes)
+	}
+	return xml.Unmarshal(b, v)
+}
+
+// readRelationships maps relationship ids to zip entry names. Relative targets
+// are resolved against baseDir.
+func readRelationships(files map[string]*zip.File, relsPath, baseDir string) (map[string]string, error) {
+	var rels ooxmlRelationships
+	if err := decodeZipXml(files, relsPath, &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		target := rel.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(baseDir, target)
+		}
+		targets[rel.Id] = target
+	}
+	return targets, nil
+}
+
+// coreProperties is docProps/core.xml of OOXML packages.
+type coreProperties struct {
+	Title    string `xml:"title"`
+	Creator  string `xml:"creator"`
+	Language string `xml:"language"`
+}
+
+// readCoreProperties fills the metadata of doc from docProps/core.xml when
+// the package has one.
+func readCoreProperties(files map[string]*zip.File, doc *Document) {
+	var props coreProperties
+	if err := decodeZipXml(files, "docProps/core.xml", &props); err != nil {
+		return
+	}
+	doc.Title = strings.TrimSpace(props.Title)
+	doc.Author = strings.TrimSpace(props.Creator)
+	doc.Language = strings.TrimSpace(props.Language)
+}
@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"wzinc/parser"
+
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// Fields derived for facets.
+const (
+	TopDirFieldName      = "top_dir"
+	UpdatedYearFieldName = "updated_year"
+	FeedFieldName        = "feed"
+)
+
+// Facets counted on request, by the facets parameter of queries.
+const (
+	FacetType = "type"
+	FacetDir  = "dir"
+	FacetYear = "year"
+	FacetFeed = "feed"
+)
+
+var facetFields = map[string]string{
+	FacetType: parser.TypeFieldName,
+	FacetDir:  TopDirFieldName,
+	FacetYear: UpdatedYearFieldName,
+	FacetFeed: FeedFieldName,
+}
+
+// indexFacets are the facets each index has.
+var indexFacets = map[string][]string{
+	FileIndex: {FacetType, FacetDir, FacetYear},
+	RssIndex:  {FacetFeed, FacetYear},
+}
+
+// maxFacetBuckets bounds the buckets returned for each facet.
+const maxFacetBuckets = 20
+
+// WatchRoot is the folder watched, top level folders are counted below it.
+var WatchRoot = "/data"
+
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// ParseFacets reads the facets parameter of a query on index, a comma list
+// of facets or "all" for those of the index. Empty is none.
+func ParseFacets(index, facets string) ([]string, error) {
+	facets = strings.ToLower(strings.TrimSpace(facets))
+	if facets == "" || facets == "false" {
+		return nil, nil
+	}
+	if facets == "all" || facets == "true" {
+		return indexFacets[index], nil
+	}
+	res := make([]string, 0)
+	for _, facet := range strings.Split(facets, ",") {
+		facet = strings.TrimSpace(facet)
+		if facet == "" {
+			continue
+		}
+		found := false
+		for _, f := range indexFacets[index] {
+			found = found || f == facet
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid facet %q, index %s has %s", facet, index, strings.Join(indexFacets[index], ", "))
+		}
+		res = append(res, facet)
+	}
+	return res, nil
+}
+
+// addFacetFields adds the fields counted by facets: the top level folder of
+// a file, the year it was last updated and the feeds of rss entries.
+func addFacetFields(doc map[string]interface{}) {
+	if where, ok := doc["where"].(string); ok {
+		doc[TopDirFieldName] = topDir(where)
+	}
+	updated := unixField(doc["updated"])
+	if updated == 0 {
+		updated = unixField(doc["created"])
+	}
+	if updated > 0 {
+		doc[UpdatedYearFieldName] = strconv.Itoa(time.Unix(updated, 0).Year())
+	}
+	if meta, ok := doc["meta"].(string); ok {
+		var rssMeta RssMeta
+		if err := json.Unmarshal([]byte(meta), &rssMeta); err == nil && len(rssMeta.FeedInfos) > 0 {
+			feeds := make([]string, 0, len(rssMeta.FeedInfos))
+			for _, feed := range rssMeta.FeedInfos {
+				feeds = append(feeds, feed.FeedName)
+			}
+			doc[FeedFieldName] = feeds
+		}
+	}
+}
+
+// topDir returns the first folder below WatchRoot on the way to where, "/"
+// for files right in it. Archive entries count as their archive.
+func topDir(where string) string {
+	rel := strings.TrimPrefix(path.Clean(parser.ArchiveRoot(where)), path.Clean(WatchRoot))
+	rel = strings.TrimPrefix(rel, "/")
+	i := strings.Index(rel, "/")
+	if i < 0 {
+		return "/"
+	}
+	return rel[:i]
+}
+
+// unixField reads a time field, an int64 when set here and a float64 when
+// read back from zinc.
+func unixField(v interface{}) int64 {
+	switch t := v.(type) {
+	case int64:
+		return t
+	case float64:
+		return int64(t)
+	}
+	return 0
+}
+
+// zincFacets counts the documents matching query in index by the fields of
+// facets. The sdk cannot decode bucket lists, so zinc is called directly.
+func (s *Service) zincFacets(index string, queryQuery zinc.MetaQuery, facets []string) (map[string][]FacetBucket, error) {
+	aggs := make(map[string]zinc.MetaAggregations)
+	for _, facet := range facets {
+		terms := *zinc.NewMetaAggregationsTerms()
+		terms.SetField(facetFields[facet])
+		terms.SetSize(maxFacetBuckets)
+		agg := *zinc.NewMetaAggregations()
+		agg.SetTerms(terms)
+		aggs[facet] = agg
+	}
+	query := *zinc.NewMetaZincQuery()
+	query.SetQuery(queryQuery)
+	query.SetSize(0)
+	query.SetAggs(aggs)
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	url := s.zincUrl + "/api/" + index + "/_search"
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(s.username, s.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, ErrQuery
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseFacets(respBody)
+}
+
+func parseFacets(body []byte) (map[string][]FacetBucket, error) {
+	var res struct {
+		Aggregations map[string]struct {
+			Buckets []struct {
+				Key      interface{} `json:"key"`
+				DocCount int         `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	facets := make(map[string][]FacetBucket)
+	for facet, agg := range res.Aggregations {
+		buckets := make([]FacetBucket, 0, len(agg.Buckets))
+		for _, b := range agg.Buckets {
+			buckets = append(buckets, FacetBucket{Value: fmt.Sprint(b.Key), Count: b.DocCount})
+		}
+		facets[facet] = buckets
+	}
+	return facets, nil
+}
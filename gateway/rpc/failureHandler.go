@@ -0,0 +1,135 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"wzinc/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// RetryParse parses a file of the watch dir again, set to inotify.RetryFile
+// in main since inotify depends on rpc.
+var RetryParse func(filepath string) error
+
+type ParseFailuresResp struct {
+	Count int               `json:"count"`
+	Items []db.ParseFailure `json:"items"`
+}
+
+// HandleParseFailures lists the files the watcher failed to parse.
+func (s *Service) HandleParseFailures(c *gin.Context) {
+	rep := Resp{
+		ResultCode: ErrorCodeUnknow,
+		ResultMsg:  "",
+	}
+	defer func() {
+		if rep.ResultCode == Success {
+			c.JSON(http.StatusOK, rep)
+		}
+	}()
+
+	limit := int64(0)
+	if v := c.Query("limit"); v != "" {
+		var err error
+		limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			rep.ResultCode = ErrorCodeInput
+			rep.ResultMsg = "limit invalid"
+			c.JSON(http.StatusBadRequest, rep)
+			return
+		}
+	}
+	failures, err := db.ListParseFailures(c.Query("quarantined") == "true", limit)
+	if err != nil {
+		rep.ResultMsg = err.Error()
+		log.Error().Msgf("list parse failures error %v", err)
+		c.JSON(http.StatusInternalServerError, rep)
+		return
+	}
+
+	rep.ResultCode = Success
+	repMsg, _ := json.Marshal(&ParseFailuresResp{Count: len(failures), Items: failures})
+	rep.ResultMsg = string(repMsg)
+}
+
+// watchedPath cleans filepath and tells if it is below WatchRoot.
+func watchedPath(filepath string) (string, bool) {
+	filepath = path.Clean(filepath)
+	root := path.Clean(WatchRoot)
+	return filepath, strings.HasPrefix(filepath, strings.TrimSuffix(root, "/")+"/")
+}
+
+// HandleParseRetry parses the failed file at path again, or every failed file
+// without path. Only files with a failure record below WatchRoot are retried,
+// quarantined ones too. Parsing runs in the background and the paths being
+// retried are returned.
+func (s *Service) HandleParseRetry(c *gin.Context) {
+	rep := Resp{
+		ResultCode: ErrorCodeUnknow,
+		ResultMsg:  "",
+	}
+	defer func() {
+		if rep.ResultCode == Success {
+			c.JSON(http.StatusOK, rep)
+		}
+	}()
+
+	if RetryParse == nil {
+		rep.ResultMsg = "retry not available"
+		c.JSON(http.StatusServiceUnavailable, rep)
+		return
+	}
+	paths := make([]string, 0)
+	if filepath := c.PostForm("path"); filepath != "" {
+		filepath, ok := watchedPath(filepath)
+		if !ok {
+			rep.ResultCode = ErrorCodeInput
+			rep.ResultMsg = "path not watched"
+			c.JSON(http.StatusBadRequest, rep)
+			return
+		}
+		failure, err := db.GetParseFailure(filepath)
+		if err != nil {
+			rep.ResultMsg = err.Error()
+			log.Error().Msgf("get parse failure %s error %v", filepath, err)
+			c.JSON(http.StatusInternalServerError, rep)
+			return
+		}
+		if failure == nil {
+			rep.ResultCode = ErrorCodeInput
+			rep.ResultMsg = "path has no parse failure"
+			c.JSON(http.StatusNotFound, rep)
+			return
+		}
+		paths = append(paths, filepath)
+	} else {
+		failures, err := db.ListParseFailures(false, 0)
+		if err != nil {
+			rep.ResultMsg = err.Error()
+			log.Error().Msgf("list parse failures error %v", err)
+			c.JSON(http.StatusInternalServerError, rep)
+			return
+		}
+		for _, failure := range failures {
+			if _, ok := watchedPath(failure.Path); ok {
+				paths = append(paths, failure.Path)
+			}
+		}
+	}
+	go func() {
+		for _, path := range paths {
+			if err := RetryParse(path); err != nil {
+				log.Error().Msgf("retry parse %s error %v", path, err)
+			}
+		}
+	}()
+
+	rep.ResultCode = Success
+	repMsg, _ := json.Marshal(&paths)
+	rep.ResultMsg = string(repMsg)
+}
@@ -0,0 +1,219 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wzinc/parser"
+
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// FileQueryFilter narrows a file query down, to mail from a sender or sent
+// in a date range, to files of some types, sizes, times or folder. Times are
+// unix seconds, sizes bytes. Zero values do not filter.
+type FileQueryFilter struct {
+	Sender   string `json:"sender,omitempty"`
+	DateFrom int64  `json:"sent_after,omitempty"`
+	DateTo   int64  `json:"sent_before,omitempty"`
+	// Types are extensions like ".pdf" or groups like "image"
+	Types         []string `json:"type,omitempty"`
+	MinSize       int64    `json:"min_size,omitempty"`
+	MaxSize       int64    `json:"max_size,omitempty"`
+	CreatedAfter  int64    `json:"created_after,omitempty"`
+	CreatedBefore int64    `json:"created_before,omitempty"`
+	UpdatedAfter  int64    `json:"updated_after,omitempty"`
+	UpdatedBefore int64    `json:"updated_before,omitempty"`
+	// Where is a folder, files anywhere below it pass
+	Where string `json:"where,omitempty"`
+}
+
+// ParseFileQueryFilter reads a filter from the form values of a query.
+func ParseFileQueryFilter(form func(string) string, now time.Time) (FileQueryFilter, error) {
+	filter := FileQueryFilter{Sender: strings.TrimSpace(form("sender"))}
+	var err error
+	for _, t := range strings.Split(form("type"), ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	if filter.MinSize, err = parseSize(form("min_size")); err != nil {
+		return filter, fmt.Errorf("min_size: %v", err)
+	}
+	if filter.MaxSize, err = parseSize(form("max_size")); err != nil {
+		return filter, fmt.Errorf("max_size: %v", err)
+	}
+	times := []struct {
+		name  string
+		value *int64
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+		{"sent_after", &filter.DateFrom},
+		{"sent_before", &filter.DateTo},
+	}
+	for _, t := range times {
+		if *t.value, err = parseTime(form(t.name), now); err != nil {
+			return filter, fmt.Errorf("%s: %v", t.name, err)
+		}
+	}
+	if where := strings.TrimSpace(form("where")); where != "" {
+		filter.Where = strings.TrimSuffix(where, "/") + "/"
+	}
+	return filter, nil
+}
+
+var sizeUnits = map[string]float64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"t":  1 << 40,
+	"tb": 1 << 40,
+}
+
+// parseSize reads a size in bytes like "2048", "10KB" or "1.5 MB". Empty is
+// zero.
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, want bytes or a number with KB, MB, GB or TB", s)
+	}
+	return int64(n * unit), nil
+}
+
+// parseTime reads a time as unix seconds, a date like "2023-04-01", or an
+// age like "30d", "12h" or "2w" before now. Empty is zero.
+func parseTime(s string, now time.Time) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+		switch s[len(s)-1] {
+		case 'h':
+			return now.Add(-time.Duration(n) * time.Hour).Unix(), nil
+		case 'd':
+			return now.AddDate(0, 0, -n).Unix(), nil
+		case 'w':
+			return now.AddDate(0, 0, -7*n).Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q, want unix seconds, a date like 2006-01-02 or an age like 30d", s)
+}
+
+// extensions returns the extensions the types of f stand for, sorted.
+func (f FileQueryFilter) extensions() []string {
+	set := make(map[string]bool)
+	for _, t := range f.Types {
+		for _, ext := range parser.TypeExtensions(t) {
+			set[ext] = true
+		}
+	}
+	exts := make([]string, 0, len(set))
+	for ext := range set {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+func (f FileQueryFilter) queries() []zinc.MetaQuery {
+	queries := make([]zinc.MetaQuery, 0)
+	if f.Sender != "" {
+		matchQuery := *zinc.NewMetaMatchQuery()
+		matchQuery.SetQuery(f.Sender)
+		matchQuery.SetOperator("and")
+		senderQuery := *zinc.NewMetaQuery()
+		senderQuery.SetMatch(map[string]zinc.MetaMatchQuery{
+			parser.FromFieldName: matchQuery,
+		})
+		queries = append(queries, senderQuery)
+	}
+	if exts := f.extensions(); len(exts) > 0 {
+		typeQueries := make([]zinc.MetaQuery, 0, len(exts))
+		for _, ext := range exts {
+			termQuery := *zinc.NewMetaTermQuery()
+			termQuery.SetValue(ext)
+			typeQuery := *zinc.NewMetaQuery()
+			typeQuery.SetTerm(map[string]zinc.MetaTermQuery{
+				parser.TypeFieldName: termQuery,
+			})
+			typeQueries = append(typeQueries, typeQuery)
+		}
+		boolQuery := *zinc.NewMetaBoolQuery()
+		boolQuery.SetShould(typeQueries)
+		typesQuery := *zinc.NewMetaQuery()
+		typesQuery.SetBool(boolQuery)
+		queries = append(queries, typesQuery)
+	}
+	if f.Where != "" {
+		prefixQuery := *zinc.NewMetaPrefixQuery()
+		prefixQuery.SetValue(f.Where)
+		whereQuery := *zinc.NewMetaQuery()
+		whereQuery.SetPrefix(map[string]zinc.MetaPrefixQuery{
+			"where": prefixQuery,
+		})
+		queries = append(queries, whereQuery)
+	}
+	ranges := []struct {
+		field    string
+		gte, lte int64
+	}{
+		{parser.DateFieldName, f.DateFrom, f.DateTo},
+		{"size", f.MinSize, f.MaxSize},
+		{"created", f.CreatedAfter, f.CreatedBefore},
+		{"updated", f.UpdatedAfter, f.UpdatedBefore},
+	}
+	for _, r := range ranges {
+		if q, ok := rangeQuery(r.field, r.gte, r.lte); ok {
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+// rangeQuery keeps values of field from gte to lte, either bound left out
+// when zero.
+func rangeQuery(field string, gte, lte int64) (zinc.MetaQuery, bool) {
+	queryQuery := *zinc.NewMetaQuery()
+	if gte <= 0 && lte <= 0 {
+		return queryQuery, false
+	}
+	rangeQuery := *zinc.NewMetaRangeQuery()
+	if gte > 0 {
+		rangeQuery.SetGte(strconv.FormatInt(gte, 10))
+	}
+	if lte > 0 {
+		rangeQuery.SetLte(strconv.FormatInt(lte, 10))
+	}
+	queryQuery.SetRange(map[string]zinc.MetaRangeQuery{
+		field: rangeQuery,
+	})
+	return queryQuery, true
+}
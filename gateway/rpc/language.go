@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"wzinc/parser"
+
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// ContentZhFieldName and ContentEnFieldName are the sub-fields of content
+// analyzed for Chinese and English. Every document is in all of them, the
+// query matches them along with content.
+const (
+	ContentZhFieldName = ContentFieldName + ".zh"
+	ContentEnFieldName = ContentFieldName + ".en"
+)
+
+// ChineseAnalyzer and ChineseSearchAnalyzer analyze content.zh, set from
+// CONTENT_ZH_ANALYZER and CONTENT_ZH_SEARCH_ANALYZER. An empty search
+// analyzer is the index one. Zinc has the gse analyzers only with
+// ZINC_PLUGIN_GSE_ENABLE=true, "cjk" works without it.
+var (
+	ChineseAnalyzer       = "gse_standard"
+	ChineseSearchAnalyzer = "gse_search"
+)
+
+// EnglishAnalyzer stems the words of content.en.
+var EnglishAnalyzer = "english"
+
+// languageBoost weighs matches in the sub-field of the language of a
+// document over those in the sub-fields of other languages.
+const languageBoost = 2
+
+// languageFields are the content sub-fields of the languages with their own
+// analyzer.
+var languageFields = []struct {
+	lang  string
+	field string
+}{
+	{"zh", ContentZhFieldName},
+	{"en", ContentEnFieldName},
+}
+
+// addLanguage sets the language of doc detected from its content when the
+// parser did not, as for rss entries. Tags like "en-GB" are reduced to the
+// language, the one matched by contentQueries.
+func addLanguage(doc map[string]interface{}) {
+	if lang, _ := doc[parser.LanguageFieldName].(string); lang != "" {
+		doc[parser.LanguageFieldName] = parser.PrimaryLanguage(lang)
+		return
+	}
+	content, _ := doc[ContentFieldName].(string)
+	if content == "" {
+		return
+	}
+	if lang := parser.DetectLanguage(content); lang != "" {
+		doc[parser.LanguageFieldName] = lang
+	}
+}
+
+// contentQueries match term against content and its language sub-fields,
+// each with its own analyzer. A match in the sub-field of the language of
+// the document counts languageBoost times.
+func contentQueries(term string) []zinc.MetaQuery {
+	queries := []zinc.MetaQuery{matchField(ContentFieldName, term, 1)}
+	for _, lf := range languageFields {
+		queries = append(queries, matchField(lf.field, term, 1))
+
+		langTerm := *zinc.NewMetaTermQuery()
+		langTerm.SetValue(lf.lang)
+		langQuery := *zinc.NewMetaQuery()
+		langQuery.SetTerm(map[string]zinc.MetaTermQuery{
+			parser.LanguageFieldName: langTerm,
+		})
+		boolQuery := *zinc.NewMetaBoolQuery()
+		boolQuery.SetMust([]zinc.MetaQuery{matchField(lf.field, term, languageBoost)})
+		boolQuery.SetFilter([]zinc.MetaQuery{langQuery})
+		subQuery := *zinc.NewMetaQuery()
+		subQuery.SetBool(boolQuery)
+		queries = append(queries, subQuery)
+	}
+	return queries
+}
+
+func matchField(field, term string, boost float32) zinc.MetaQuery {
+	matchQuery := *zinc.NewMetaMatchQuery()
+	matchQuery.SetQuery(term)
+	if boost != 1 {
+		matchQuery.SetBoost(boost)
+	}
+	subQuery := *zinc.NewMetaQuery()
+	subQuery.SetMatch(map[string]zinc.MetaMatchQuery{
+		field: matchQuery,
+	})
+	return subQuery
+}
+
+// contentProperty maps content, stored and highlighted by the default
+// analyzer, with the language sub-fields only indexed.
+func contentProperty() zinc.MetaProperty {
+	content := zinc.NewMetaProperty()
+	content.SetType("text")
+	content.SetIndex(true)
+	content.SetHighlightable(true)
+	content.SetAggregatable(false)
+	content.SetSortable(false)
+	content.SetStore(false)
+
+	zh := zinc.NewMetaProperty()
+	zh.SetType("text")
+	zh.SetIndex(true)
+	zh.SetHighlightable(false)
+	zh.SetAggregatable(false)
+	zh.SetStore(false)
+	zh.SetAnalyzer(ChineseAnalyzer)
+	if ChineseSearchAnalyzer != "" {
+		zh.SetSearchAnalyzer(ChineseSearchAnalyzer)
+	}
+
+	en := zinc.NewMetaProperty()
+	en.SetType("text")
+	en.SetIndex(true)
+	en.SetHighlightable(false)
+	en.SetAggregatable(false)
+	en.SetStore(false)
+	en.SetAnalyzer(EnglishAnalyzer)
+
+	content.SetFields(map[string]zinc.MetaProperty{
+		"zh": *zh,
+		"en": *en,
+	})
+	return *content
+}
@@ -0,0 +1,261 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"wzinc/parser"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// maxBacklinks bounds the notes returned as linking to one file.
+const maxBacklinks = 1000
+
+type LinkItem struct {
+	// Target is the link as stored on the note, a path or a wikilink name
+	Target string `json:"target,omitempty"`
+	Where  string `json:"where,omitempty"`
+	Name   string `json:"name,omitempty"`
+	DocId  string `json:"docId,omitempty"`
+}
+
+type LinksResp struct {
+	DocId     string     `json:"docId"`
+	Where     string     `json:"where"`
+	Links     []LinkItem `json:"links"`
+	Backlinks []LinkItem `json:"backlinks"`
+}
+
+// HandleLinks returns the outgoing links of a markdown note, resolved to the
+// files they point at when indexed, and the notes linking back to it.
+func (s *Service) HandleLinks(c *gin.Context) {
+	rep := Resp{
+		ResultCode: ErrorCodeUnknow,
+		ResultMsg:  "",
+	}
+	defer func() {
+		if rep.ResultCode == Success {
+			c.JSON(http.StatusOK, rep)
+		}
+	}()
+
+	docId := c.Query("docId")
+	if docId == "" {
+		rep.ResultMsg = "docId empty"
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	source, err := s.ZincGetDoc(FileIndex, docId)
+	if err != nil {
+		rep.ResultMsg = err.Error()
+		log.Error().Msgf("zinc get doc %s error %v", docId, err)
+		c.JSON(http.StatusNotFound, rep)
+		return
+	}
+	where, _ := source["where"].(string)
+	response := LinksResp{
+		DocId:     docId,
+		Where:     where,
+		Links:     make([]LinkItem, 0),
+		Backlinks: make([]LinkItem, 0),
+	}
+
+	targets := sourceStrings(source[parser.LinksFieldName])
+	linked := make(map[string]FileQueryResult)
+	if len(targets) > 0 {
+		res, err := s.ZincQueryByPaths(FileIndex, targets)
+		if err != nil {
+			log.Error().Msgf("zinc query links of %s error %v", docId, err)
+		} else {
+			docs, _ := GetFileQueryResult(res)
+			for _, doc := range docs {
+				linked[doc.Where] = doc
+			}
+		}
+	}
+	for _, target := range targets {
+		item := LinkItem{Target: target}
+		if doc, ok := linked[target]; ok {
+			item.Where, item.Name, item.DocId = doc.Where, doc.Name, doc.DocId
+		}
+		response.Links = append(response.Links, item)
+	}
+	for _, target := range sourceStrings(source[parser.WikiLinksFieldName]) {
+		item := LinkItem{Target: target}
+		if doc, err := s.resolveWikiLink(target); err == nil && doc != nil {
+			item.Where, item.Name, item.DocId = doc.Where, doc.Name, doc.DocId
+		}
+		response.Links = append(response.Links, item)
+	}
+
+	res, err := s.ZincQueryBacklinks(FileIndex, where, maxBacklinks)
+	if err != nil {
+		rep.ResultMsg = err.Error()
+		log.Error().Msg(rep.ResultMsg)
+		c.JSON(http.StatusNotFound, rep)
+		return
+	}
+	docs, _ := GetFileQueryResult(res)
+	for _, doc := range docs {
+		if doc.DocId == docId {
+			continue
+		}
+		response.Backlinks = append(response.Backlinks, LinkItem{Where: doc.Where, Name: doc.Name, DocId: doc.DocId})
+	}
+
+	rep.ResultCode = Success
+	repMsg, _ := json.Marshal(&response)
+	rep.ResultMsg = string(repMsg)
+}
+
+// resolveWikiLink finds the file a [[wikilink]] name points at, nil when
+// there is none.
+func (s *Service) resolveWikiLink(name string) (*FileQueryResult, error) {
+	query := *zinc.NewMetaZincQuery()
+	query.SetSize(DefaultMaxResult)
+	matchQuery := *zinc.NewMetaMatchQuery()
+	matchQuery.SetQuery(name)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetMatch(map[string]zinc.MetaMatchQuery{
+		"name": matchQuery,
+	})
+	query.SetQuery(queryQuery)
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Search.Search(ctx, FileIndex).Query(query).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+	}
+	docs, err := GetFileQueryResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	// the name query also matches other names sharing a word
+	for i := range docs {
+		if parser.WikiLinkName(docs[i].Name) == name {
+			return &docs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ZincQueryByPaths returns the documents of the files at paths, in one
+// search of a term per path.
+func (s *Service) ZincQueryByPaths(indexName string, paths []string) (*zinc.MetaSearchResponse, error) {
+	query := *zinc.NewMetaZincQuery()
+	query.SetSize(int32(len(paths)))
+	should := make([]zinc.MetaQuery, 0, len(paths))
+	for _, path := range paths {
+		termPathQuery := *zinc.NewMetaTermQuery()
+		termPathQuery.SetValue(path)
+		subQuery := *zinc.NewMetaQuery()
+		subQuery.SetTerm(map[string]zinc.MetaTermQuery{
+			"where": termPathQuery,
+		})
+		should = append(should, subQuery)
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetShould(should)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	query.SetQuery(queryQuery)
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+	}
+	return resp, nil
+}
+
+// ZincQueryBacklinks returns the notes linking to the file at where, by
+// relative link or by [[wikilink]] name.
+func (s *Service) ZincQueryBacklinks(indexName, where string, size int32) (*zinc.MetaSearchResponse, error) {
+	query := *zinc.NewMetaZincQuery()
+	query.SetSize(size)
+	termLinkQuery := *zinc.NewMetaTermQuery()
+	termLinkQuery.SetValue(where)
+	subQueryLinks := *zinc.NewMetaQuery()
+	subQueryLinks.SetTerm(map[string]zinc.MetaTermQuery{
+		parser.LinksFieldName: termLinkQuery,
+	})
+	termWikiLinkQuery := *zinc.NewMetaTermQuery()
+	termWikiLinkQuery.SetValue(parser.WikiLinkName(where))
+	subQueryWikiLinks := *zinc.NewMetaQuery()
+	subQueryWikiLinks.SetTerm(map[string]zinc.MetaTermQuery{
+		parser.WikiLinksFieldName: termWikiLinkQuery,
+	})
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetShould([]zinc.MetaQuery{subQueryLinks, subQueryWikiLinks})
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	query.SetQuery(queryQuery)
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+	}
+	return resp, nil
+}
+
+// ZincGetDoc returns the stored fields of a document.
+func (s *Service) ZincGetDoc(index, docId string) (map[string]interface{}, error) {
+	url := s.zincUrl + "/api/" + index + "/_doc/" + docId
+	req, err := http.NewRequest("GET", url, strings.NewReader(""))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(s.username, s.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get doc %s status %d: %s", docId, resp.StatusCode, body)
+	}
+	var doc struct {
+		Source map[string]interface{} `json:"_source"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Source, nil
+}
+
+// sourceStrings reads a field stored as a list of strings. A single value
+// comes back from zinc as a plain string.
+func sourceStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
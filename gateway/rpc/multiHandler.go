@@ -0,0 +1,254 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// AllIndices searches every index a query can.
+const AllIndices = "all"
+
+// rrfK damps the weight of the top ranks in reciprocal rank fusion.
+const rrfK = 60
+
+// maxFusedResults bounds how deep pages of a query on several indices go,
+// every index is searched from its first hit.
+const maxFusedResults = 1000
+
+// ErrMultiIndexOptions is returned for a query on several indices asking for
+// a filter, sort or facets, which only a query on one index applies.
+var ErrMultiIndexOptions = errors.New("filter, sort and facets need a query on a single index")
+
+type MultiQueryResp struct {
+	// Count is the number of all hits found in the indices
+	Count  int           `json:"count"`
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+	Items  []interface{} `json:"items"`
+	Cursor string        `json:"cursor,omitempty"`
+}
+
+// ParseIndices reads the index parameter of a query, one index, a comma
+// list of them or "all".
+func ParseIndices(index string) ([]string, error) {
+	if strings.TrimSpace(index) == AllIndices {
+		return []string{FileIndex, RssIndex}, nil
+	}
+	indices := make([]string, 0, 2)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(index, ",") {
+		name = strings.TrimSpace(name)
+		if name != FileIndex && name != RssIndex {
+			return nil, fmt.Errorf("only support index %s&%s or %s", FileIndex, RssIndex, AllIndices)
+		}
+		if !seen[name] {
+			seen[name] = true
+			indices = append(indices, name)
+		}
+	}
+	return indices, nil
+}
+
+// checkMultiIndexOptions rejects the filter, sort and facets of a query on
+// several indices, rather than leaving them out of the results silently.
+func checkMultiIndexOptions(form func(string) string) error {
+	filter, err := ParseFileQueryFilter(form, time.Now())
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(filter, FileQueryFilter{}) {
+		return ErrMultiIndexOptions
+	}
+	sort, err := ParseSort(form("sort"))
+	if err != nil {
+		return err
+	}
+	if sort != SortRelevance {
+		return ErrMultiIndexOptions
+	}
+	if facets := strings.ToLower(strings.TrimSpace(form("facets"))); facets != "" && facets != "false" {
+		return ErrMultiIndexOptions
+	}
+	return nil
+}
+
+// rankedList is the items found in one index, best first, and the total of
+// hits there.
+type rankedList struct {
+	index string
+	items []interface{}
+	total int
+	err   error
+}
+
+// HandleMultiQuery searches indices in parallel and merges their results by
+// reciprocal rank fusion, so scores of different indices need not compare.
+func (s *Service) HandleMultiQuery(c *gin.Context, indices []string) {
+	rep := Resp{
+		ResultCode: ErrorCodeUnknow,
+		ResultMsg:  "",
+	}
+
+	defer func() {
+		if rep.ResultCode == Success {
+			c.JSON(http.StatusOK, rep)
+		}
+	}()
+
+	term := c.PostForm("query")
+	if term == "" {
+		rep.ResultMsg = "term empty"
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	if _, err := ParseQuery(term, time.Now()); err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+
+	maxResults, err := parseLimit(c.PostForm("limit"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	if err := checkMultiIndexOptions(c.PostForm); err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	from, err := pageFrom(c.PostForm("offset"), c.PostForm("cursor"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	depth := int(from) + maxResults
+	if depth > maxFusedResults {
+		depth = maxFusedResults
+	}
+	log.Info().Msgf("zinc query indices %v term %s from %d max %v", indices, term, from, maxResults)
+
+	lists := make([]rankedList, len(indices))
+	var wg sync.WaitGroup
+	for i, index := range indices {
+		wg.Add(1)
+		go func(i int, index string) {
+			defer wg.Done()
+			lists[i] = s.queryRanked(index, term, depth)
+		}(i, index)
+	}
+	wg.Wait()
+
+	ranked := make([][]interface{}, 0, len(lists))
+	total := 0
+	for _, list := range lists {
+		if list.err != nil {
+			log.Error().Msgf("zinc query index %s error %v", list.index, list.err)
+			continue
+		}
+		ranked = append(ranked, list.items)
+		total += list.total
+	}
+	if len(ranked) == 0 {
+		rep.ResultMsg = "zincsearch query error" + lists[0].err.Error()
+		c.JSON(http.StatusNotFound, rep)
+		return
+	}
+
+	fused := fuseRanked(ranked)
+	items := make([]interface{}, 0, maxResults)
+	if int(from) < len(fused) {
+		items = fused[from:]
+		if len(items) > maxResults {
+			items = items[:maxResults]
+		}
+	}
+	next := int(from) + len(items)
+	if total > maxFusedResults {
+		total = maxFusedResults
+	}
+
+	rep.ResultCode = Success
+	response := MultiQueryResp{
+		Count:  total,
+		Offset: int(from),
+		Limit:  maxResults,
+		Items:  items,
+		Cursor: nextCursor(int32(next), total),
+	}
+	repMsg, _ := json.Marshal(&response)
+	rep.ResultMsg = string(repMsg)
+}
+
+// queryRanked returns the first size items found for term in index.
+func (s *Service) queryRanked(index, term string, size int) rankedList {
+	list := rankedList{index: index}
+	switch index {
+	case FileIndex:
+		items, total, _, err := s.queryFilePage(index, term, FileQueryFilter{}, SortRelevance, 0, size)
+		list.total, list.err = total, err
+		for _, item := range items {
+			list.items = append(list.items, item)
+		}
+	case RssIndex:
+		res, err := s.ZincRawQuery(index, term, 0, int32(size))
+		if err != nil {
+			list.err = err
+			break
+		}
+		results, err := GetRssQueryResult(res)
+		if err != nil {
+			list.err = err
+			break
+		}
+		list.total = hitsTotal(res)
+		for _, item := range slashRssQueryResult(results) {
+			list.items = append(list.items, item)
+		}
+	}
+	return list
+}
+
+// fuseRanked merges ranked lists by reciprocal rank fusion: an item ranked
+// r-th scores 1/(rrfK+r). Items scoring the same keep the order of their
+// lists, so the result is stable.
+func fuseRanked(lists [][]interface{}) []interface{} {
+	type fused struct {
+		item  interface{}
+		score float64
+		list  int
+	}
+	all := make([]fused, 0)
+	for l, items := range lists {
+		for r, item := range items {
+			all = append(all, fused{item: item, score: 1 / float64(rrfK+r+1), list: l})
+		}
+	}
+	sort.SliceStable(all, func(a, b int) bool {
+		if all[a].score != all[b].score {
+			return all[a].score > all[b].score
+		}
+		return all[a].list < all[b].list
+	})
+	res := make([]interface{}, len(all))
+	for i, f := range all {
+		res[i] = f.item
+	}
+	return res
+}
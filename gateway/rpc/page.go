@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// maxPageFetches bounds the zinc queries made to refill a page after files
+// were dropped from it.
+const maxPageFetches = 5
+
+// maxResultLimit bounds the page size a client may ask for.
+const maxResultLimit = 100
+
+var ErrCursor = errors.New("invalid cursor")
+
+// pageCursor is the position of the next page in the zinc hits. It is passed
+// to clients encoded, so its form may change.
+type pageCursor struct {
+	From int32 `json:"from"`
+}
+
+// pageFrom returns the zinc hit a page starts at, read from cursor when set
+// and from offset otherwise.
+func pageFrom(offset, cursor string) (int32, error) {
+	if cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return 0, ErrCursor
+		}
+		var c pageCursor
+		if err := json.Unmarshal(b, &c); err != nil || c.From < 0 {
+			return 0, ErrCursor
+		}
+		return c.From, nil
+	}
+	if offset == "" {
+		return 0, nil
+	}
+	from, err := strconv.ParseInt(offset, 10, 32)
+	if err != nil || from < 0 {
+		return 0, errors.New("invalid offset")
+	}
+	return int32(from), nil
+}
+
+// parseLimit returns the page size asked for, DefaultMaxResult when limit is
+// unset and at most maxResultLimit.
+func parseLimit(limit string) (int, error) {
+	if limit == "" {
+		return DefaultMaxResult, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid limit")
+	}
+	if n > maxResultLimit {
+		n = maxResultLimit
+	}
+	return n, nil
+}
+
+// nextCursor returns the cursor of the page starting at hit from, "" when
+// there are no more hits.
+func nextCursor(from int32, total int) string {
+	if int(from) >= total {
+		return ""
+	}
+	b, _ := json.Marshal(&pageCursor{From: from})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hitsTotal returns the number of all hits of a query.
+func hitsTotal(resp *zinc.MetaSearchResponse) int {
+	if resp.Hits == nil || resp.Hits.Total == nil {
+		return 0
+	}
+	return int(resp.Hits.Total.GetValue())
+}
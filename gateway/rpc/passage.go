@@ -0,0 +1,428 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"wzinc/parser"
+
+	"github.com/rs/zerolog/log"
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// PassageIndex holds the passages of long files, each pointing to the docId
+// of its file in FileIndex.
+const PassageIndex = "Passages"
+
+const (
+	ParentFieldName  = "parent"
+	PassageFieldName = "passage"
+	PageFieldName    = "page"
+	HeadingFieldName = "heading"
+)
+
+// maxPassagesPerFile bounds the passages of one file, the rest of it is only
+// searched through the file content.
+const maxPassagesPerFile = 10000
+
+// maxPassageSnippets bounds the passages returned for each file found.
+const maxPassageSnippets = 3
+
+// passageBulkSize is how many passages are sent to zinc at once.
+const passageBulkSize = 500
+
+type PassageQueryResult struct {
+	Parent      string   `json:"parent"`
+	Passage     int      `json:"passage"`
+	Page        int      `json:"page"`
+	Heading     string   `json:"heading"`
+	Score       float64  `json:"score"`
+	HightLights []string `json:"highlight"`
+}
+
+// ZincInputPassages replaces the passages of the file docId with those of
+// content. fields are the parser fields of content, whose sections give the
+// page and headings of every passage. Passages are written over those of the
+// last version by id, then the ones past the new end are deleted.
+func (s *Service) ZincInputPassages(docId, where, name, content string, fields map[string]interface{}) error {
+	var sections []parser.Section
+	if v, ok := fields[parser.SectionsFieldName].(string); ok {
+		if err := json.Unmarshal([]byte(v), &sections); err != nil {
+			log.Warn().Msgf("unmarshal sections of %s error %v", where, err)
+		}
+	}
+	passages := parser.SplitPassages(content, sections, parser.DefaultPassageSize, parser.DefaultPassageOverlap)
+	if len(passages) > maxPassagesPerFile {
+		log.Warn().Msgf("file %s has %d passages, indexing %d", where, len(passages), maxPassagesPerFile)
+		passages = passages[:maxPassagesPerFile]
+	}
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	for start := 0; start < len(passages); start += passageBulkSize {
+		end := start + passageBulkSize
+		if end > len(passages) {
+			end = len(passages)
+		}
+		records := make([]map[string]interface{}, 0, end-start)
+		for i, p := range passages[start:end] {
+			record := map[string]interface{}{
+				"_id":            passageId(docId, start+i),
+				ParentFieldName:  docId,
+				"where":          where,
+				"name":           name,
+				PassageFieldName: start + i,
+				ContentFieldName: p.Text,
+				PageFieldName:    p.Page,
+				HeadingFieldName: parser.HeadingPath(p.Headings),
+				"created":        time.Now().Unix(),
+			}
+			records = append(records, record)
+		}
+		ingest := *zinc.NewMetaJSONIngest()
+		ingest.SetIndex(PassageIndex)
+		ingest.SetRecords(records)
+		if _, _, err := s.apiClient.Document.Bulkv2(ctx).Query(ingest).Execute(); err != nil {
+			return fmt.Errorf("bulk input passages of %s error %v", where, err)
+		}
+	}
+	if err := s.zincDeletePassagesFrom(docId, len(passages)); err != nil {
+		return err
+	}
+	log.Debug().Msgf("zinc input %d passages of %s", len(passages), where)
+	return nil
+}
+
+// passageId is the document id of the n-th passage of the file docId.
+func passageId(docId string, n int) string {
+	return docId + "#" + strconv.Itoa(n)
+}
+
+// ZincDeletePassages deletes the passages of the file docId.
+func (s *Service) ZincDeletePassages(docId string) error {
+	return s.zincDeletePassagesFrom(docId, 0)
+}
+
+// zincDeletePassagesFrom deletes the passages of the file docId from the
+// n-th on, in one query.
+func (s *Service) zincDeletePassagesFrom(docId string, n int) error {
+	termParentQuery := *zinc.NewMetaTermQuery()
+	termParentQuery.SetValue(docId)
+	parentQuery := *zinc.NewMetaQuery()
+	parentQuery.SetTerm(map[string]zinc.MetaTermQuery{
+		ParentFieldName: termParentQuery,
+	})
+	filter := []zinc.MetaQuery{parentQuery}
+	if n > 0 {
+		fromQuery, _ := rangeQuery(PassageFieldName, int64(n), 0)
+		filter = append(filter, fromQuery)
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetFilter(filter)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	query := *zinc.NewMetaZincQuery()
+	query.SetQuery(queryQuery)
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	if _, _, err := s.apiClient.Search.DeleteByQuery(ctx, PassageIndex).Query(query).Execute(); err != nil {
+		return fmt.Errorf("error when calling `SearchApi.DeleteByQuery``: %v", err)
+	}
+	return nil
+}
+
+// ZincDeleteFile deletes the document of a file with its passages.
+func (s *Service) ZincDeleteFile(docId string) ([]byte, error) {
+	if err := s.ZincDeletePassages(docId); err != nil {
+		log.Error().Msgf("zinc delete passages of %s error %v", docId, err)
+	}
+	return s.ZincDelete(docId, FileIndex)
+}
+
+// passageQuery matches the passages containing text, of the files parents
+// only when set.
+func passageQuery(text string, parents []string) zinc.MetaQuery {
+	contentBoolQuery := *zinc.NewMetaBoolQuery()
+	contentBoolQuery.SetShould(contentQueries(text))
+	contentQuery := *zinc.NewMetaQuery()
+	contentQuery.SetBool(contentBoolQuery)
+	if len(parents) == 0 {
+		return contentQuery
+	}
+	parentQueries := make([]zinc.MetaQuery, 0, len(parents))
+	for _, parent := range parents {
+		termParentQuery := *zinc.NewMetaTermQuery()
+		termParentQuery.SetValue(parent)
+		parentQuery := *zinc.NewMetaQuery()
+		parentQuery.SetTerm(map[string]zinc.MetaTermQuery{
+			ParentFieldName: termParentQuery,
+		})
+		parentQueries = append(parentQueries, parentQuery)
+	}
+	parentBoolQuery := *zinc.NewMetaBoolQuery()
+	parentBoolQuery.SetShould(parentQueries)
+	parentQuery := *zinc.NewMetaQuery()
+	parentQuery.SetBool(parentBoolQuery)
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetMust([]zinc.MetaQuery{contentQuery})
+	boolQuery.SetFilter([]zinc.MetaQuery{parentQuery})
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+// zincQueryPassages returns the passages of files matching text, best first.
+func (s *Service) zincQueryPassages(text string, files []FileQueryResult) ([]PassageQueryResult, error) {
+	parents := make([]string, 0, len(files))
+	for _, file := range files {
+		parents = append(parents, file.DocId)
+	}
+	if len(parents) == 0 {
+		return nil, nil
+	}
+	// leave room for files with many matching passages
+	size := len(files) * maxPassageSnippets * 2
+	if size > 1000 {
+		size = 1000
+	}
+	resp, err := s.zincSearch(PassageIndex, passageQuery(text, parents), 0, int32(size))
+	if err != nil {
+		return nil, err
+	}
+	return GetPassageQueryResult(resp), nil
+}
+
+// rankFiles returns the ids of the first maxFusedResults files matching term
+// and filter by relevance, and the total of files found. Scores of files and
+// passages do not compare, so the files ranked by their own score and by
+// their best passage matching text are merged by reciprocal rank fusion. A
+// file whose passage matches well rises even when the file alone ranks far
+// down. extra are the files ranked only by their passage, which come after
+// the first maxFusedResults files by their own score.
+func (s *Service) rankFiles(index, term, text string, filter FileQueryFilter) (ranked, extra []string, total int, err error) {
+	query, err := fileQuery(term, filter)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	files, err := s.zincSearchFields(index, query, []string{"where"}, maxFusedResults)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	total = hitsTotal(files)
+	fileIds := hitIds(files)
+	passages, err := s.zincSearchFields(PassageIndex, passageQuery(text, nil), []string{ParentFieldName}, maxFusedResults)
+	if err != nil {
+		log.Error().Msgf("zinc query passages error %v", err)
+		return fileIds, nil, total, nil
+	}
+
+	known := make(map[string]bool, len(fileIds))
+	for _, id := range fileIds {
+		known[id] = true
+	}
+	parents := make([]string, 0)
+	seen := make(map[string]bool)
+	missing := make([]string, 0)
+	for _, hit := range passages.Hits.Hits {
+		parent, _ := hit.Source[ParentFieldName].(string)
+		if parent == "" || seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		parents = append(parents, parent)
+		if !known[parent] {
+			missing = append(missing, parent)
+		}
+	}
+	// files found by a passage past those ranked still have to match the
+	// query and filter, they are counted in total already
+	if len(missing) > 0 {
+		found, err := s.zincSearchFields(index, withIds(query, missing), []string{"where"}, int32(len(missing)))
+		if err != nil {
+			log.Error().Msgf("zinc query files of passages error %v", err)
+		} else {
+			extra = hitIds(found)
+			for _, id := range extra {
+				known[id] = true
+			}
+		}
+	}
+	rankedParents := make([]string, 0, len(parents))
+	for _, parent := range parents {
+		if known[parent] {
+			rankedParents = append(rankedParents, parent)
+		}
+	}
+	return fuseIds([][]string{fileIds, rankedParents}), extra, total, nil
+}
+
+// zincSearchFields returns the first size hits of a query with only fields
+// of their sources, to rank documents without fetching them.
+func (s *Service) zincSearchFields(indexName string, queryQuery zinc.MetaQuery, fields []string, size int32) (*zinc.MetaSearchResponse, error) {
+	query := *zinc.NewMetaZincQuery()
+	query.SetQuery(queryQuery)
+	query.SetSize(size)
+	query.SetSource(fields)
+	query.SetTrackTotalHits(true)
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+	}
+	return resp, nil
+}
+
+// idsQuery matches the documents ids.
+func idsQuery(ids []string) zinc.MetaQuery {
+	values := *zinc.NewMetaIdsQuery()
+	values.SetValues(ids)
+	query := *zinc.NewMetaQuery()
+	query.SetIds(values)
+	return query
+}
+
+// withIds narrows query to the documents ids.
+func withIds(query zinc.MetaQuery, ids []string) zinc.MetaQuery {
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetMust([]zinc.MetaQuery{query})
+	boolQuery.SetFilter([]zinc.MetaQuery{idsQuery(ids)})
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+// withoutIds leaves the documents ids out of query.
+func withoutIds(query zinc.MetaQuery, ids []string) zinc.MetaQuery {
+	if len(ids) == 0 {
+		return query
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetMust([]zinc.MetaQuery{query})
+	boolQuery.SetMustNot([]zinc.MetaQuery{idsQuery(ids)})
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+func hitIds(resp *zinc.MetaSearchResponse) []string {
+	ids := make([]string, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		if hit.Id != nil {
+			ids = append(ids, *hit.Id)
+		}
+	}
+	return ids
+}
+
+// fuseIds merges ranked lists of ids by reciprocal rank fusion like
+// fuseRanked, summing the scores of an id found in several lists.
+func fuseIds(lists [][]string) []string {
+	scores := make(map[string]float64)
+	order := make([]string, 0)
+	for _, ids := range lists {
+		for r, id := range ids {
+			if _, ok := scores[id]; !ok {
+				order = append(order, id)
+			}
+			scores[id] += 1 / float64(rrfK+r+1)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	return order
+}
+
+func GetPassageQueryResult(resp *zinc.MetaSearchResponse) []PassageQueryResult {
+	resultList := make([]PassageQueryResult, 0)
+	for _, hit := range resp.Hits.Hits {
+		result := PassageQueryResult{
+			HightLights: make([]string, 0),
+		}
+		if parent, ok := hit.Source[ParentFieldName].(string); ok {
+			result.Parent = parent
+		}
+		if passage, ok := hit.Source[PassageFieldName].(float64); ok {
+			result.Passage = int(passage)
+		}
+		if page, ok := hit.Source[PageFieldName].(float64); ok {
+			result.Page = int(page)
+		}
+		if heading, ok := hit.Source[HeadingFieldName].(string); ok {
+			result.Heading = heading
+		}
+		if hit.Score != nil {
+			result.Score = float64(*hit.Score)
+		}
+		for _, highlightRes := range hit.Highlight {
+			for _, h := range highlightRes.([]interface{}) {
+				result.HightLights = append(result.HightLights, h.(string))
+			}
+		}
+		resultList = append(resultList, result)
+	}
+	return resultList
+}
+
+// groupPassages attaches the best passages to the files they belong to.
+func groupPassages(results []FileQueryResult, passages []PassageQueryResult) []FileQueryResult {
+	byParent := make(map[string][]PassageQueryResult)
+	for _, p := range passages {
+		byParent[p.Parent] = append(byParent[p.Parent], p)
+	}
+	for i := range results {
+		group := byParent[results[i].DocId]
+		if len(group) == 0 {
+			continue
+		}
+		sort.SliceStable(group, func(a, b int) bool {
+			return group[a].Score > group[b].Score
+		})
+		if len(group) > maxPassageSnippets {
+			group = group[:maxPassageSnippets]
+		}
+		results[i].Passages = group
+	}
+	return results
+}
+
+// passageIndexProperties maps the fields of PassageIndex.
+func passageIndexProperties() map[string]zinc.MetaProperty {
+	keyword := zinc.NewMetaProperty()
+	keyword.SetType("keyword")
+	keyword.SetIndex(true)
+	keyword.SetAggregatable(false)
+
+	name := zinc.NewMetaProperty()
+	name.SetType("text")
+	name.SetIndex(false)
+	name.SetHighlightable(false)
+	name.SetAggregatable(false)
+
+	number := zinc.NewMetaProperty()
+	number.SetType("numeric")
+	number.SetIndex(true)
+	number.SetSortable(true)
+	number.SetAggregatable(false)
+
+	properties := map[string]zinc.MetaProperty{
+		ContentFieldName: contentProperty(),
+		ParentFieldName:  *keyword,
+		"where":          *keyword,
+		"name":           *name,
+		HeadingFieldName: *name,
+		PassageFieldName: *number,
+		PageFieldName:    *number,
+		"created":        *number,
+	}
+	return properties
+}
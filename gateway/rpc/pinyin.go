@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// Pinyin forms of Chinese names, so they can be typed on a Latin keyboard.
+const (
+	NamePinyinFieldName   = "name_pinyin"
+	NameInitialsFieldName = "name_initials"
+)
+
+var pinyinArgs = pinyin.NewArgs()
+
+// PinyinName returns the full pinyin and the initials of the Chinese name of
+// a file, without its extension, e.g. "nihaobaogao haobaogao baogao gao" and
+// "nhbg hbg bg g" for 你好报告.docx. Every word starts a token, so a prefix
+// of the tokens finds the name from any word on. Latin words and numbers are
+// kept as words. Characters with several readings take the most common one.
+// Both are "" for names without Chinese.
+func PinyinName(filename string) (string, string) {
+	name := strings.TrimSuffix(filename, path.Ext(filename))
+	syllables := make([]string, 0)
+	hasHan := false
+	word := make([]rune, 0)
+	endWord := func() {
+		if len(word) > 0 {
+			syllables = append(syllables, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	for _, r := range name {
+		if unicode.Is(unicode.Han, r) {
+			endWord()
+			if readings := pinyin.SinglePinyin(r, pinyinArgs); len(readings) > 0 {
+				syllables = append(syllables, readings[0])
+				hasHan = true
+			}
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			word = append(word, r)
+			continue
+		}
+		endWord()
+	}
+	endWord()
+	if !hasHan {
+		return "", ""
+	}
+	full := make([]string, 0, len(syllables))
+	initials := make([]string, 0, len(syllables))
+	for i := range syllables {
+		full = append(full, strings.Join(syllables[i:], ""))
+		var sb strings.Builder
+		for _, s := range syllables[i:] {
+			sb.WriteByte(s[0])
+		}
+		initials = append(initials, sb.String())
+	}
+	return strings.Join(full, " "), strings.Join(initials, " ")
+}
+
+// addPinyinName adds the pinyin forms of the name of doc.
+func addPinyinName(doc map[string]interface{}) {
+	name, _ := doc["name"].(string)
+	full, initials := PinyinName(name)
+	if full == "" {
+		return
+	}
+	doc[NamePinyinFieldName] = full
+	doc[NameInitialsFieldName] = initials
+}
+
+// pinyinQueries match a term typed in pinyin, like "nihao", "ni hao" or
+// "nh", against the start of the pinyin forms of names. None for terms that
+// cannot be pinyin.
+func pinyinQueries(term string) []zinc.MetaQuery {
+	key := strings.ToLower(strings.Join(strings.Fields(term), ""))
+	if len(key) < 2 {
+		return nil
+	}
+	for _, r := range key {
+		if r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return nil
+		}
+	}
+	queries := make([]zinc.MetaQuery, 0, 2)
+	for _, field := range []string{NamePinyinFieldName, NameInitialsFieldName} {
+		prefixQuery := *zinc.NewMetaPrefixQuery()
+		prefixQuery.SetValue(key)
+		subQuery := *zinc.NewMetaQuery()
+		subQuery.SetPrefix(map[string]zinc.MetaPrefixQuery{
+			field: prefixQuery,
+		})
+		queries = append(queries, subQuery)
+	}
+	return queries
+}
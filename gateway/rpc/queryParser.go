@@ -0,0 +1,398 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// Fields of the query language, written as field:value.
+const (
+	QueryFieldName   = "name"
+	QueryFieldExt    = "ext"
+	QueryFieldIn     = "in"
+	QueryFieldBefore = "before"
+	QueryFieldAfter  = "after"
+	QueryFieldSize   = "size"
+	QueryFieldSymbol = "symbol"
+)
+
+var queryFields = map[string]bool{
+	QueryFieldName:   true,
+	QueryFieldExt:    true,
+	QueryFieldIn:     true,
+	QueryFieldBefore: true,
+	QueryFieldAfter:  true,
+	QueryFieldSize:   true,
+	QueryFieldSymbol: true,
+}
+
+// filterFields narrow the results without scoring them.
+var filterFields = map[string]bool{
+	QueryFieldExt:    true,
+	QueryFieldIn:     true,
+	QueryFieldBefore: true,
+	QueryFieldAfter:  true,
+	QueryFieldSize:   true,
+}
+
+// queryOr joins the terms around it, one of them has to match.
+const queryOr = "OR"
+
+// SearchQuery is a parsed query. Groups are terms joined by OR, a group is
+// required when one of its terms is, see QueryTerm.Required.
+type SearchQuery struct {
+	Groups [][]QueryTerm
+}
+
+// QueryTerm is a word, a "quoted phrase" or a field:value of a query.
+type QueryTerm struct {
+	Field   string
+	Value   string
+	Phrase  bool
+	Exclude bool
+	// Require is set by +term
+	Require bool
+	// Min and Max bound the time or size of before:, after: and size:
+	Min, Max int64
+}
+
+// Required tells if a document has to match t: +terms, phrases and fields.
+// Plain words only have to match one among them.
+func (t QueryTerm) Required() bool {
+	return t.Require || t.Phrase || t.Field != ""
+}
+
+// QuerySyntaxError tells where a query is malformed.
+type QuerySyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at %d: %s", e.Pos, e.Msg)
+}
+
+// ParseQuery parses the query language: results match any of the words,
+// while +term requires a word and "quoted phrases" always are. -term excludes
+// a term and OR joins terms, one of which has to match. Fields narrow a term to name:, or filter files by
+// ext:pdf, in:/data/docs, before:2023-01-01, after:30d, size:>10MB and
+// symbol:. Words with an unknown field are matched as they are. Relative
+// times are taken before now.
+func ParseQuery(input string, now time.Time) (*SearchQuery, error) {
+	q := &SearchQuery{Groups: make([][]QueryTerm, 0)}
+	runes := []rune(input)
+	pendingOr := -1
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		term := QueryTerm{}
+		if runes[i] == '-' || runes[i] == '+' {
+			term.Exclude = runes[i] == '-'
+			term.Require = runes[i] == '+'
+			i++
+			if i == len(runes) || unicode.IsSpace(runes[i]) {
+				return nil, &QuerySyntaxError{start, fmt.Sprintf("missing term after %c", runes[start])}
+			}
+		}
+		var err error
+		if runes[i] != '"' {
+			// field:value, the value possibly quoted
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != ':' && runes[end] != '"' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ':' && queryFields[strings.ToLower(string(runes[i:end]))] {
+				term.Field = strings.ToLower(string(runes[i:end]))
+				i = end + 1
+			}
+		}
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &QuerySyntaxError{i, "unterminated quote"}
+			}
+			term.Value = strings.TrimSpace(string(runes[i+1 : end]))
+			term.Phrase = true
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			term.Value = string(runes[i:end])
+			i = end
+		}
+
+		if term.Field == "" && !term.Phrase && term.Value == queryOr && runes[start] != '+' && runes[start] != '-' {
+			if len(q.Groups) == 0 || pendingOr >= 0 {
+				return nil, &QuerySyntaxError{start, "OR needs a term on both sides"}
+			}
+			pendingOr = start
+			continue
+		}
+		if term.Value == "" {
+			if term.Field != "" {
+				return nil, &QuerySyntaxError{start, fmt.Sprintf("missing value after %s:", term.Field)}
+			}
+			return nil, &QuerySyntaxError{start, "empty phrase"}
+		}
+		if term, err = parseQueryField(term, now); err != nil {
+			return nil, &QuerySyntaxError{start, err.Error()}
+		}
+		if pendingOr < 0 {
+			q.Groups = append(q.Groups, []QueryTerm{term})
+			continue
+		}
+		last := len(q.Groups) - 1
+		if term.Exclude || q.Groups[last][0].Exclude {
+			return nil, &QuerySyntaxError{pendingOr, "excluded terms cannot be joined by OR"}
+		}
+		q.Groups[last] = append(q.Groups[last], term)
+		pendingOr = -1
+	}
+	if pendingOr >= 0 {
+		return nil, &QuerySyntaxError{pendingOr, "OR needs a term on both sides"}
+	}
+	if len(q.Groups) == 0 {
+		return nil, &QuerySyntaxError{0, "empty query"}
+	}
+	return q, nil
+}
+
+// parseQueryField checks the value of term by its field and reads the bounds
+// of times and sizes.
+func parseQueryField(term QueryTerm, now time.Time) (QueryTerm, error) {
+	var err error
+	switch term.Field {
+	case QueryFieldBefore, QueryFieldAfter:
+		var t int64
+		if t, err = parseTime(term.Value, now); err != nil {
+			return term, err
+		}
+		if t <= 0 {
+			return term, fmt.Errorf("invalid time %q", term.Value)
+		}
+		if term.Field == QueryFieldBefore {
+			term.Max = t
+		} else {
+			term.Min = t
+		}
+	case QueryFieldSize:
+		if term.Min, term.Max, err = parseSizeRange(term.Value); err != nil {
+			return term, err
+		}
+		if term.Min <= 0 && term.Max <= 0 {
+			return term, fmt.Errorf("size %q matches no files", term.Value)
+		}
+	case QueryFieldExt:
+		if len((FileQueryFilter{Types: strings.Split(term.Value, ",")}).extensions()) == 0 {
+			return term, fmt.Errorf("invalid type %q", term.Value)
+		}
+	case QueryFieldIn:
+		term.Value = strings.TrimSuffix(term.Value, "/") + "/"
+	}
+	return term, err
+}
+
+// parseSizeRange reads >10MB, >=10MB, <1MB, <=1MB or 1MB..10MB.
+func parseSizeRange(s string) (int64, int64, error) {
+	if i := strings.Index(s, ".."); i >= 0 {
+		min, err := parseSize(s[:i])
+		if err != nil {
+			return 0, 0, err
+		}
+		max, err := parseSize(s[i+2:])
+		return min, max, err
+	}
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+		n, err := parseSize(s[len(op):])
+		if err != nil {
+			return 0, 0, err
+		}
+		switch op {
+		case ">=":
+			return n, 0, nil
+		case "<=":
+			return 0, n, nil
+		case ">":
+			return n + 1, 0, nil
+		}
+		return 0, n - 1, nil
+	}
+	return 0, 0, fmt.Errorf("invalid size %q, want >10MB, <1MB or 1MB..10MB", s)
+}
+
+// Text returns the words and phrases a result should contain, to find and
+// highlight the passages matching the query.
+func (q *SearchQuery) Text() string {
+	words := make([]string, 0)
+	for _, group := range q.Groups {
+		for _, term := range group {
+			if term.Field == "" && !term.Exclude {
+				words = append(words, term.Value)
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Query compiles q into a zinc bool query. Required groups go to its must
+// clauses and plain words to should, one of them matching when nothing is
+// required. Filters of single groups go to its filter clauses and do not
+// score.
+func (q *SearchQuery) Query() zinc.MetaQuery {
+	must := make([]zinc.MetaQuery, 0)
+	should := make([]zinc.MetaQuery, 0)
+	filter := make([]zinc.MetaQuery, 0)
+	mustNot := make([]zinc.MetaQuery, 0)
+	for _, group := range q.Groups {
+		if len(group) == 1 {
+			term := group[0]
+			switch {
+			case term.Exclude:
+				mustNot = append(mustNot, term.query())
+			case filterFields[term.Field]:
+				filter = append(filter, term.query())
+			case term.Required():
+				must = append(must, term.query())
+			default:
+				should = append(should, term.query())
+			}
+			continue
+		}
+		required := false
+		or := make([]zinc.MetaQuery, 0, len(group))
+		for _, term := range group {
+			required = required || term.Required()
+			or = append(or, term.query())
+		}
+		// words joined by OR are plain words already
+		if !required {
+			should = append(should, or...)
+			continue
+		}
+		boolQuery := *zinc.NewMetaBoolQuery()
+		boolQuery.SetShould(or)
+		orQuery := *zinc.NewMetaQuery()
+		orQuery.SetBool(boolQuery)
+		must = append(must, orQuery)
+	}
+	if len(filter) == 0 && len(mustNot) == 0 {
+		if len(must) == 1 && len(should) == 0 {
+			return must[0]
+		}
+		if len(must) == 0 && len(should) == 1 {
+			return should[0]
+		}
+	}
+	if len(must) == 0 && len(should) == 0 {
+		matchAll := *zinc.NewMetaQuery()
+		matchAll.SetMatchAll(map[string]interface{}{})
+		must = append(must, matchAll)
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	if len(must) > 0 {
+		boolQuery.SetMust(must)
+	}
+	if len(should) > 0 {
+		boolQuery.SetShould(should)
+		// with required terms the words only raise the score
+		if len(must) == 0 {
+			boolQuery.SetMinimumShouldMatch(1)
+		}
+	}
+	if len(filter) > 0 {
+		boolQuery.SetFilter(filter)
+	}
+	if len(mustNot) > 0 {
+		boolQuery.SetMustNot(mustNot)
+	}
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+func (t QueryTerm) query() zinc.MetaQuery {
+	switch t.Field {
+	case QueryFieldName:
+		return nameQuery(t.Value, t.Phrase)
+	case QueryFieldSymbol:
+		return symbolQuery(t.Value)
+	case QueryFieldExt:
+		return FileQueryFilter{Types: strings.Split(t.Value, ",")}.queries()[0]
+	case QueryFieldIn:
+		return FileQueryFilter{Where: t.Value}.queries()[0]
+	case QueryFieldBefore, QueryFieldAfter:
+		q, _ := rangeQuery("updated", t.Min, t.Max)
+		return q
+	case QueryFieldSize:
+		q, _ := rangeQuery("size", t.Min, t.Max)
+		return q
+	}
+	if t.Phrase {
+		return phraseQuery(t.Value)
+	}
+	return termQuery(t.Value)
+}
+
+// phraseQuery matches the words of phrase in a row, in the content or the
+// name of documents.
+func phraseQuery(phrase string) zinc.MetaQuery {
+	should := make([]zinc.MetaQuery, 0, 5)
+	for _, field := range []string{ContentFieldName, ContentZhFieldName, ContentEnFieldName, "name", "format_name"} {
+		phraseQuery := *zinc.NewMetaMatchPhraseQuery()
+		phraseQuery.SetQuery(phrase)
+		subQuery := *zinc.NewMetaQuery()
+		subQuery.SetMatchPhrase(map[string]zinc.MetaMatchPhraseQuery{
+			field: phraseQuery,
+		})
+		should = append(should, subQuery)
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetShould(should)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+// nameQuery matches all words of name, or the phrase, in the names of
+// documents, also when typed in pinyin.
+func nameQuery(name string, phrase bool) zinc.MetaQuery {
+	should := make([]zinc.MetaQuery, 0, 4)
+	for _, field := range []string{"name", "format_name"} {
+		subQuery := *zinc.NewMetaQuery()
+		if phrase {
+			phraseQuery := *zinc.NewMetaMatchPhraseQuery()
+			phraseQuery.SetQuery(name)
+			subQuery.SetMatchPhrase(map[string]zinc.MetaMatchPhraseQuery{
+				field: phraseQuery,
+			})
+		} else {
+			matchQuery := *zinc.NewMetaMatchQuery()
+			matchQuery.SetQuery(name)
+			matchQuery.SetOperator("and")
+			subQuery.SetMatch(map[string]zinc.MetaMatchQuery{
+				field: matchQuery,
+			})
+		}
+		should = append(should, subQuery)
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetShould(append(should, pinyinQueries(name)...))
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
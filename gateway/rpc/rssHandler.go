@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,10 +12,12 @@ import (
 )
 
 type RssQueryResp struct {
-	Count  int            `json:"count"`
-	Offset int            `json:"offset"`
-	Limit  int            `json:"limit"`
-	Items  []RssQueryItem `json:"items"`
+	Count  int                      `json:"count"`
+	Offset int                      `json:"offset"`
+	Limit  int                      `json:"limit"`
+	Items  []RssQueryItem           `json:"items"`
+	Cursor string                   `json:"cursor,omitempty"`
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
 }
 
 type FeedInfo struct {
@@ -153,13 +154,37 @@ func (s *Service) HandleRssQuery(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, rep)
 		return
 	}
+	q, err := ParseQuery(term, time.Now())
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
 
-	maxResults, err := strconv.Atoi(c.PostForm("limit"))
+	maxResults, err := parseLimit(c.PostForm("limit"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	from, err := pageFrom(c.PostForm("offset"), c.PostForm("cursor"))
 	if err != nil {
-		maxResults = DefaultMaxResult
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	facets, err := ParseFacets(index, c.PostForm("facets"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
 	}
-	log.Info().Msgf("zinc query index %s term %s max %v", index, term, maxResults)
-	res, err := s.ZincRawQuery(index, term, int32(maxResults))
+	log.Info().Msgf("zinc query index %s term %s from %d max %v", index, term, from, maxResults)
+	res, err := s.ZincRawQuery(index, term, from, int32(maxResults))
 	if err != nil {
 		rep.ResultMsg = "zincsearch query error" + err.Error()
 		log.Error().Msg(rep.ResultMsg)
@@ -177,11 +202,19 @@ func (s *Service) HandleRssQuery(c *gin.Context) {
 
 	rep.ResultCode = Success
 	items := slashRssQueryResult(results)
+	total := hitsTotal(res)
 	response := RssQueryResp{
-		Count:  len(items),
-		Offset: 0,
+		Count:  total,
+		Offset: int(from),
 		Limit:  maxResults,
 		Items:  items,
+		Cursor: nextCursor(from+int32(len(results)), total),
+	}
+	if len(facets) > 0 {
+		response.Facets, err = s.zincFacets(index, q.Query(), facets)
+		if err != nil {
+			log.Error().Msgf("zinc query facets error %v", err)
+		}
 	}
 	repMsg, _ := json.Marshal(&response)
 	rep.ResultMsg = string(repMsg)
@@ -189,6 +222,7 @@ func (s *Service) HandleRssQuery(c *gin.Context) {
 
 type RssQueryItem struct {
 	RssMeta
+	Index   string `json:"index"`
 	DocId   string `json:"docId"`
 	Snippet string `json:"snippet"`
 }
@@ -222,6 +256,7 @@ func shortRssQueryResult(res RssQueryResult) RssQueryItem {
 			FeedInfos: meta.FeedInfos,
 			Borders:   meta.Borders,
 		},
+		Index:   RssIndex,
 		DocId:   res.DocId,
 		Snippet: snippet,
 	}
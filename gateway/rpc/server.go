@@ -83,6 +83,15 @@ func InitRpcService(url, port, username, password string, bsModelConfig map[stri
 			panic(err)
 		}
 
+		//fill the spelling dictionary with the files indexed so far, before
+		//the watcher replaces any
+		if err := RpcServer.LoadVocabulary(DefaultVocabulary, FileIndex); err != nil {
+			log.Error().Msgf("load vocabulary of %s error %v", FileIndex, err)
+		}
+
+		//load the files opened lately to suggest
+		recent.loadInBackground()
+
 		//load ai model
 		for modelName, url := range bsModelConfig {
 			log.Info().Msgf("init model name:%s url:%s", modelName, url)
@@ -137,6 +146,11 @@ func (c *Service) loadRoutes(ctx context.Context) error {
 	RpcEngine.POST("/api/input", c.HandleInput)
 	RpcEngine.POST("/api/delete", c.HandleDelete)
 	RpcEngine.POST("/api/query", c.HandleQuery)
+	RpcEngine.GET("/api/links", c.HandleLinks)
+	RpcEngine.GET("/api/suggest", c.HandleSuggest)
+	RpcEngine.POST("/api/opened", c.HandleOpened)
+	RpcEngine.GET("/api/index/failures", c.HandleParseFailures)
+	RpcEngine.POST("/api/index/retry", c.HandleParseRetry)
 
 	RpcEngine.POST("/api/ai/question", c.HandleQuestion)
 	RpcEngine.POST("/api/ai/fake/callback", func(c *gin.Context) {
@@ -188,18 +202,23 @@ func (s *Service) HandleDelete(c *gin.Context) {
 }
 
 func (s *Service) HandleQuery(c *gin.Context) {
-	index := c.Query("index")
-	if index != FileIndex && index != RssIndex {
+	indices, err := ParseIndices(c.Query("index"))
+	if err != nil {
 		rep := Resp{
 			ResultCode: ErrorCodeUnknow,
-			ResultMsg:  fmt.Sprintf("only support index %s&%s", FileIndex, RssIndex),
+			ResultMsg:  err.Error(),
 		}
 		c.JSON(http.StatusBadRequest, rep)
+		return
 	}
-	if index == FileIndex {
+	if len(indices) > 1 {
+		s.HandleMultiQuery(c, indices)
+		return
+	}
+	if indices[0] == FileIndex {
 		s.HandleFileQuery(c)
 	}
-	if index == RssIndex {
+	if indices[0] == RssIndex {
 		s.HandleRssQuery(c)
 	}
 }
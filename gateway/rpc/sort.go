@@ -0,0 +1,369 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// NameSortFieldName holds the lowercase name of a file to sort by.
+const NameSortFieldName = "name_sort"
+
+// Sort options of file queries. Times and size sort newest or largest first
+// and name from a to z unless followed by _asc or _desc.
+const (
+	SortRelevance = "relevance"
+	SortUpdated   = "updated"
+	SortCreated   = "created"
+	SortSize      = "size"
+	SortName      = "name"
+)
+
+var ErrSort = errors.New("invalid sort, want relevance, updated, created, size or name, optionally followed by _asc or _desc")
+
+var sortFields = map[string]struct {
+	field string
+	desc  bool
+}{
+	SortUpdated: {"updated", true},
+	SortCreated: {"created", true},
+	SortSize:    {"size", true},
+	SortName:    {NameSortFieldName, false},
+}
+
+// ParseSort reads a sort option, empty being relevance, and returns it with
+// its direction made explicit, e.g. "updated_desc".
+func ParseSort(sort string) (string, error) {
+	sort = strings.ToLower(strings.TrimSpace(sort))
+	if sort == "" || sort == SortRelevance {
+		return SortRelevance, nil
+	}
+	name, dir := sort, ""
+	if i := strings.LastIndex(sort, "_"); i > 0 {
+		name, dir = sort[:i], sort[i+1:]
+	}
+	f, ok := sortFields[name]
+	if !ok {
+		return "", ErrSort
+	}
+	switch dir {
+	case "":
+		if f.desc {
+			dir = "desc"
+		} else {
+			dir = "asc"
+		}
+	case "asc", "desc":
+	default:
+		return "", ErrSort
+	}
+	return name + "_" + dir, nil
+}
+
+// sortKeys returns the zinc sort of a parsed sort option. Ties are broken
+// by relevance, then by document id, so pages never overlap.
+func sortKeys(sort string) []string {
+	keys := make([]string, 0, 3)
+	if i := strings.LastIndex(sort, "_"); i > 0 {
+		if f, ok := sortFields[sort[:i]]; ok {
+			if sort[i+1:] == "desc" {
+				keys = append(keys, "-"+f.field)
+			} else {
+				keys = append(keys, f.field)
+			}
+		}
+	}
+	return append(keys, "-_score", "_id")
+}
+
+// migrateBatchSize is how many documents are updated at once by migrations.
+const migrateBatchSize = 500
+
+// reindexSuffix names the index documents are copied to while their index
+// is made again.
+const reindexSuffix = "_reindex"
+
+// migrateIndex brings the mapping of an existing index up to properties.
+// Fields mapped differently, which zinc cannot change, make the index be
+// made again with its documents. Missing fields are added and filled in for
+// the documents in the background.
+func (s *Service) migrateIndex(indexName string, properties map[string]zinc.MetaProperty) error {
+	if err := s.resumeReindex(indexName); err != nil {
+		return err
+	}
+	existing, err := s.indexProperties(indexName)
+	if err != nil {
+		return err
+	}
+	if changed := changedProperties(existing, properties); len(changed) > 0 {
+		log.Info().Msgf("reindexing %s, fields %v are mapped differently", indexName, changed)
+		n, err := s.reindex(indexName)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("reindexed %d documents of index %s", n, indexName)
+		return nil
+	}
+	missing := make(map[string]zinc.MetaProperty)
+	for field, property := range properties {
+		if _, ok := existing[field]; !ok {
+			missing[field] = property
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(missing))
+	for field := range missing {
+		fields = append(fields, field)
+	}
+	log.Info().Msgf("migrating index %s, adding fields %v", indexName, fields)
+	if err := s.putMapping(indexName, missing); err != nil {
+		return err
+	}
+	if isPassageIndex(indexName) {
+		return nil
+	}
+	go func() {
+		n, err := s.refreshDocuments(indexName)
+		if err != nil {
+			log.Error().Msgf("migrate index %s error %v", indexName, err)
+			return
+		}
+		log.Info().Msgf("migrated %d documents of index %s", n, indexName)
+	}()
+	return nil
+}
+
+// changedProperties returns the fields of existing mapped otherwise than in
+// properties in a way that matters: not sortable though sorted by, or
+// without the sub-fields searched.
+func changedProperties(existing map[string]interface{}, properties map[string]zinc.MetaProperty) []string {
+	changed := make([]string, 0)
+	for field, property := range properties {
+		old, ok := existing[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if property.GetSortable() {
+			if sortable, _ := old["sortable"].(bool); !sortable {
+				changed = append(changed, field)
+				continue
+			}
+		}
+		oldFields, _ := old["fields"].(map[string]interface{})
+		for sub := range property.GetFields() {
+			if _, ok := oldFields[sub]; !ok {
+				changed = append(changed, field)
+				break
+			}
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// reindex makes indexName again with the current mapping: its documents are
+// copied to a temporary index, then back once it is made again. Documents
+// keep their ids and go through prepareDocument on the way.
+func (s *Service) reindex(indexName string) (int, error) {
+	tmp := indexName + reindexSuffix
+	ids, err := s.indexIds(indexName)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.createIndex(tmp); err != nil {
+		return 0, err
+	}
+	if _, err := s.copyDocuments(indexName, tmp, ids); err != nil {
+		return 0, err
+	}
+	if err := s.deleteIndex(indexName); err != nil {
+		return 0, err
+	}
+	if err := s.createIndex(indexName); err != nil {
+		return 0, err
+	}
+	n, err := s.copyDocuments(tmp, indexName, ids)
+	if err != nil {
+		return n, err
+	}
+	return n, s.deleteIndex(tmp)
+}
+
+// resumeReindex finishes a reindex of indexName cut short, copying back the
+// documents left in its temporary index. Those copied there in full are
+// still in indexName too, and are written over with the same ids.
+func (s *Service) resumeReindex(indexName string) error {
+	tmp := indexName + reindexSuffix
+	names, err := s.listIndex()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, name := range names {
+		found = found || name == tmp
+	}
+	if !found {
+		return nil
+	}
+	log.Info().Msgf("resuming reindex of %s from %s", indexName, tmp)
+	ids, err := s.indexIds(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := s.copyDocuments(tmp, indexName, ids); err != nil {
+		return err
+	}
+	return s.deleteIndex(tmp)
+}
+
+func (s *Service) deleteIndex(indexName string) error {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	if _, _, err := s.apiClient.Index.Delete(ctx, indexName).Execute(); err != nil {
+		return fmt.Errorf("error when calling `Index.Delete`: %v", err)
+	}
+	return nil
+}
+
+// indexIds returns the ids of all documents of an index. Migrations go
+// through them rather than through pages of hits, which move as documents
+// are updated.
+func (s *Service) indexIds(indexName string) ([]string, error) {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	matchAll := *zinc.NewMetaQuery()
+	matchAll.SetMatchAll(map[string]interface{}{})
+	ids := make([]string, 0)
+	for from := int32(0); ; from += migrateBatchSize {
+		query := *zinc.NewMetaZincQuery()
+		query.SetQuery(matchAll)
+		query.SetFrom(from)
+		query.SetSize(migrateBatchSize)
+		query.SetSort([]string{"_id"})
+		query.SetSource([]string{"_id"})
+		resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+		}
+		ids = append(ids, hitIds(resp)...)
+		if len(resp.Hits.Hits) < migrateBatchSize {
+			return ids, nil
+		}
+	}
+}
+
+// documentsByIds calls fn with the documents of ids, migrateBatchSize at
+// once.
+func (s *Service) documentsByIds(indexName string, ids []string, fn func(hits []zinc.MetaHit) error) error {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	for start := 0; start < len(ids); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		idsQuery := *zinc.NewMetaIdsQuery()
+		idsQuery.SetValues(ids[start:end])
+		queryQuery := *zinc.NewMetaQuery()
+		queryQuery.SetIds(idsQuery)
+		query := *zinc.NewMetaZincQuery()
+		query.SetQuery(queryQuery)
+		query.SetSize(int32(end - start))
+		resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+		if err != nil {
+			return fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+		}
+		if err := fn(resp.Hits.Hits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDocuments writes the documents of ids in from to index to, keeping
+// their ids, and returns how many were copied.
+func (s *Service) copyDocuments(from, to string, ids []string) (int, error) {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	n := 0
+	err := s.documentsByIds(from, ids, func(hits []zinc.MetaHit) error {
+		records := make([]map[string]interface{}, 0, len(hits))
+		for _, hit := range hits {
+			doc := hit.Source
+			if !isPassageIndex(to) {
+				prepareDocument(doc)
+			}
+			doc["_id"] = *hit.Id
+			records = append(records, doc)
+		}
+		ingest := *zinc.NewMetaJSONIngest()
+		ingest.SetIndex(to)
+		ingest.SetRecords(records)
+		if _, _, err := s.apiClient.Document.Bulkv2(ctx).Query(ingest).Execute(); err != nil {
+			return fmt.Errorf("copy documents of %s to %s error %v", from, to, err)
+		}
+		n += len(records)
+		return nil
+	})
+	return n, err
+}
+
+// indexProperties returns the mapped fields of an index.
+func (s *Service) indexProperties(indexName string) (map[string]interface{}, error) {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Index.GetMapping(ctx, indexName).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `Index.GetMapping`: %v", err)
+	}
+	index, _ := resp[indexName].(map[string]interface{})
+	mappings, _ := index["mappings"].(map[string]interface{})
+	properties, _ := mappings["properties"].(map[string]interface{})
+	return properties, nil
+}
+
+// refreshDocuments puts every document of an index through prepareDocument
+// again, filling in derived fields added since it was indexed, and returns
+// how many were updated.
+func (s *Service) refreshDocuments(indexName string) (int, error) {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	// the ids are taken first, updated documents move in pages of hits
+	ids, err := s.indexIds(indexName)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = s.documentsByIds(indexName, ids, func(hits []zinc.MetaHit) error {
+		for _, hit := range hits {
+			doc := hit.Source
+			prepareDocument(doc)
+			if _, _, err := s.apiClient.Document.Update(ctx, indexName, *hit.Id).Document(doc).Execute(); err != nil {
+				log.Error().Msgf("migrate document %s of %s error %v", *hit.Id, indexName, err)
+				continue
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
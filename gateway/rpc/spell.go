@@ -0,0 +1,345 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// SpellMaxHits is the most hits a query may have for a correction to be
+// suggested.
+const SpellMaxHits = 3
+
+// maxVocabularyTerms bounds the terms of the dictionary, later new terms
+// are left out.
+const maxVocabularyTerms = 500000
+
+// vocabularySample is how much of the content of a document is added to
+// the dictionary.
+const vocabularySample = 64 << 10
+
+// minSpellLength and maxSpellLength bound the words of the dictionary and
+// those corrected.
+const (
+	minSpellLength = 3
+	maxSpellLength = 24
+)
+
+// Vocabulary counts the words of the names and content of the files
+// indexed, to correct the spelling of queries. Words without Latin letters
+// are left out, they have no spaces to tell them apart.
+type Vocabulary struct {
+	mu   sync.RWMutex
+	freq map[string]int
+	// index holds the terms by key, each mapped to itself so the words of
+	// documents share one copy
+	index map[spellKey]map[string]string
+	// docs are the words counted for each document by id, taken back when
+	// it is replaced or deleted
+	docs map[string][]string
+}
+
+// spellKey groups the terms compared to a word: those of about its length
+// starting with the same letter, as the first letter is rarely mistyped.
+type spellKey struct {
+	length int
+	first  rune
+}
+
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{
+		freq:  make(map[string]int),
+		index: make(map[spellKey]map[string]string),
+		docs:  make(map[string][]string),
+	}
+}
+
+// DefaultVocabulary is filled as files are indexed.
+var DefaultVocabulary = NewVocabulary()
+
+func termKey(term string) spellKey {
+	first, _ := utf8.DecodeRuneInString(term)
+	return spellKey{length: utf8.RuneCountInString(term), first: first}
+}
+
+// spellWords returns the lowercase words of text fit for the dictionary.
+func spellWords(text string) []string {
+	words := make([]string, 0)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if spellable(word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// spellable tells if word is Latin letters of a length worth correcting.
+func spellable(word string) bool {
+	n := 0
+	for _, r := range word {
+		if !unicode.Is(unicode.Latin, r) {
+			return false
+		}
+		n++
+	}
+	return n >= minSpellLength && n <= maxSpellLength
+}
+
+// vocabularyText cuts text to vocabularySample without splitting a
+// character.
+func vocabularyText(text string) string {
+	if len(text) <= vocabularySample {
+		return text
+	}
+	n := vocabularySample
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// Add counts the words of text.
+func (v *Vocabulary) Add(text string) {
+	words := spellWords(vocabularyText(text))
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.add(words)
+}
+
+// AddDocument counts the words of the name and content of the document id
+// once each, replacing those counted for it before.
+func (v *Vocabulary) AddDocument(id string, doc map[string]interface{}) {
+	words := spellWords(vocabularyText(documentText(doc)))
+	seen := make(map[string]bool, len(words))
+	unique := words[:0]
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			unique = append(unique, word)
+		}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.remove(v.docs[id])
+	v.docs[id] = v.add(unique)
+}
+
+// RemoveDocument takes back the words of the document id, deleted from the
+// index.
+func (v *Vocabulary) RemoveDocument(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.remove(v.docs[id])
+	delete(v.docs, id)
+}
+
+// add counts words and returns those counted, the stored copies.
+func (v *Vocabulary) add(words []string) []string {
+	counted := make([]string, 0, len(words))
+	for _, word := range words {
+		key := termKey(word)
+		term, ok := v.index[key][word]
+		if !ok {
+			if len(v.freq) >= maxVocabularyTerms {
+				continue
+			}
+			// words are cut from the text, copy them to not keep it
+			term = string([]byte(word))
+			if v.index[key] == nil {
+				v.index[key] = make(map[string]string)
+			}
+			v.index[key][term] = term
+		}
+		v.freq[term]++
+		counted = append(counted, term)
+	}
+	return counted
+}
+
+// remove takes back words counted by add, forgetting the words no longer
+// counted.
+func (v *Vocabulary) remove(words []string) {
+	for _, word := range words {
+		n, ok := v.freq[word]
+		if !ok {
+			continue
+		}
+		if n > 1 {
+			v.freq[word] = n - 1
+			continue
+		}
+		delete(v.freq, word)
+		key := termKey(word)
+		delete(v.index[key], word)
+		if len(v.index[key]) == 0 {
+			delete(v.index, key)
+		}
+	}
+}
+
+func documentText(doc map[string]interface{}) string {
+	name, _ := doc["name"].(string)
+	content, _ := doc[ContentFieldName].(string)
+	return name + " " + content
+}
+
+// Len returns the number of terms.
+func (v *Vocabulary) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.freq)
+}
+
+// Correct returns the most likely word meant by word: word itself when it
+// is known or nothing close is, otherwise the most frequent of the closest
+// known words, one edit away for short words and two for longer ones. Only
+// words starting with the first or second letter of word are compared.
+func (v *Vocabulary) Correct(word string) string {
+	lower := strings.ToLower(word)
+	if !spellable(lower) {
+		return word
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.freq[lower] > 0 {
+		return word
+	}
+	runes := []rune(lower)
+	maxDist := 1
+	if len(runes) > 5 {
+		maxDist = 2
+	}
+	// the second letter finds the first two swapped
+	firsts := []rune{runes[0]}
+	if runes[1] != runes[0] {
+		firsts = append(firsts, runes[1])
+	}
+	best, bestDist := "", maxDist+1
+	for _, first := range firsts {
+		for n := len(runes) - maxDist; n <= len(runes)+maxDist; n++ {
+			for term := range v.index[spellKey{length: n, first: first}] {
+				d := editDistance(runes, []rune(term), bestDist)
+				if d < bestDist || (d == bestDist && d <= maxDist && (v.freq[term] > v.freq[best] || (v.freq[term] == v.freq[best] && term < best))) {
+					best, bestDist = term, d
+				}
+			}
+		}
+	}
+	if best == "" {
+		return word
+	}
+	return best
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of
+// neighbours turning a into b, giving up at max.
+func editDistance(a, b []rune, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+			rowMin = minInt(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// CorrectQuery corrects the words of a query, written in the language of
+// ParseQuery, leaving fields, excluded words and OR alone. It returns ""
+// when nothing needs correcting.
+func (v *Vocabulary) CorrectQuery(query string) string {
+	tokens := strings.Fields(query)
+	changed := false
+	for i, token := range tokens {
+		if token == queryOr || strings.HasPrefix(token, "-") || strings.Contains(token, ":") {
+			continue
+		}
+		// keep the signs and quotes around the word
+		start := strings.IndexFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+		end := strings.LastIndexFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+		if start < 0 {
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(token[end:])
+		end += size
+		word := token[start:end]
+		if fixed := v.Correct(word); fixed != word {
+			tokens[i] = token[:start] + fixed + token[end:]
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(tokens, " ")
+}
+
+// LoadVocabulary adds the names and content of the documents of index to
+// the dictionary, for the documents indexed before the service started.
+// It runs before the watcher starts, so the documents it replaces or
+// deletes are counted already.
+func (s *Service) LoadVocabulary(v *Vocabulary, indexName string) error {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	matchAll := *zinc.NewMetaQuery()
+	matchAll.SetMatchAll(map[string]interface{}{})
+	for from := int32(0); ; from += migrateBatchSize {
+		query := *zinc.NewMetaZincQuery()
+		query.SetQuery(matchAll)
+		query.SetFrom(from)
+		query.SetSize(migrateBatchSize)
+		query.SetSort([]string{"_id"})
+		query.SetSource([]string{"name", ContentFieldName})
+		resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+		if err != nil {
+			return fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+		}
+		for _, hit := range resp.Hits.Hits {
+			if hit.Id != nil {
+				v.AddDocument(*hit.Id, hit.Source)
+			}
+		}
+		if len(resp.Hits.Hits) < migrateBatchSize {
+			log.Info().Msgf("vocabulary has %d terms after loading %s", v.Len(), indexName)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"wzinc/db"
+	"wzinc/parser"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	zinc "github.com/zinclabs/sdk-go-zincsearch"
+)
+
+// DefaultSuggestLimit and maxSuggestLimit bound the suggestions returned.
+const (
+	DefaultSuggestLimit = 8
+	maxSuggestLimit     = 50
+)
+
+// maxRecentFiles is how many opened files are kept to suggest.
+const maxRecentFiles = 200
+
+// minRecentLoadWait and maxRecentLoadWait bound the wait between attempts to
+// load the stored opened files, doubled after each failure.
+const (
+	minRecentLoadWait = time.Second
+	maxRecentLoadWait = 5 * time.Minute
+)
+
+// minFuzzyLength is the shortest word matched with a typo.
+const minFuzzyLength = 4
+
+type SuggestItem struct {
+	Name  string `json:"name"`
+	Where string `json:"where"`
+	DocId string `json:"docId,omitempty"`
+	Title string `json:"title,omitempty"`
+	// Recent is set for files opened lately, suggested first
+	Recent bool `json:"recent,omitempty"`
+}
+
+type SuggestResp struct {
+	Items []SuggestItem `json:"items"`
+}
+
+// recentFiles holds the files opened lately in memory, the latest first, so
+// they are matched on every keystroke without a database round trip.
+type recentFiles struct {
+	mu    sync.Mutex
+	files []db.OpenedFile
+}
+
+var recent = &recentFiles{}
+
+// listOpened reads the stored files, replaced in tests.
+var listOpened = db.ListOpened
+
+// loadInBackground loads the stored files until it works, waiting longer
+// after each failure. Suggestions do not wait for it, they match the files
+// opened since until the stored ones are in.
+func (r *recentFiles) loadInBackground() {
+	go func() {
+		wait := minRecentLoadWait
+		for !r.load() {
+			time.Sleep(wait)
+			if wait *= 2; wait > maxRecentLoadWait {
+				wait = maxRecentLoadWait
+			}
+		}
+	}()
+}
+
+// load adds the stored files behind those opened since, it reports whether
+// they were read.
+func (r *recentFiles) load() bool {
+	files, err := listOpened(maxRecentFiles)
+	if err != nil {
+		log.Error().Msgf("list opened files error %v", err)
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// files opened since are ahead of the stored ones
+	for _, f := range files {
+		if !r.has(f.Path) && len(r.files) < maxRecentFiles {
+			r.files = append(r.files, f)
+		}
+	}
+	return true
+}
+
+func (r *recentFiles) has(filepath string) bool {
+	for _, f := range r.files {
+		if f.Path == filepath {
+			return true
+		}
+	}
+	return false
+}
+
+// add moves filepath to the front, opened at now.
+func (r *recentFiles) add(filepath string, now int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	opened := db.OpenedFile{Path: filepath, Opened: now, Count: 1}
+	for i, f := range r.files {
+		if f.Path == filepath {
+			opened.Count = f.Count + 1
+			r.files = append(r.files[:i], r.files[i+1:]...)
+			break
+		}
+	}
+	r.files = append([]db.OpenedFile{opened}, r.files...)
+	if len(r.files) > maxRecentFiles {
+		r.files = r.files[:maxRecentFiles]
+	}
+}
+
+func (r *recentFiles) remove(filepath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, f := range r.files {
+		if f.Path == filepath {
+			r.files = append(r.files[:i], r.files[i+1:]...)
+			return
+		}
+	}
+}
+
+// match returns up to limit files whose name completes q, the latest first.
+func (r *recentFiles) match(q string, limit int) []db.OpenedFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]db.OpenedFile, 0)
+	for _, f := range r.files {
+		if len(res) == limit {
+			break
+		}
+		if nameCompletes(path.Base(f.Path), q) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// nameCompletes tells if q is the start of name or of a word in it, also
+// when typed in pinyin.
+func nameCompletes(name, q string) bool {
+	name = strings.ToLower(name)
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return false
+	}
+	if strings.HasPrefix(name, q) {
+		return true
+	}
+	// from any word on, so "report" completes "q3 report.pdf"
+	for i, r := range name {
+		if i > 0 && !unicode.IsLetter(r) && !unicode.IsDigit(r) && strings.HasPrefix(name[i+len(string(r)):], q) {
+			return true
+		}
+	}
+	key := strings.Join(strings.Fields(q), "")
+	full, initials := PinyinName(name)
+	for _, token := range strings.Fields(full + " " + initials) {
+		if strings.HasPrefix(token, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestQuery completes q in the names and titles of files, the last word
+// as a prefix, and matches names with one typo in a word.
+func suggestQuery(q string) zinc.MetaQuery {
+	should := make([]zinc.MetaQuery, 0)
+	fields := []struct {
+		name  string
+		boost float32
+	}{{"name", 3}, {"format_name", 2}, {parser.TitleFieldName, 2}}
+	for _, field := range fields {
+		prefixQuery := *zinc.NewMetaMatchBoolPrefixQuery()
+		prefixQuery.SetQuery(q)
+		prefixQuery.SetBoost(field.boost)
+		subQuery := *zinc.NewMetaQuery()
+		subQuery.SetMatchBoolPrefix(map[string]zinc.MetaMatchBoolPrefixQuery{
+			field.name: prefixQuery,
+		})
+		should = append(should, subQuery)
+	}
+	should = append(should, pinyinQueries(q)...)
+	for _, word := range strings.Fields(strings.ToLower(q)) {
+		if len([]rune(word)) < minFuzzyLength {
+			continue
+		}
+		fuzzyQuery := *zinc.NewMetaFuzzyQuery()
+		fuzzyQuery.SetValue(word)
+		fuzzyQuery.SetPrefixLength(1)
+		subQuery := *zinc.NewMetaQuery()
+		subQuery.SetFuzzy(map[string]zinc.MetaFuzzyQuery{
+			"name": fuzzyQuery,
+		})
+		should = append(should, subQuery)
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetShould(should)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+// zincSuggest returns the files of FileIndex completing q, fetching only
+// what suggestions show.
+func (s *Service) zincSuggest(q string, size int32) ([]SuggestItem, error) {
+	query := *zinc.NewMetaZincQuery()
+	query.SetQuery(suggestQuery(q))
+	query.SetSize(size)
+	query.SetSource([]string{"name", "where", parser.TitleFieldName})
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Search.Search(ctx, FileIndex).Query(query).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+	}
+	items := make([]SuggestItem, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		item := SuggestItem{DocId: *hit.Id}
+		item.Name, _ = hit.Source["name"].(string)
+		item.Where, _ = hit.Source["where"].(string)
+		item.Title, _ = hit.Source[parser.TitleFieldName].(string)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// HandleSuggest completes the name or title of a file as it is typed,
+// recently opened files first.
+func (s *Service) HandleSuggest(c *gin.Context) {
+	rep := Resp{
+		ResultCode: ErrorCodeUnknow,
+		ResultMsg:  "",
+	}
+	defer func() {
+		if rep.ResultCode == Success {
+			c.JSON(http.StatusOK, rep)
+		}
+	}()
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		rep.ResultMsg = "q empty"
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+	if limit > maxSuggestLimit {
+		limit = maxSuggestLimit
+	}
+
+	items := make([]SuggestItem, 0, limit)
+	seen := make(map[string]bool)
+	for _, f := range recent.match(q, limit) {
+		if _, err := os.Stat(parser.ArchiveRoot(f.Path)); os.IsNotExist(err) {
+			recent.remove(f.Path)
+			if err := db.ForgetOpened(f.Path); err != nil {
+				log.Error().Msgf("forget opened %s error %v", f.Path, err)
+			}
+			continue
+		}
+		seen[f.Path] = true
+		items = append(items, SuggestItem{Name: path.Base(f.Path), Where: f.Path, Recent: true})
+	}
+	if len(items) < limit {
+		// names in several places come back once per place
+		hits, err := s.zincSuggest(q, int32(limit*2))
+		if err != nil {
+			rep.ResultMsg = err.Error()
+			log.Error().Msgf("zinc suggest error %v", err)
+			c.JSON(http.StatusNotFound, rep)
+			return
+		}
+		for _, item := range hits {
+			if len(items) == limit {
+				break
+			}
+			if seen[item.Where] {
+				continue
+			}
+			seen[item.Where] = true
+			items = append(items, item)
+		}
+	}
+
+	rep.ResultCode = Success
+	repMsg, _ := json.Marshal(&SuggestResp{Items: items})
+	rep.ResultMsg = string(repMsg)
+}
+
+// HandleOpened records that the file at path was opened, to suggest it
+// first from then on.
+func (s *Service) HandleOpened(c *gin.Context) {
+	rep := Resp{
+		ResultCode: ErrorCodeUnknow,
+		ResultMsg:  "",
+	}
+	defer func() {
+		if rep.ResultCode == Success {
+			c.JSON(http.StatusOK, rep)
+		}
+	}()
+
+	filepath := c.PostForm("path")
+	if filepath == "" {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = "path empty"
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	res, err := s.ZincQueryByPath(FileIndex, filepath)
+	if err != nil {
+		rep.ResultMsg = err.Error()
+		log.Error().Msgf("zinc query path %s error %v", filepath, err)
+		c.JSON(http.StatusInternalServerError, rep)
+		return
+	}
+	if len(res.Hits.Hits) == 0 {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = "path not indexed"
+		c.JSON(http.StatusNotFound, rep)
+		return
+	}
+	recent.add(filepath, time.Now().Unix())
+	if err := db.RecordOpened(filepath); err != nil {
+		log.Error().Msgf("record opened %s error %v", filepath, err)
+	}
+	rep.ResultCode = Success
+	rep.ResultMsg = filepath
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 	"unicode"
@@ -57,3 +58,14 @@ func addSpaceBetweenCase(str string) string {
 	}
 	return result
 }
+
+var markRegexp = regexp.MustCompile(`<mark>(.*?)</mark>`)
+
+// HighlightTerms returns the words zinc wrapped in <mark> tags in a highlight fragment.
+func HighlightTerms(highlight string) []string {
+	terms := make([]string, 0)
+	for _, m := range markRegexp.FindAllStringSubmatch(highlight, -1) {
+		terms = append(terms, m[1])
+	}
+	return terms
+}
@@ -50,6 +50,10 @@ func (s *Service) ZincDelete(docId string, index string) ([]byte, error) {
 	if resp.StatusCode != 200 {
 		return nil, ErrQuery
 	}
+	// the words of the document leave the spelling dictionary with it
+	if index == FileIndex {
+		DefaultVocabulary.RemoveDocument(docId)
+	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -63,6 +67,10 @@ func (s *Service) ZincInput(index string, document map[string]interface{}) ([]by
 		UserName: s.username,
 		Password: s.password,
 	})
+	prepareDocument(document)
+	if index == FileIndex {
+		DefaultVocabulary.AddDocument(id, document)
+	}
 	resp, _, err := s.apiClient.Document.IndexWithID(ctx, index, id).Document(document).Execute()
 	if err != nil {
 		return nil, err
@@ -70,6 +78,19 @@ func (s *Service) ZincInput(index string, document map[string]interface{}) ([]by
 	return []byte(resp.GetId()), nil
 }
 
+// prepareDocument derives the fields searched besides those of the file
+// itself: its type, name to sort by, facets, content by language and pinyin
+// of its name.
+func prepareDocument(doc map[string]interface{}) {
+	if name, ok := doc["name"].(string); ok {
+		doc[parser.TypeFieldName] = parser.GetTypeFromName(name)
+		doc[NameSortFieldName] = strings.ToLower(name)
+	}
+	addFacetFields(doc)
+	addLanguage(doc)
+	addPinyinName(doc)
+}
+
 type Document struct {
 	FilePath string `json:"filepath"`
 	FileName string `json:"filename"`
@@ -88,7 +109,12 @@ type FileQueryResult struct {
 	Type        string   `json:"type"`
 	Size        int64    `json:"size"`
 	Modified    int64    `json:"modified"`
+	Sheets      string   `json:"sheets"`
+	Sections    string   `json:"sections"`
+	Score       float64  `json:"score"`
 	HightLights []string `json:"highlight"`
+	// Passages are the best matching passages of a long file
+	Passages []PassageQueryResult `json:"passages"`
 }
 
 // doc := map[string]interface{}{
@@ -129,20 +155,70 @@ func (s *Service) ZincQueryByPath(indexName, path string) (*zinc.MetaSearchRespo
 	return resp, nil
 }
 
-func (s *Service) ZincRawQuery(indexName, term string, size int32) (*zinc.MetaSearchResponse, error) {
+// ZincQueryByArchive returns the documents of the entries of an archive file.
+func (s *Service) ZincQueryByArchive(indexName, archivePath string, size int32) (*zinc.MetaSearchResponse, error) {
 	query := *zinc.NewMetaZincQuery()
+	termArchiveQuery := *zinc.NewMetaTermQuery()
+	termArchiveQuery.SetValue(archivePath)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetTerm(map[string]zinc.MetaTermQuery{
+		parser.ArchiveFieldName: termArchiveQuery,
+	})
+	query.SetQuery(queryQuery)
 	query.SetSize(size)
-	highlight := zinc.NewMetaHighlight()
-	highlightContent := zinc.NewMetaHighlight()
-	highlight.SetFields(map[string]zinc.MetaHighlight{"content": *highlightContent})
-	query.SetHighlight(*highlight)
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
+	})
+	resp, _, err := s.apiClient.Search.Search(ctx, indexName).Query(query).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("error when calling `SearchApi.Search``: %v", err)
+	}
+	return resp, nil
+}
+
+// ZincRawQuery matches term, written in the query language of ParseQuery.
+func (s *Service) ZincRawQuery(indexName, term string, from, size int32) (*zinc.MetaSearchResponse, error) {
+	q, err := ParseQuery(term, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.zincSearch(indexName, q.Query(), from, size)
+}
+
+// ZincFileQuery matches term like ZincRawQuery and keeps only the documents
+// passing filter, ordered by sort as returned by ParseSort.
+func (s *Service) ZincFileQuery(indexName, term string, filter FileQueryFilter, sort string, from, size int32) (*zinc.MetaSearchResponse, error) {
+	query, err := fileQuery(term, filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.zincSearchSorted(indexName, query, sortKeys(sort), from, size)
+}
+
+func fileQuery(term string, filter FileQueryFilter) (zinc.MetaQuery, error) {
+	q, err := ParseQuery(term, time.Now())
+	if err != nil {
+		return zinc.MetaQuery{}, err
+	}
+	query := q.Query()
+	filters := filter.queries()
+	if len(filters) == 0 {
+		return query, nil
+	}
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetMust([]zinc.MetaQuery{query})
+	boolQuery.SetFilter(filters)
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery, nil
+}
 
+// termQuery matches term against the content, in every language field, and
+// the names of documents, also when typed in pinyin.
+func termQuery(term string) zinc.MetaQuery {
 	matchQuery := *zinc.NewMetaMatchQuery()
 	matchQuery.SetQuery(term)
-	subQueryContent := *zinc.NewMetaQuery()
-	subQueryContent.SetMatch(map[string]zinc.MetaMatchQuery{
-		"content": matchQuery,
-	})
 	subQueryFormatName := *zinc.NewMetaQuery()
 	subQueryFormatName.SetMatch(map[string]zinc.MetaMatchQuery{
 		"format_name": matchQuery,
@@ -152,9 +228,57 @@ func (s *Service) ZincRawQuery(indexName, term string, size int32) (*zinc.MetaSe
 		"name": matchQuery,
 	})
 	boolQuery := *zinc.NewMetaBoolQuery()
-	boolQuery.SetShould([]zinc.MetaQuery{subQueryContent, subQueryFormatName, subQueryFileName})
+	should := append(contentQueries(term), subQueryFormatName, subQueryFileName)
+	boolQuery.SetShould(append(should, pinyinQueries(term)...))
 	queryQuery := *zinc.NewMetaQuery()
 	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+// symbolQuery matches files defining name. The name is also matched against
+// the content, only to highlight where it appears.
+func symbolQuery(name string) zinc.MetaQuery {
+	matchQuery := *zinc.NewMetaMatchQuery()
+	matchQuery.SetQuery(name)
+	subQuerySymbols := *zinc.NewMetaQuery()
+	subQuerySymbols.SetMatch(map[string]zinc.MetaMatchQuery{
+		parser.SymbolsFieldName: matchQuery,
+	})
+	subQueryContent := *zinc.NewMetaQuery()
+	subQueryContent.SetMatch(map[string]zinc.MetaMatchQuery{
+		"content": matchQuery,
+	})
+	boolQuery := *zinc.NewMetaBoolQuery()
+	boolQuery.SetMust([]zinc.MetaQuery{subQuerySymbols})
+	boolQuery.SetShould([]zinc.MetaQuery{subQueryContent})
+	queryQuery := *zinc.NewMetaQuery()
+	queryQuery.SetBool(boolQuery)
+	return queryQuery
+}
+
+// zincSearch runs queryQuery with the content highlighted, returning size
+// hits from the hit at from on and the total of all hits.
+func (s *Service) zincSearch(indexName string, queryQuery zinc.MetaQuery, from, size int32) (*zinc.MetaSearchResponse, error) {
+	return s.zincSearchSorted(indexName, queryQuery, nil, from, size)
+}
+
+// zincSearchSorted searches like zincSearch, ordering hits by the zinc sort
+// keys, by relevance when there are none.
+func (s *Service) zincSearchSorted(indexName string, queryQuery zinc.MetaQuery, sort []string, from, size int32) (*zinc.MetaSearchResponse, error) {
+	query := *zinc.NewMetaZincQuery()
+	if len(sort) > 0 {
+		query.SetSort(sort)
+	}
+	if indexName == FileIndex {
+		query.SetSource(fileHitFields)
+	}
+	query.SetFrom(from)
+	query.SetSize(size)
+	query.SetTrackTotalHits(true)
+	highlight := zinc.NewMetaHighlight()
+	highlightContent := zinc.NewMetaHighlight()
+	highlight.SetFields(map[string]zinc.MetaHighlight{"content": *highlightContent})
+	query.SetHighlight(*highlight)
 	query.SetQuery(queryQuery)
 
 	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
@@ -168,6 +292,11 @@ func (s *Service) ZincRawQuery(indexName, term string, size int32) (*zinc.MetaSe
 	return resp, nil
 }
 
+// fileHitFields are the fields of file hits read by GetFileQueryResult. The
+// sheets of spreadsheets are left out, they are fetched by zincSheets for the
+// hits located in them.
+var fileHitFields = []string{"where", "md5", "name", "created", "updated", ContentFieldName, "size", parser.SectionsFieldName}
+
 func GetFileQueryResult(resp *zinc.MetaSearchResponse) ([]FileQueryResult, error) {
 	resultList := make([]FileQueryResult, 0)
 	for _, hit := range resp.Hits.Hits {
@@ -199,6 +328,12 @@ func GetFileQueryResult(resp *zinc.MetaSearchResponse) ([]FileQueryResult, error
 			result.Size = int64(size)
 		}
 		result.Modified = result.Created
+		if sections, ok := hit.Source[parser.SectionsFieldName].(string); ok {
+			result.Sections = sections
+		}
+		if hit.Score != nil {
+			result.Score = float64(*hit.Score)
+		}
 
 		for _, highlightRes := range hit.Highlight {
 			for _, h := range highlightRes.([]interface{}) {
@@ -241,14 +376,6 @@ func GetRssQueryResult(resp *zinc.MetaSearchResponse) ([]RssQueryResult, error)
 	return resultList, nil
 }
 
-func (s *Service) zincQuery(index, term string, size int32) ([]FileQueryResult, error) {
-	res, err := s.ZincRawQuery(index, term, size)
-	if err != nil {
-		return nil, err
-	}
-	return GetFileQueryResult(res)
-}
-
 func (s *Service) listIndex() ([]string, error) {
 	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
 		UserName: s.username,
@@ -284,7 +411,22 @@ func (s *Service) createIndex(indexName string) error {
 		return fmt.Errorf("`Index.Create` error: %v", me.GetError())
 	}
 	log.Info().Msgf("setting index config mapping %s", indexName)
-	return s.setIndexMapping(indexName)
+	return s.putMapping(indexName, mappingOf(indexName))
+}
+
+// mappingOf returns the fields of an index, or of the index it is the
+// reindex copy of.
+func mappingOf(indexName string) map[string]zinc.MetaProperty {
+	if isPassageIndex(indexName) {
+		return passageIndexProperties()
+	}
+	return fileIndexProperties()
+}
+
+// isPassageIndex tells whether indexName holds passages, whose documents
+// have none of the fields derived by prepareDocument.
+func isPassageIndex(indexName string) bool {
+	return strings.TrimSuffix(indexName, reindexSuffix) == PassageIndex
 }
 
 func (s *Service) setupIndex() error {
@@ -298,7 +440,7 @@ func (s *Service) setupIndex() error {
 		log.Info().Msgf("index %s exist", existName)
 	}
 
-	expectIndexList := []string{RssIndex, FileIndex}
+	expectIndexList := []string{RssIndex, FileIndex, PassageIndex}
 	for _, indexName := range expectIndexList {
 		if _, ok := nameMap[indexName]; !ok {
 			log.Info().Msgf("creating index %s", indexName)
@@ -306,28 +448,22 @@ func (s *Service) setupIndex() error {
 			if err != nil {
 				return err
 			}
+			// a reindex cut short after the index was deleted
+			if err := s.resumeReindex(indexName); err != nil {
+				log.Error().Msgf("resume reindex of %s error %v", indexName, err)
+			}
+			continue
+		}
+		// indices made by older versions miss newer fields
+		if err := s.migrateIndex(indexName, mappingOf(indexName)); err != nil {
+			log.Error().Msgf("migrate index %s error %v", indexName, err)
 		}
 	}
 	return nil
 }
 
-// add highlightable filed "content" in index map setting
-func (s *Service) setIndexMapping(indexName string) error {
-	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
-		UserName: s.username,
-		Password: s.password,
-	})
-
-	mapping := *zinc.NewMetaMappings() // MetaMappings | Mapping
-
-	content := zinc.NewMetaProperty()
-	content.SetType("text")
-	content.SetIndex(true)
-	content.SetHighlightable(true)
-	content.SetAggregatable(false)
-	content.SetSortable(false)
-	content.SetStore(false)
-
+// fileIndexProperties maps the fields of the file and rss indices.
+func fileIndexProperties() map[string]zinc.MetaProperty {
 	where := zinc.NewMetaProperty()
 	where.SetType("text")
 	where.SetIndex(true)
@@ -335,18 +471,238 @@ func (s *Service) setIndexMapping(indexName string) error {
 	where.SetAggregatable(false)
 	where.SetAnalyzer("keyword")
 
+	// path of the archive file on disk for documents of archive entries
+	archive := zinc.NewMetaProperty()
+	archive.SetType("text")
+	archive.SetIndex(true)
+	archive.SetHighlightable(false)
+	archive.SetAggregatable(false)
+	archive.SetAnalyzer("keyword")
+
 	md5 := zinc.NewMetaProperty()
 	md5.SetType("text")
 	md5.SetHighlightable(false)
 	md5.SetAggregatable(false)
 	md5.SetAnalyzer("keyword")
 
-	mapping.SetProperties(map[string]zinc.MetaProperty{
-		ContentFieldName: *content,
-		"where":          *where,
-		"md5":            *md5,
+	// row numbers of spreadsheets, only kept in _source to locate hits
+	sheets := zinc.NewMetaProperty()
+	sheets.SetType("text")
+	sheets.SetIndex(false)
+	sheets.SetHighlightable(false)
+	sheets.SetAggregatable(false)
+	sheets.SetStore(false)
+
+	// page and heading path of document sections, only kept in _source to locate hits
+	sections := zinc.NewMetaProperty()
+	sections.SetType("text")
+	sections.SetIndex(false)
+	sections.SetHighlightable(false)
+	sections.SetAggregatable(false)
+	sections.SetStore(false)
+
+	title := zinc.NewMetaProperty()
+	title.SetType("text")
+	title.SetIndex(true)
+	title.SetHighlightable(true)
+	title.SetAggregatable(false)
+
+	author := zinc.NewMetaProperty()
+	author.SetType("text")
+	author.SetIndex(true)
+	author.SetHighlightable(false)
+	author.SetAggregatable(false)
+
+	language := zinc.NewMetaProperty()
+	language.SetType("keyword")
+	language.SetIndex(true)
+	language.SetAggregatable(true)
+
+	charset := zinc.NewMetaProperty()
+	charset.SetType("keyword")
+	charset.SetIndex(true)
+	charset.SetAggregatable(true)
+
+	// mail headers
+	from := zinc.NewMetaProperty()
+	from.SetType("text")
+	from.SetIndex(true)
+	from.SetHighlightable(false)
+	from.SetAggregatable(false)
+
+	to := zinc.NewMetaProperty()
+	to.SetType("text")
+	to.SetIndex(true)
+	to.SetHighlightable(false)
+	to.SetAggregatable(false)
+
+	subject := zinc.NewMetaProperty()
+	subject.SetType("text")
+	subject.SetIndex(true)
+	subject.SetHighlightable(true)
+	subject.SetAggregatable(false)
+
+	// sent time in unix seconds
+	date := zinc.NewMetaProperty()
+	date.SetType("numeric")
+	date.SetIndex(true)
+	date.SetSortable(true)
+	date.SetAggregatable(false)
+
+	attachments := zinc.NewMetaProperty()
+	attachments.SetType("text")
+	attachments.SetIndex(true)
+	attachments.SetHighlightable(false)
+	attachments.SetAggregatable(false)
+
+	// image, audio or video
+	media := zinc.NewMetaProperty()
+	media.SetType("keyword")
+	media.SetIndex(true)
+	media.SetAggregatable(true)
+
+	// camera, artist, album and genre of media files
+	mediaText := zinc.NewMetaProperty()
+	mediaText.SetType("text")
+	mediaText.SetIndex(true)
+	mediaText.SetHighlightable(false)
+	mediaText.SetAggregatable(false)
+
+	// time taken, duration, size and location of media files
+	mediaNumber := zinc.NewMetaProperty()
+	mediaNumber.SetType("numeric")
+	mediaNumber.SetIndex(true)
+	mediaNumber.SetSortable(true)
+	mediaNumber.SetAggregatable(false)
+
+	codeLanguage := zinc.NewMetaProperty()
+	codeLanguage.SetType("keyword")
+	codeLanguage.SetIndex(true)
+	codeLanguage.SetAggregatable(true)
+
+	// top-level symbols of source files, one per line
+	symbols := zinc.NewMetaProperty()
+	symbols.SetType("text")
+	symbols.SetIndex(true)
+	symbols.SetHighlightable(false)
+	symbols.SetAggregatable(false)
+
+	// front matter tags of notes
+	tags := zinc.NewMetaProperty()
+	tags.SetType("keyword")
+	tags.SetIndex(true)
+	tags.SetAggregatable(true)
+
+	frontMatter := zinc.NewMetaProperty()
+	frontMatter.SetType("text")
+	frontMatter.SetIndex(true)
+	frontMatter.SetHighlightable(false)
+	frontMatter.SetAggregatable(false)
+
+	// link targets of notes, matched whole to find backlinks
+	links := zinc.NewMetaProperty()
+	links.SetType("keyword")
+	links.SetIndex(true)
+	links.SetAggregatable(false)
+
+	// pinyin and initials of Chinese names, matched by prefix
+	namePinyin := zinc.NewMetaProperty()
+	namePinyin.SetType("text")
+	namePinyin.SetIndex(true)
+	namePinyin.SetHighlightable(false)
+	namePinyin.SetAggregatable(false)
+	namePinyin.SetAnalyzer("standard")
+
+	// lowercase extension like .pdf, filtered by type
+	fileType := zinc.NewMetaProperty()
+	fileType.SetType("keyword")
+	fileType.SetIndex(true)
+	fileType.SetAggregatable(true)
+
+	// times and size of files, sortable for the sort options of queries
+	sortableNumber := zinc.NewMetaProperty()
+	sortableNumber.SetType("numeric")
+	sortableNumber.SetIndex(true)
+	sortableNumber.SetSortable(true)
+	sortableNumber.SetAggregatable(false)
+
+	// lowercase name to sort by, name itself is analyzed
+	nameSort := zinc.NewMetaProperty()
+	nameSort.SetType("keyword")
+	nameSort.SetIndex(true)
+	nameSort.SetSortable(true)
+	nameSort.SetAggregatable(false)
+
+	// top level folder, year updated and rss feeds, counted by facets
+	facet := zinc.NewMetaProperty()
+	facet.SetType("keyword")
+	facet.SetIndex(true)
+	facet.SetAggregatable(true)
+
+	// ok, truncated, timeout or error
+	parseStatus := zinc.NewMetaProperty()
+	parseStatus.SetType("keyword")
+	parseStatus.SetIndex(true)
+	parseStatus.SetAggregatable(true)
+
+	properties := map[string]zinc.MetaProperty{
+		ContentFieldName:             contentProperty(),
+		"where":                      *where,
+		"md5":                        *md5,
+		parser.SheetsFieldName:       *sheets,
+		parser.SectionsFieldName:     *sections,
+		parser.TitleFieldName:        *title,
+		parser.AuthorFieldName:       *author,
+		parser.LanguageFieldName:     *language,
+		parser.CharsetFieldName:      *charset,
+		parser.ArchiveFieldName:      *archive,
+		parser.FromFieldName:         *from,
+		parser.ToFieldName:           *to,
+		parser.SubjectFieldName:      *subject,
+		parser.DateFieldName:         *date,
+		parser.AttachmentsFieldName:  *attachments,
+		parser.MediaFieldName:        *media,
+		parser.CameraFieldName:       *mediaText,
+		parser.ArtistFieldName:       *mediaText,
+		parser.AlbumFieldName:        *mediaText,
+		parser.GenreFieldName:        *mediaText,
+		parser.YearFieldName:         *mediaNumber,
+		parser.TakenFieldName:        *mediaNumber,
+		parser.DurationFieldName:     *mediaNumber,
+		parser.WidthFieldName:        *mediaNumber,
+		parser.HeightFieldName:       *mediaNumber,
+		parser.LatitudeFieldName:     *mediaNumber,
+		parser.LongitudeFieldName:    *mediaNumber,
+		parser.CodeLanguageFieldName: *codeLanguage,
+		parser.SymbolsFieldName:      *symbols,
+		parser.TagsFieldName:         *tags,
+		parser.FrontMatterFieldName:  *frontMatter,
+		parser.LinksFieldName:        *links,
+		parser.WikiLinksFieldName:    *links,
+		parser.ParseStatusFieldName:  *parseStatus,
+		parser.TypeFieldName:         *fileType,
+		NamePinyinFieldName:          *namePinyin,
+		NameInitialsFieldName:        *namePinyin,
+		"created":                    *sortableNumber,
+		"updated":                    *sortableNumber,
+		"size":                       *sortableNumber,
+		NameSortFieldName:            *nameSort,
+		TopDirFieldName:              *facet,
+		UpdatedYearFieldName:         *facet,
+		FeedFieldName:                *facet,
+	}
+	return properties
+}
+
+func (s *Service) putMapping(indexName string, properties map[string]zinc.MetaProperty) error {
+	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
+		UserName: s.username,
+		Password: s.password,
 	})
 
+	mapping := *zinc.NewMetaMappings() // MetaMappings | Mapping
+	mapping.SetProperties(properties)
+
 	_, r, err := s.apiClient.Index.SetMapping(ctx, indexName).Mapping(mapping).Execute()
 	if err != nil {
 		return err
@@ -382,7 +738,9 @@ func (s *Service) GetContentByDocId(index, docId string) (string, error) {
 	return content, nil
 }
 
-func (s *Service) UpdateFileContentFromOldDoc(index, newContent, md5 string, oldDoc FileQueryResult) (string, error) {
+// UpdateFileContentFromOldDoc replaces the content of oldDoc. fields are the
+// extra parser fields of the new content and may be nil.
+func (s *Service) UpdateFileContentFromOldDoc(index, newContent, md5 string, oldDoc FileQueryResult, fields map[string]interface{}) (string, error) {
 	size := 0
 	fileInfo, err := os.Stat(oldDoc.Where)
 	if err == nil {
@@ -398,6 +756,13 @@ func (s *Service) UpdateFileContentFromOldDoc(index, newContent, md5 string, old
 		"updated":     time.Now().Unix(),
 		"format_name": oldDoc.Name,
 	}
+	for k, v := range fields {
+		newDoc[k] = v
+	}
+	prepareDocument(newDoc)
+	if index == FileIndex {
+		DefaultVocabulary.AddDocument(oldDoc.DocId, newDoc)
+	}
 
 	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
 		UserName: s.username,
@@ -438,6 +803,10 @@ func (s *Service) UpdateFileContentByPath(index, path, md5, newContent string) (
 		"updated":     time.Now().Unix(),
 		"format_name": oldDoc.Name,
 	}
+	prepareDocument(newDoc)
+	if index == FileIndex {
+		DefaultVocabulary.AddDocument(oldDoc.DocId, newDoc)
+	}
 
 	ctx := context.WithValue(context.Background(), zinc.ContextBasicAuth, zinc.BasicAuth{
 		UserName: s.username,
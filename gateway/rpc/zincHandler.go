@@ -4,10 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 	"wzinc/common"
 	"wzinc/parser"
@@ -17,10 +16,23 @@ import (
 )
 
 type FileQueryResp struct {
+	// Count is the number of all files found, Offset the hit the page started at
 	Count  int             `json:"count"`
 	Offset int             `json:"offset"`
 	Limit  int             `json:"limit"`
 	Items  []FileQueryItem `json:"items"`
+	// Cursor gets the next page, empty on the last page
+	Cursor string `json:"cursor,omitempty"`
+	// Filter is the filter applied, times in unix seconds and sizes in bytes
+	Filter FileQueryFilter `json:"filter"`
+	// Sort is the order of the items, like relevance or updated_desc
+	Sort string `json:"sort"`
+	// Facets count all files found by facet value, when asked for
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+	// Suggestion is the query corrected for spelling when it found few
+	// files, Corrected tells if the items are those of the suggestion
+	Suggestion string `json:"suggestion,omitempty"`
+	Corrected  bool   `json:"corrected,omitempty"`
 }
 
 func (s *Service) HandleFileInput(c *gin.Context) {
@@ -46,6 +58,8 @@ func (s *Service) HandleFileInput(c *gin.Context) {
 
 	md5 := common.Md5File(bytes.NewReader([]byte(content)))
 
+	var fields map[string]interface{}
+
 	fileHeader, err := c.FormFile("doc")
 	if err == nil {
 		file, err := fileHeader.Open()
@@ -56,17 +70,19 @@ func (s *Service) HandleFileInput(c *gin.Context) {
 			return
 		}
 		filename = fileHeader.Filename
-		data, _ := ioutil.ReadAll(file)
-		file.Close()
-		r := bytes.NewReader(data)
-		content, err = parser.ParseDoc(r, filename)
-		if err != nil {
-			log.Error().Msgf("parse file error %v", err)
+		md5 = common.Md5File(file)
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
 			rep.ResultMsg = err.Error()
 			c.JSON(http.StatusBadRequest, rep)
 			return
 		}
-		md5 = common.Md5File(r)
+		// a file that fails is still indexed by name, with the outcome in parse_status
+		content, fields, err = parser.ParseDocFieldsLimited(c.Request.Context(), file, filename, parser.DefaultParseLimits)
+		file.Close()
+		if err != nil {
+			log.Warn().Msgf("parse file %s %v error %v", filename, fields[parser.ParseStatusFieldName], err)
+		}
 		size = fileHeader.Size
 	}
 
@@ -84,6 +100,9 @@ func (s *Service) HandleFileInput(c *gin.Context) {
 		"updated":     time.Now().Unix(),
 		"format_name": FormatFilename(filename),
 	}
+	for k, v := range fields {
+		doc[k] = v
+	}
 
 	log.Info().Msgf("add input file index %s doc %v", index, doc)
 	id, err := s.ZincInput(index, doc)
@@ -94,6 +113,9 @@ func (s *Service) HandleFileInput(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, rep)
 		return
 	}
+	if err := s.ZincInputPassages(string(id), filePath, filename, content, fields); err != nil {
+		log.Error().Msgf("zinc input passages of %s error %v", filename, err)
+	}
 	rep.ResultCode = Success
 	rep.ResultMsg = string(id)
 }
@@ -118,7 +140,7 @@ func (s *Service) HandleFileDelete(c *gin.Context) {
 		return
 	}
 	log.Info().Msgf("zinc delete index %s docid%s", index, docId)
-	_, err := s.ZincDelete(docId, index)
+	_, err := s.ZincDeleteFile(docId)
 	if err != nil {
 		rep.ResultCode = ErrorCodeDelete
 		rep.ResultMsg = err.Error()
@@ -150,36 +172,225 @@ func (s *Service) HandleFileQuery(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, rep)
 		return
 	}
+	if _, err := ParseQuery(term, time.Now()); err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
 
-	maxResults, err := strconv.Atoi(c.PostForm("limit"))
+	maxResults, err := parseLimit(c.PostForm("limit"))
 	if err != nil {
-		maxResults = DefaultMaxResult
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
 	}
-	log.Info().Msgf("zinc query index %s term %s max %v", index, term, maxResults)
-	results, err := s.zincQuery(index, term, int32(maxResults))
-
+	filter, err := ParseFileQueryFilter(c.PostForm, time.Now())
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	from, err := pageFrom(c.PostForm("offset"), c.PostForm("cursor"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	sort, err := ParseSort(c.PostForm("sort"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	facets, err := ParseFacets(index, c.PostForm("facets"))
+	if err != nil {
+		rep.ResultCode = ErrorCodeInput
+		rep.ResultMsg = err.Error()
+		c.JSON(http.StatusBadRequest, rep)
+		return
+	}
+	log.Info().Msgf("zinc query index %s term %s filter %+v sort %s from %d max %v", index, term, filter, sort, from, maxResults)
+	items, total, next, err := s.queryFilePage(index, term, filter, sort, from, maxResults)
 	if err != nil {
 		rep.ResultMsg = err.Error()
 		log.Error().Msg(rep.ResultMsg)
 		c.JSON(http.StatusNotFound, rep)
 		return
 	}
-	log.Debug().Msgf("zinc query results %v", results)
+	suggestion := ""
+	if total < SpellMaxHits {
+		suggestion = DefaultVocabulary.CorrectQuery(term)
+	}
+	corrected := false
+	// autocorrect runs the suggestion instead of a query finding nothing
+	if suggestion != "" && total == 0 && c.PostForm("autocorrect") == "true" {
+		fixedItems, fixedTotal, fixedNext, err := s.queryFilePage(index, suggestion, filter, sort, from, maxResults)
+		if err != nil {
+			log.Error().Msgf("zinc query suggestion %s error %v", suggestion, err)
+		} else if fixedTotal > 0 {
+			log.Info().Msgf("zinc query term %s corrected to %s", term, suggestion)
+			items, total, next = fixedItems, fixedTotal, fixedNext
+			term, corrected = suggestion, true
+		}
+	}
 
 	rep.ResultCode = Success
-	items := s.slashFileQueryResult(results)
 	log.Debug().Msgf("zinc query items %v", items)
 	response := FileQueryResp{
-		Count:  len(items),
-		Offset: 0,
-		Limit:  maxResults,
-		Items:  items,
+		Count:      total,
+		Offset:     int(from),
+		Limit:      maxResults,
+		Items:      items,
+		Cursor:     nextCursor(next, total),
+		Filter:     filter,
+		Sort:       sort,
+		Suggestion: suggestion,
+		Corrected:  corrected,
+	}
+	if len(facets) > 0 {
+		query, _ := fileQuery(term, filter)
+		response.Facets, err = s.zincFacets(index, query, facets)
+		if err != nil {
+			log.Error().Msgf("zinc query facets error %v", err)
+		}
 	}
 	repMsg, _ := json.Marshal(&response)
 	rep.ResultMsg = string(repMsg)
 	log.Debug().Msgf("response data %s", rep.ResultMsg)
 }
 
+// queryFilePage returns up to limit files matching term from the hit at from
+// on, the total of files found and the hit the next page starts at. Files
+// dropped as missing or duplicate are refilled from the following hits, so
+// pages keep their size.
+func (s *Service) queryFilePage(index, term string, filter FileQueryFilter, sort string, from int32, limit int) ([]FileQueryItem, int, int32, error) {
+	// passages are found by the words of term, none for symbol: or filters
+	text := ""
+	if q, err := ParseQuery(term, time.Now()); err == nil {
+		text = q.Text()
+	}
+	if text != "" && sort == SortRelevance && index == FileIndex {
+		return s.queryRankedPage(index, term, text, filter, from, limit)
+	}
+	items := make([]FileQueryItem, 0, limit)
+	seen := make(map[string]bool)
+	total := 0
+	next := from
+	for fetch := 0; fetch < maxPageFetches && len(items) < limit; fetch++ {
+		size := int32(limit - len(items))
+		res, err := s.ZincFileQuery(index, term, filter, sort, next, size)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		total = hitsTotal(res)
+		results, err := GetFileQueryResult(res)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		log.Debug().Msgf("zinc query results %v", results)
+		if len(results) == 0 {
+			break
+		}
+		if text != "" {
+			passages, err := s.zincQueryPassages(text, results)
+			if err != nil {
+				log.Error().Msgf("zinc query passages error %v", err)
+			}
+			results = groupPassages(results, passages)
+		}
+		page, removed := s.slashFileQueryResult(results, seen)
+		items = append(items, page...)
+		// hits of deleted files are gone, the following ones move up
+		next += int32(len(results) - removed)
+		total -= removed
+		if int32(len(results)) < size {
+			break
+		}
+	}
+	return items, total, next, nil
+}
+
+// queryRankedPage returns a page of files like queryFilePage, ranked with
+// their passages by rankFiles for the first maxFusedResults files. The files
+// after them follow by their own score, leaving out those ranked already.
+func (s *Service) queryRankedPage(index, term, text string, filter FileQueryFilter, from int32, limit int) ([]FileQueryItem, int, int32, error) {
+	ranked, extra, total, err := s.rankFiles(index, term, text, filter)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	query, err := fileQuery(term, filter)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	// without the extra files the first ranked by score are in ranked, so
+	// the rest starts right after them
+	rest := withoutIds(query, extra)
+	scored := len(ranked) - len(extra)
+	items := make([]FileQueryItem, 0, limit)
+	seen := make(map[string]bool)
+	pos := int(from)
+	dropped := 0
+	for fetch := 0; fetch < maxPageFetches && len(items) < limit && (pos < len(ranked) || pos < total); fetch++ {
+		size := limit - len(items)
+		var results []FileQueryResult
+		if pos < len(ranked) {
+			end := pos + size
+			if end > len(ranked) {
+				end = len(ranked)
+			}
+			ids := ranked[pos:end]
+			pos = end
+			res, err := s.zincSearch(index, withIds(query, ids), 0, int32(len(ids)))
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			found, err := GetFileQueryResult(res)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			byId := make(map[string]FileQueryResult, len(found))
+			for _, result := range found {
+				byId[result.DocId] = result
+			}
+			results = make([]FileQueryResult, 0, len(ids))
+			for _, id := range ids {
+				if result, ok := byId[id]; ok {
+					results = append(results, result)
+				}
+			}
+			dropped += len(ids) - len(results)
+		} else {
+			res, err := s.zincSearch(index, rest, int32(scored+pos-len(ranked)), int32(size))
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			results, err = GetFileQueryResult(res)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			if len(results) == 0 {
+				break
+			}
+			pos += len(results)
+		}
+		passages, err := s.zincQueryPassages(text, results)
+		if err != nil {
+			log.Error().Msgf("zinc query passages error %v", err)
+		}
+		results = groupPassages(results, passages)
+		page, removed := s.slashFileQueryResult(results, seen)
+		items = append(items, page...)
+		// deleted files drop out of the ranking of the next page
+		dropped += removed
+	}
+	return items, total - dropped, int32(pos - dropped), nil
+}
+
 type FileQueryItem struct {
 	Index    string `json:"index"`
 	Where    string `json:"where"`
@@ -190,9 +401,25 @@ type FileQueryItem struct {
 	Size     int64  `json:"size"`
 	Modified int64  `json:"modified"`
 	Snippet  string `json:"snippet"`
+	Location string `json:"location,omitempty"`
+	Page     int    `json:"page,omitempty"`
+	Heading  string `json:"heading,omitempty"`
+	// Passages are the best matching passages of long files, the first
+	// one gives the snippet
+	Passages []PassageItem `json:"passages,omitempty"`
+}
+
+type PassageItem struct {
+	Snippet string `json:"snippet"`
+	Page    int    `json:"page,omitempty"`
+	Heading string `json:"heading,omitempty"`
 }
 
-func (s *Service) slashFileQueryResult(results []FileQueryResult) []FileQueryItem {
+// slashFileQueryResult returns the files of results, deleting the documents
+// of files that no longer exist and merging duplicates, and how many
+// documents were deleted. Files in seen were on an earlier part of the page
+// and are skipped, the files returned are added to it.
+func (s *Service) slashFileQueryResult(results []FileQueryResult, seen map[string]bool) ([]FileQueryItem, int) {
 	type record struct {
 		FileQueryItem
 		id int
@@ -200,18 +427,27 @@ func (s *Service) slashFileQueryResult(results []FileQueryResult) []FileQueryIte
 	itemsMap := make(map[string]record)
 	itemsList := make([]FileQueryItem, 0)
 	id := 0
+	removed := 0
+	s.zincSheets(results)
 	for _, res := range results {
-		fileInfo, err := os.Stat(res.Where)
+		if seen[res.Where] {
+			continue
+		}
+		// archive entries exist as long as their archive does
+		root := parser.ArchiveRoot(res.Where)
+		fileInfo, err := os.Stat(root)
 		if os.IsNotExist(err) {
 			//delete if not exist
 			log.Info().Msgf("zinc delete query found but not exist file %s id %s", res.Where, res.DocId)
-			_, err := s.ZincDelete(res.DocId, FileIndex)
+			_, err := s.ZincDeleteFile(res.DocId)
 			if err != nil {
 				log.Error().Msgf("zinc delete file error path %s id %s", res.Where, res.DocId)
+			} else {
+				removed++
 			}
 			continue
 		}
-		if err == nil {
+		if err == nil && root == res.Where {
 			res.Size = fileInfo.Size()
 		}
 		if item, ok := itemsMap[res.Where]; ok {
@@ -233,15 +469,55 @@ func (s *Service) slashFileQueryResult(results []FileQueryResult) []FileQueryIte
 		}
 		id++
 	}
-	return itemsList
+	for _, item := range itemsList {
+		seen[item.Where] = true
+	}
+	return itemsList, removed
+}
+
+// zincSheets fetches the sheets of the spreadsheets in results whose
+// highlight is located by them.
+func (s *Service) zincSheets(results []FileQueryResult) {
+	ids := make([]string, 0)
+	for _, res := range results {
+		if len(res.Passages) == 0 && len(res.HightLights) > 0 && parser.IsSpreadsheet(res.Name) {
+			ids = append(ids, res.DocId)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	resp, err := s.zincSearchFields(FileIndex, idsQuery(ids), []string{parser.SheetsFieldName}, int32(len(ids)))
+	if err != nil {
+		log.Error().Msgf("zinc query sheets error %v", err)
+		return
+	}
+	sheets := make(map[string]string, len(ids))
+	for _, hit := range resp.Hits.Hits {
+		if hit.Id != nil {
+			sheets[*hit.Id], _ = hit.Source[parser.SheetsFieldName].(string)
+		}
+	}
+	for i := range results {
+		if v, ok := sheets[results[i].DocId]; ok {
+			results[i].Sheets = v
+		}
+	}
 }
 
 func shortFileQueryResult(res FileQueryResult) FileQueryItem {
+	if len(res.Passages) > 0 {
+		return passageFileQueryResult(res)
+	}
 	snippet := ""
 	if len(res.HightLights) > 0 {
 		snippet = res.HightLights[0]
 	}
-	return FileQueryItem{
+	location, section := locateHighlight(res)
+	if location != "" {
+		snippet = location + ": " + snippet
+	}
+	item := FileQueryItem{
 		Index:    res.Index,
 		Where:    res.Where,
 		Name:     res.Name,
@@ -251,5 +527,81 @@ func shortFileQueryResult(res FileQueryResult) FileQueryItem {
 		Size:     res.Size,
 		Modified: res.Modified,
 		Snippet:  snippet,
+		Location: location,
+	}
+	if section != nil {
+		item.Page = section.Page
+		item.Heading = parser.HeadingPath(section.Headings)
+	}
+	return item
+}
+
+// passageFileQueryResult takes the snippet, page and heading of a long file
+// from its best passage.
+func passageFileQueryResult(res FileQueryResult) FileQueryItem {
+	item := FileQueryItem{
+		Index:    res.Index,
+		Where:    res.Where,
+		Name:     res.Name,
+		DocId:    res.DocId,
+		Created:  res.Created,
+		Type:     res.Type,
+		Size:     res.Size,
+		Modified: res.Modified,
+		Passages: make([]PassageItem, 0, len(res.Passages)),
+	}
+	for _, p := range res.Passages {
+		snippet := ""
+		if len(p.HightLights) > 0 {
+			snippet = p.HightLights[0]
+		}
+		item.Passages = append(item.Passages, PassageItem{Snippet: snippet, Page: p.Page, Heading: p.Heading})
+	}
+	best := res.Passages[0]
+	item.Snippet, item.Page, item.Heading = item.Passages[0].Snippet, best.Page, best.Heading
+	if best.Page > 0 {
+		item.Location = fmt.Sprintf("%s %d", parser.PageUnit(res.Type), best.Page)
+		item.Snippet = item.Location + ": " + item.Snippet
+	}
+	return item
+}
+
+// locateHighlight finds where in a structured file the first highlight
+// matched, e.g. "Sheet2!B14" for spreadsheets or "slide 3" for decks, and the
+// document section it is in. It returns "" and nil when unknown.
+func locateHighlight(res FileQueryResult) (string, *parser.Section) {
+	if len(res.HightLights) == 0 {
+		return "", nil
+	}
+	terms := HighlightTerms(res.HightLights[0])
+	if res.Sheets != "" {
+		var rows []parser.SheetRows
+		if err := json.Unmarshal([]byte(res.Sheets), &rows); err == nil {
+			return parser.LocateInContent(res.Content, rows, terms), nil
+		}
+		// spreadsheets indexed with their cells
+		var sheets []parser.Sheet
+		if err := json.Unmarshal([]byte(res.Sheets), &sheets); err != nil {
+			log.Warn().Msgf("unmarshal sheets of %s error %v", res.Where, err)
+			return "", nil
+		}
+		return parser.LocateInSheets(sheets, terms), nil
+	}
+	if res.Sections != "" {
+		var sections []parser.Section
+		if err := json.Unmarshal([]byte(res.Sections), &sections); err != nil {
+			log.Warn().Msgf("unmarshal sections of %s error %v", res.Where, err)
+			return "", nil
+		}
+		section := parser.LocateSection(res.Content, sections, terms)
+		if section == nil || section.Page == 0 {
+			return "", section
+		}
+		return fmt.Sprintf("%s %d", parser.PageUnit(res.Type), section.Page), section
+	}
+	// documents indexed before sections were stored
+	if page := parser.LocatePage(res.Content, terms); page > 0 {
+		return fmt.Sprintf("%s %d", parser.PageUnit(res.Type), page), nil
 	}
+	return "", nil
 }
@@ -3,15 +3,22 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
+	"wzinc/db"
+	"wzinc/parser"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	zinc "github.com/zinclabs/sdk-go-zincsearch"
 )
@@ -291,3 +298,647 @@ func TestJsonRss(t *testing.T) {
 	}
 	fmt.Println(string(b))
 }
+
+func TestShortFileQueryResult(t *testing.T) {
+	content := "Overview\nabout" + parser.PageSeparator + "Limits\nten users"
+	sections, _ := json.Marshal([]parser.Section{
+		{Page: 1, Headings: []string{"Overview"}, Offset: 0},
+		{Page: 2, Headings: []string{"Overview", "Limits"}, Offset: 15},
+	})
+	item := shortFileQueryResult(FileQueryResult{
+		Name:        "manual.docx",
+		Type:        ".docx",
+		Content:     content,
+		Sections:    string(sections),
+		HightLights: []string{"ten <mark>users</mark>"},
+	})
+	if item.Page != 2 || item.Heading != "Overview > Limits" || item.Snippet != "page 2: ten <mark>users</mark>" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	sheets := []parser.Sheet{{Name: "people", Rows: []parser.SheetRow{
+		{Row: 1, Cells: []string{"name", "city"}},
+		{Row: 3, Cells: []string{"bob", "new york"}},
+	}}}
+	rows, _ := json.Marshal(parser.SheetsRows(sheets))
+	item = shortFileQueryResult(FileQueryResult{
+		Name:        "people.csv",
+		Type:        ".csv",
+		Content:     parser.SheetsText(sheets),
+		Sheets:      string(rows),
+		HightLights: []string{"bob\tnew <mark>york</mark>"},
+	})
+	if item.Location != "people!B3" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+}
+
+func TestGroupPassages(t *testing.T) {
+	results := []FileQueryResult{
+		{DocId: "a", Score: 3},
+		{DocId: "b", Score: 2},
+		{DocId: "c", Score: 1},
+	}
+	passages := []PassageQueryResult{
+		{Parent: "c", Passage: 4, Score: 2.5},
+		{Parent: "c", Passage: 9, Score: 5},
+		{Parent: "c", Passage: 1, Score: 1},
+		{Parent: "c", Passage: 2, Score: 0.5},
+		{Parent: "b", Passage: 0, Score: 1},
+	}
+	results = groupPassages(results, passages)
+	order := []string{results[0].DocId, results[1].DocId, results[2].DocId}
+	if !reflect.DeepEqual(order, []string{"a", "b", "c"}) {
+		t.Fatalf("got order %v", order)
+	}
+	if len(results[2].Passages) != maxPassageSnippets || results[2].Passages[0].Passage != 9 || results[2].Passages[1].Passage != 4 {
+		t.Fatalf("got passages %+v", results[2].Passages)
+	}
+	if results[1].Score != 2 || len(results[1].Passages) != 1 || len(results[0].Passages) != 0 {
+		t.Fatalf("got %+v", results)
+	}
+}
+
+func TestFuseIds(t *testing.T) {
+	// c is found far down by its own score but has the best passage
+	files := []string{"a", "b", "d", "e", "c"}
+	parents := []string{"c", "b"}
+	got := fuseIds([][]string{files, parents})
+	if !reflect.DeepEqual(got, []string{"b", "c", "a", "d", "e"}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestWithoutIds(t *testing.T) {
+	query := termQuery("report")
+	if got := withoutIds(query, nil); !reflect.DeepEqual(got, query) {
+		t.Fatalf("expected the query unchanged, got %+v", got)
+	}
+	b, _ := json.Marshal(withoutIds(query, []string{"a", "b"}))
+	if !strings.Contains(string(b), `"must_not":[{"ids":{"values":["a","b"]}}]`) {
+		t.Fatalf("got %s", b)
+	}
+}
+
+func TestAddLanguage(t *testing.T) {
+	doc := map[string]interface{}{ContentFieldName: "今天我们讨论文件搜索的中文分词问题"}
+	addLanguage(doc)
+	if doc[parser.LanguageFieldName] != "zh" || len(doc) != 2 {
+		t.Fatalf("got %v", doc)
+	}
+	// the language found by the parser wins, reduced to the language
+	doc = map[string]interface{}{ContentFieldName: "hello", parser.LanguageFieldName: "en-GB"}
+	addLanguage(doc)
+	if doc[parser.LanguageFieldName] != "en" {
+		t.Fatalf("got %v", doc)
+	}
+	doc = map[string]interface{}{ContentFieldName: "Der schnelle braune Fuchs springt über den faulen Hund"}
+	addLanguage(doc)
+	if doc[parser.LanguageFieldName] != "de" {
+		t.Fatalf("got %v", doc)
+	}
+}
+
+func TestContentProperty(t *testing.T) {
+	content := contentProperty()
+	fields := content.GetFields()
+	zh, en := fields["zh"], fields["en"]
+	if zh.GetAnalyzer() != "gse_standard" || zh.GetSearchAnalyzer() != "gse_search" || en.GetAnalyzer() != EnglishAnalyzer {
+		t.Fatalf("got %+v", fields)
+	}
+	if ContentZhFieldName != "content.zh" {
+		t.Fatalf("got %s", ContentZhFieldName)
+	}
+}
+
+func TestContentQueries(t *testing.T) {
+	b, _ := json.Marshal(contentQueries("搜索"))
+	for _, want := range []string{
+		`{"match":{"content":{"query":"搜索"}}}`,
+		`{"match":{"content.zh":{"query":"搜索"}}}`,
+		`"must":[{"match":{"content.zh":{"boost":2,"query":"搜索"}}}]`,
+		`"filter":[{"term":{"language":{"value":"zh"}}}]`,
+		`"must":[{"match":{"content.en":{"boost":2,"query":"搜索"}}}]`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %s in %s", want, b)
+		}
+	}
+}
+
+func TestChangedProperties(t *testing.T) {
+	existing := map[string]interface{}{
+		"created":        map[string]interface{}{"type": "numeric", "sortable": false},
+		"size":           map[string]interface{}{"type": "numeric", "sortable": true},
+		ContentFieldName: map[string]interface{}{"type": "text"},
+		"where":          map[string]interface{}{"type": "text"},
+	}
+	got := changedProperties(existing, fileIndexProperties())
+	if !reflect.DeepEqual(got, []string{ContentFieldName, "created"}) {
+		t.Fatalf("got %v", got)
+	}
+	existing["created"] = map[string]interface{}{"type": "numeric", "sortable": true}
+	existing[ContentFieldName] = map[string]interface{}{"type": "text", "fields": map[string]interface{}{"zh": nil, "en": nil}}
+	if got := changedProperties(existing, fileIndexProperties()); len(got) != 0 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestPinyinName(t *testing.T) {
+	full, initials := PinyinName("你好报告.docx")
+	if full != "nihaobaogao haobaogao baogao gao" || initials != "nhbg hbg bg g" {
+		t.Fatalf("got %q %q", full, initials)
+	}
+	full, initials = PinyinName("2023项目Plan_v2.pdf")
+	if full != "2023xiangmuplanv2 xiangmuplanv2 muplanv2 planv2 v2" || initials != "2xmpv xmpv mpv pv v" {
+		t.Fatalf("got %q %q", full, initials)
+	}
+	if full, initials = PinyinName("report.docx"); full != "" || initials != "" {
+		t.Fatalf("got %q %q", full, initials)
+	}
+	if len(pinyinQueries("ni hao")) != 2 || pinyinQueries("n") != nil || pinyinQueries("你好") != nil {
+		t.Fatal("unexpected pinyin queries")
+	}
+}
+
+func TestPageFrom(t *testing.T) {
+	if from, err := pageFrom("", ""); err != nil || from != 0 {
+		t.Fatalf("got %d %v", from, err)
+	}
+	if from, err := pageFrom("20", ""); err != nil || from != 20 {
+		t.Fatalf("got %d %v", from, err)
+	}
+	cursor := nextCursor(37, 100)
+	// the cursor wins over the offset
+	if from, err := pageFrom("20", cursor); err != nil || from != 37 {
+		t.Fatalf("got %d %v", from, err)
+	}
+	if nextCursor(100, 100) != "" {
+		t.Fatal("expected no cursor after the last hit")
+	}
+	for _, offset := range []string{"-1", "x"} {
+		if _, err := pageFrom(offset, ""); err == nil {
+			t.Fatalf("expected error for offset %s", offset)
+		}
+	}
+	if _, err := pageFrom("", "not a cursor"); err != ErrCursor {
+		t.Fatalf("expected cursor error, got %v", err)
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	if limit, err := parseLimit(""); err != nil || limit != DefaultMaxResult {
+		t.Fatalf("got %d %v", limit, err)
+	}
+	if limit, err := parseLimit("100000"); err != nil || limit != maxResultLimit {
+		t.Fatalf("expected limit capped to %d, got %d %v", maxResultLimit, limit, err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	s := &Service{}
+	handlers := map[string]gin.HandlerFunc{
+		"file":  s.HandleFileQuery,
+		"multi": func(c *gin.Context) { s.HandleMultiQuery(c, []string{FileIndex, RssIndex}) },
+	}
+	for name, handle := range handlers {
+		for _, limit := range []string{"0", "-5", "x"} {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			form := url.Values{"query": {"hello"}, "limit": {limit}}
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(form.Encode()))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			handle(c)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("%s limit %s: expected status 400, got %d", name, limit, w.Code)
+			}
+		}
+	}
+}
+
+func TestMultiQueryOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Service{}
+	for _, form := range []url.Values{
+		{"type": {"pdf"}},
+		{"where": {"/data/docs"}},
+		{"sort": {"updated_desc"}},
+		{"sort": {"nope"}},
+		{"facets": {"true"}},
+	} {
+		form.Set("query", "hello")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(form.Encode()))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.HandleMultiQuery(c, []string{FileIndex, RssIndex})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%v: expected status 400, got %d", form, w.Code)
+		}
+	}
+	if err := checkMultiIndexOptions(url.Values{"sort": {"relevance"}, "facets": {"false"}}.Get); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseFileQueryFilter(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	form := map[string]string{
+		"type":          "PDF, image",
+		"min_size":      "1.5KB",
+		"max_size":      "10 MB",
+		"created_after": "7d",
+		"updated_after": "1680000000",
+		"sent_after":    "2023-04-01",
+		"sent_before":   "1683000000",
+		"where":         "/data/docs",
+	}
+	filter, err := ParseFileQueryFilter(func(key string) string { return form[key] }, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.MinSize != 1536 || filter.MaxSize != 10<<20 || filter.Where != "/data/docs/" {
+		t.Fatalf("got %+v", filter)
+	}
+	if filter.CreatedAfter != now.AddDate(0, 0, -7).Unix() || filter.UpdatedAfter != 1680000000 {
+		t.Fatalf("got %+v", filter)
+	}
+	if filter.DateFrom != time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local).Unix() || filter.DateTo != 1683000000 {
+		t.Fatalf("got %+v", filter)
+	}
+	exts := strings.Join(filter.extensions(), " ")
+	if !strings.Contains(exts, ".pdf") || !strings.Contains(exts, ".png") || strings.Contains(exts, ".mp3") {
+		t.Fatalf("got extensions %v", exts)
+	}
+	// type, where, size, created, updated and sent
+	if n := len(filter.queries()); n != 6 {
+		t.Fatalf("got %d filter queries", n)
+	}
+	for key, value := range map[string]string{"min_size": "ten", "created_before": "yesterday", "max_size": "3 parsecs", "sent_after": "last spring", "sent_before": "1683000000x"} {
+		_, err := ParseFileQueryFilter(func(k string) string {
+			if k == key {
+				return value
+			}
+			return ""
+		}, now)
+		if err == nil || !strings.HasPrefix(err.Error(), key) {
+			t.Fatalf("expected error for %s=%s, got %v", key, value, err)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	cases := map[string]string{
+		"":            SortRelevance,
+		"relevance":   SortRelevance,
+		"updated":     "updated_desc",
+		"Updated_ASC": "updated_asc",
+		"name":        "name_asc",
+		"size_desc":   "size_desc",
+	}
+	for in, want := range cases {
+		if got, err := ParseSort(in); err != nil || got != want {
+			t.Fatalf("sort %q got %q %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"date", "updated_up", "relevance_asc"} {
+		if _, err := ParseSort(in); err != ErrSort {
+			t.Fatalf("sort %q expected error, got %v", in, err)
+		}
+	}
+	if keys := sortKeys("name_desc"); !reflect.DeepEqual(keys, []string{"-" + NameSortFieldName, "-_score", "_id"}) {
+		t.Fatalf("got %v", keys)
+	}
+	if keys := sortKeys(SortRelevance); !reflect.DeepEqual(keys, []string{"-_score", "_id"}) {
+		t.Fatalf("got %v", keys)
+	}
+}
+
+func TestFacets(t *testing.T) {
+	WatchRoot = "/data"
+	doc := map[string]interface{}{
+		"where":   "/data/Documents/2023/report.pdf",
+		"created": time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local).Unix(),
+		"updated": float64(time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local).Unix()),
+	}
+	addFacetFields(doc)
+	if doc[TopDirFieldName] != "Documents" || doc[UpdatedYearFieldName] != "2023" {
+		t.Fatalf("got %v", doc)
+	}
+	if topDir("/data/notes.md") != "/" || topDir("/data/Backup/a.zip!/docs/spec.pdf") != "Backup" {
+		t.Fatal("unexpected top level folders")
+	}
+	doc = map[string]interface{}{
+		"created": time.Date(2022, 1, 2, 0, 0, 0, 0, time.Local).Unix(),
+		"meta":    `{"feed_infos":[{"feed_id":1,"feed_name":"Go Blog"}]}`,
+	}
+	addFacetFields(doc)
+	if !reflect.DeepEqual(doc[FeedFieldName], []string{"Go Blog"}) || doc[UpdatedYearFieldName] != "2022" {
+		t.Fatalf("got %v", doc)
+	}
+
+	if facets, err := ParseFacets(FileIndex, "all"); err != nil || len(facets) != 3 {
+		t.Fatalf("got %v %v", facets, err)
+	}
+	if facets, err := ParseFacets(RssIndex, "feed, year"); err != nil || !reflect.DeepEqual(facets, []string{FacetFeed, FacetYear}) {
+		t.Fatalf("got %v %v", facets, err)
+	}
+	if _, err := ParseFacets(FileIndex, "feed"); err == nil {
+		t.Fatal("expected error for a facet of another index")
+	}
+
+	facets, err := parseFacets([]byte(`{"hits":{},"aggregations":{"type":{"buckets":[{"key":".pdf","doc_count":7},{"key":".md","doc_count":2}]}}}`))
+	if err != nil || !reflect.DeepEqual(facets["type"], []FacetBucket{{".pdf", 7}, {".md", 2}}) {
+		t.Fatalf("got %v %v", facets, err)
+	}
+}
+
+func TestParseIndices(t *testing.T) {
+	if indices, err := ParseIndices("all"); err != nil || !reflect.DeepEqual(indices, []string{FileIndex, RssIndex}) {
+		t.Fatalf("got %v %v", indices, err)
+	}
+	if indices, err := ParseIndices("Rss, Files,Rss"); err != nil || !reflect.DeepEqual(indices, []string{RssIndex, FileIndex}) {
+		t.Fatalf("got %v %v", indices, err)
+	}
+	for _, index := range []string{"", "Files,Mail"} {
+		if _, err := ParseIndices(index); err == nil {
+			t.Fatalf("expected error for index %q", index)
+		}
+	}
+}
+
+func TestFuseRanked(t *testing.T) {
+	files := []interface{}{
+		FileQueryItem{Index: FileIndex, DocId: "f1"},
+		FileQueryItem{Index: FileIndex, DocId: "f2"},
+		FileQueryItem{Index: FileIndex, DocId: "f3"},
+	}
+	rss := []interface{}{
+		RssQueryItem{Index: RssIndex, DocId: "r1"},
+	}
+	fused := fuseRanked([][]interface{}{files, rss})
+	order := make([]string, 0, len(fused))
+	for _, item := range fused {
+		switch v := item.(type) {
+		case FileQueryItem:
+			order = append(order, v.DocId)
+		case RssQueryItem:
+			order = append(order, v.DocId)
+		}
+	}
+	if !reflect.DeepEqual(order, []string{"f1", "r1", "f2", "f3"}) {
+		t.Fatalf("got %v", order)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	q, err := ParseQuery(`"quarterly report" ext:pdf in:/data/finance -draft name:budget a OR b`, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]QueryTerm{
+		{{Value: "quarterly report", Phrase: true}},
+		{{Field: QueryFieldExt, Value: "pdf"}},
+		{{Field: QueryFieldIn, Value: "/data/finance/"}},
+		{{Value: "draft", Exclude: true}},
+		{{Field: QueryFieldName, Value: "budget"}},
+		{{Value: "a"}, {Value: "b"}},
+	}
+	if !reflect.DeepEqual(q.Groups, want) {
+		t.Fatalf("got %+v", q.Groups)
+	}
+	if q.Text() != "quarterly report a b" {
+		t.Fatalf("got text %q", q.Text())
+	}
+	query := q.Query()
+	if len(query.Bool.Must) != 2 || len(query.Bool.Should) != 2 || len(query.Bool.Filter) != 2 || len(query.Bool.MustNot) != 1 {
+		t.Fatalf("got %+v", query.Bool)
+	}
+	// words are optional next to the required phrase and name
+	if query.Bool.MinimumShouldMatch != nil {
+		t.Fatalf("got minimum should match %v", *query.Bool.MinimumShouldMatch)
+	}
+
+	q, err = ParseQuery(`size:1MB..2MB after:7d name:"annual budget" http://example.com symbol:Parse`, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := q.Groups[0][0]; g.Min != 1<<20 || g.Max != 2<<20 {
+		t.Fatalf("got %+v", g)
+	}
+	if g := q.Groups[1][0]; g.Min != now.AddDate(0, 0, -7).Unix() {
+		t.Fatalf("got %+v", g)
+	}
+	if g := q.Groups[2][0]; g.Value != "annual budget" || !g.Phrase {
+		t.Fatalf("got %+v", g)
+	}
+	// unknown fields are words
+	if g := q.Groups[3][0]; g.Field != "" || g.Value != "http://example.com" {
+		t.Fatalf("got %+v", g)
+	}
+	if q.Text() != "http://example.com" {
+		t.Fatalf("got text %q", q.Text())
+	}
+
+	// a plain word compiles to the term query alone
+	if q, _ := ParseQuery("report", now); !reflect.DeepEqual(q.Query(), termQuery("report")) {
+		t.Fatal("expected a term query")
+	}
+	// any of the plain words matches, +term is required
+	q, _ = ParseQuery("a b", now)
+	for doc, want := range map[string]bool{"a": true, "b x": true, "a b": true, "x": false} {
+		if got := queryMatches(q.Query(), strings.Fields(doc)); got != want {
+			t.Fatalf("%q matching %q got %v", "a b", doc, got)
+		}
+	}
+	q, _ = ParseQuery("+a b", now)
+	if g := q.Groups[0][0]; !g.Require || !g.Required() {
+		t.Fatalf("got %+v", g)
+	}
+	for doc, want := range map[string]bool{"a": true, "a b": true, "b": false} {
+		if got := queryMatches(q.Query(), strings.Fields(doc)); got != want {
+			t.Fatalf("%q matching %q got %v", "+a b", doc, got)
+		}
+	}
+	q, _ = ParseQuery(`"a b" OR c d -e`, now)
+	for doc, want := range map[string]bool{"a b": true, "c": true, "d": false, "c e": false} {
+		if got := queryMatches(q.Query(), strings.Fields(doc)); got != want {
+			t.Fatalf("matching %q got %v", doc, got)
+		}
+	}
+	// filters alone match all documents
+	if q, _ := ParseQuery("ext:pdf", now); q.Query().Bool.Must[0].MatchAll == nil {
+		t.Fatal("expected match all")
+	}
+
+	for _, input := range []string{
+		`"unterminated`, `OR a`, `a OR`, `a OR OR b`, `-a OR b`, `a -`, `name:`,
+		`size:10MB`, `size:<1`, `before:yesterday`, `ext:,`, `  `,
+	} {
+		_, err := ParseQuery(input, now)
+		if _, ok := err.(*QuerySyntaxError); !ok {
+			t.Fatalf("expected syntax error for %q, got %v", input, err)
+		}
+	}
+}
+
+// queryMatches evaluates the bool, match, phrase and match all queries of
+// q against a document holding words, as zinc would for its content.
+func queryMatches(q zinc.MetaQuery, words []string) bool {
+	text := " " + strings.Join(words, " ") + " "
+	switch {
+	case q.MatchAll != nil:
+		return true
+	case q.Match != nil:
+		for _, m := range *q.Match {
+			for _, word := range strings.Fields(m.GetQuery()) {
+				if strings.Contains(text, " "+word+" ") {
+					return true
+				}
+			}
+		}
+	case q.MatchPhrase != nil:
+		for _, m := range *q.MatchPhrase {
+			if strings.Contains(text, " "+m.GetQuery()+" ") {
+				return true
+			}
+		}
+	case q.Bool != nil:
+		for _, sub := range q.Bool.Must {
+			if !queryMatches(sub, words) {
+				return false
+			}
+		}
+		for _, sub := range q.Bool.MustNot {
+			if queryMatches(sub, words) {
+				return false
+			}
+		}
+		if len(q.Bool.Should) == 0 || (len(q.Bool.Must) > 0 && q.Bool.MinimumShouldMatch == nil) {
+			return true
+		}
+		for _, sub := range q.Bool.Should {
+			if queryMatches(sub, words) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestRecentFiles(t *testing.T) {
+	r := &recentFiles{}
+	r.add("/data/Documents/Q3 Report.pdf", 1)
+	r.add("/data/notes/你好报告.md", 2)
+	r.add("/data/budget.xlsx", 3)
+	r.add("/data/Documents/Q3 Report.pdf", 4)
+	if r.files[0].Path != "/data/Documents/Q3 Report.pdf" || r.files[0].Count != 2 || len(r.files) != 3 {
+		t.Fatalf("got %+v", r.files)
+	}
+	for q, want := range map[string]string{
+		"q3":     "/data/Documents/Q3 Report.pdf",
+		"repo":   "/data/Documents/Q3 Report.pdf",
+		"nihao":  "/data/notes/你好报告.md",
+		"bg":     "/data/notes/你好报告.md",
+		"BUDGET": "/data/budget.xlsx",
+	} {
+		if got := r.match(q, 5); len(got) != 1 || got[0].Path != want {
+			t.Fatalf("match %q got %+v", q, got)
+		}
+	}
+	if got := r.match("port", 5); len(got) != 0 {
+		t.Fatalf("expected no match inside a word, got %+v", got)
+	}
+	r.remove("/data/budget.xlsx")
+	if len(r.files) != 2 {
+		t.Fatalf("got %+v", r.files)
+	}
+}
+
+func TestRecentFilesLoad(t *testing.T) {
+	defer func(list func(int64) ([]db.OpenedFile, error)) { listOpened = list }(listOpened)
+	stored := []db.OpenedFile{{Path: "/data/a.txt", Opened: 1, Count: 3}, {Path: "/data/b.txt", Opened: 2}}
+	fail := true
+	listOpened = func(limit int64) ([]db.OpenedFile, error) {
+		if fail {
+			return nil, errors.New("no database")
+		}
+		return stored, nil
+	}
+	r := &recentFiles{}
+	if r.load() {
+		t.Fatal("expected the load to fail")
+	}
+	r.add("/data/b.txt", 5)
+	// a failed load is tried again, files opened since stay ahead
+	fail = false
+	if !r.load() {
+		t.Fatal("expected the load to work")
+	}
+	if len(r.files) != 2 || r.files[0].Path != "/data/b.txt" || r.files[1].Path != "/data/a.txt" {
+		t.Fatalf("got %+v", r.files)
+	}
+}
+
+func TestVocabulary(t *testing.T) {
+	v := NewVocabulary()
+	v.AddDocument("1", map[string]interface{}{"name": "Quarterly Report.pdf", ContentFieldName: "The quarterly report of the finance team, 2023."})
+	v.AddDocument("2", map[string]interface{}{"name": "budget.xlsx", ContentFieldName: "budget forecast 预算 report"})
+	v.Add("reports")
+	if v.Correct("report") != "report" || v.Correct("qaurterly") != "quarterly" || v.Correct("reprot") != "report" {
+		t.Fatalf("got %s %s %s", v.Correct("report"), v.Correct("qaurterly"), v.Correct("reprot"))
+	}
+	// the more frequent of equally close words wins
+	if v.Correct("reportz") != "report" || v.Correct("raport") != "report" {
+		t.Fatalf("got %s %s", v.Correct("reportz"), v.Correct("raport"))
+	}
+	if v.Correct("zzzzzz") != "zzzzzz" || v.Correct("预算") != "预算" {
+		t.Fatal("expected no correction")
+	}
+	got := v.CorrectQuery(`"qaurterly reprot" ext:pdf -drafft budgett OR finanse`)
+	if got != `"quarterly report" ext:pdf -drafft budget OR finance` {
+		t.Fatalf("got %q", got)
+	}
+	if v.CorrectQuery("quarterly budget") != "" {
+		t.Fatal("expected no suggestion for known words")
+	}
+	if editDistance([]rune("abcd"), []rune("acbd"), 2) != 1 || editDistance([]rune("kitten"), []rune("sitting"), 2) != 3 {
+		t.Fatal("unexpected edit distance")
+	}
+	if v.Correct("erport") != "report" {
+		t.Fatalf("got %s", v.Correct("erport"))
+	}
+	// words of replaced and deleted documents are forgotten
+	n := v.Len()
+	v.AddDocument("1", map[string]interface{}{"name": "Quarterly Report.pdf", ContentFieldName: "The quarterly report"})
+	if v.Len() != n-2 || v.Correct("finanse") != "finanse" {
+		t.Fatalf("got %d terms, %s", v.Len(), v.Correct("finanse"))
+	}
+	v.RemoveDocument("2")
+	if v.Len() != n-5 || v.Correct("budgett") != "budgett" || v.Correct("reprot") != "report" {
+		t.Fatalf("got %d terms, %s %s", v.Len(), v.Correct("budgett"), v.Correct("reprot"))
+	}
+	v.RemoveDocument("2")
+	if v.Len() != n-5 {
+		t.Fatalf("got %d terms after removing twice", v.Len())
+	}
+	if got := vocabularyText("a" + strings.Repeat("é", vocabularySample)); !utf8.ValidString(got) || len(got) != vocabularySample-1 {
+		t.Fatalf("got %d bytes", len(got))
+	}
+}
+
+func TestWatchedPath(t *testing.T) {
+	for filepath, want := range map[string]bool{
+		"/data/a.txt":         true,
+		"/data/docs/../b.pdf": true,
+		"/data":               false,
+		"/datax/a.txt":        false,
+		"/data/../etc/passwd": false,
+		"/etc/passwd":         false,
+		"data/a.txt":          false,
+	} {
+		if _, got := watchedPath(filepath); got != want {
+			t.Fatalf("watchedPath %q got %v", filepath, got)
+		}
+	}
+}